@@ -2,9 +2,12 @@ package bond
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -12,44 +15,149 @@ import (
 	"github.com/openconfig/gnmic/pkg/api/target"
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/metadata"
 )
 
 const (
 	ndkSocket           = "unix:///opt/srlinux/var/run/sr_sdk_service_manager:50053"
 	defaultRetryTimeout = 5 * time.Second
+	// maximum time to wait for in-flight RPCs on shutdown
+	defaultShutdownTimeout = 5 * time.Second
 
 	defaultUsername = "admin"
 	defaultPassword = "NokiaSrl1!"
 
-	agentMetadataKey = "agent_name"
+	defaultAgentMetadataKey = "agent_name"
+
+	// timeout of gNMI requests of the gNMI target
+	defaultGNMITimeout = 10 * time.Second
+
+	// maximum number of routes sent in a single RouteAddOrUpdate request
+	defaultRouteBatchSize = 1000
+)
+
+var (
+	// An error is returned if Agent has not connected to the NDK socket.
+	ErrNotConnected = errors.New("agent is not connected to NDK socket")
+	// An error is returned if a keepalive is not acknowledged by NDK mgr.
+	ErrKeepAliveFailed = errors.New("keepalive failed")
+	// An error is returned if Agent is started more than once.
+	ErrAlreadyStarted = errors.New("agent is already started")
+	// An error is returned if Agent is registered with NDK mgr more than once.
+	ErrAlreadyRegistered = errors.New("agent is already registered")
+	// An error is returned if Agent registration with NDK mgr fails.
+	ErrRegistrationFailed = errors.New("agent registration failed")
+	// An error is returned if Agent unregistration with NDK mgr fails.
+	ErrUnregistrationFailed = errors.New("agent unregistration failed")
+	// An error is returned if a mutating NDK RPC is started
+	// after the Agent started stopping.
+	ErrAgentStopping = errors.New("agent is stopping")
 )
 
 type Agent struct {
 	ctx            context.Context
 	cancel         context.CancelFunc
 	Name           string
-	AppID          uint32
+	AppID          uint32 // set by WithAppID and overridden on registration
 	appRootPath    string
 	grpcServerName string // configured grpc-server for gNMI in SR Linux
+	gnmiUsername   string // username of gNMI requests
+	gnmiPassword   string // password of gNMI requests
+	metadataKey    string // gRPC metadata key carrying the agent name
+	// agent will discover the grpc-server name from SR Linux config
+	discoverGrpcServer bool
+	// agent will unregister a stale registration with the same name
+	// and register again if registration conflicts
+	forceReregister bool
+	// started and registered guard against starting
+	// and registering the agent more than once.
+	started    atomic.Bool
+	registered atomic.Bool
+	// commitSeq is the commit sequence of the last
+	// .commit.end notification, sent with config acknowledgements.
+	commitSeq atomic.Int64
+	// lastCommitEnd is the json of the last .commit.end notification
+	// triggering a full config fetch.
+	lastCommitEnd atomic.Pointer[string]
 	// paths contains all paths, in XPath format,
 	// that are used to update the app's state data.
 	// Possible keys include app root path
 	// or any YANG lists.
 	// e.g. /greeter, /greeter/list-node[name=entry1]
 	paths map[string]struct{}
-
-	gRPCConn        *grpc.ClientConn
-	logger          *zerolog.Logger
-	retryTimeout    time.Duration
+	// stateNamespace is the XPath prefix of
+	// UpdateState and DeleteState paths, e.g. /greeter/stats
+	stateNamespace string
+
+	gRPCConn *grpc.ClientConn
+	logger   *zerolog.Logger
+	// baseLogger is the logger set with WithLogger,
+	// logger is baseLogger with agent fields added.
+	baseLogger *zerolog.Logger
+	// logAppID is the app id added to log messages,
+	// updated on registration.
+	logAppID     atomic.Uint32
+	retryTimeout time.Duration
+	// shutdownTimeout bounds the time stop waits for in-flight RPCs.
+	shutdownTimeout time.Duration
+	// inFlight is the number of in-flight mutating NDK RPCs,
+	// e.g. route, nexthop group and state updates.
+	// stopping is set once stop started, new RPCs are refused then.
+	// inFlightIdle is closed when the last in-flight RPC completes
+	// while stop waits for it.
+	inFlightMu   sync.Mutex
+	inFlight     int
+	stopping     bool
+	inFlightIdle chan struct{}
+	// configDone is closed when the config notification goroutine exits,
+	// nil if it was not started.
+	configDone      chan struct{}
+	clock           clock
 	GnmiTarget      *target.Target
 	keepAliveConfig *keepAliveConfig
+	// ndkSocket is the address of the NDK socket the agent connects to.
+	ndkSocket string
+	// externalConn is true if gRPCConn was set with WithGRPCConn,
+	// the connection is owned by the caller and not closed on stop.
+	externalConn bool
+	// gRPC keepalive parameters of the NDK connection
+	grpcKeepalive *keepalive.ClientParameters
+	// maximum gRPC message sizes of the NDK connection in bytes,
+	// gRPC defaults are used if 0.
+	maxRecvMsgSize int
+	maxSendMsgSize int
+	// gnmiSem limits the number of concurrent gNMI operations,
+	// nil if gNMI operations are not limited.
+	gnmiSem chan struct{}
+	// readOnlyGNMI rejects gNMI Set requests.
+	readOnlyGNMI bool
+	// gnmiTLS is the TLS configuration of the gNMI target,
+	// nil if the insecure grpc-server is used.
+	gnmiTLS *gnmiTLSConfig
+	// gnmiAddress is the address of the gNMI target,
+	// the grpc-server unix socket is used if empty.
+	gnmiAddress string
+	// gnmiTimeout is the timeout of gNMI requests of the gNMI target.
+	gnmiTimeout time.Duration
+	// customGNMITarget is true if GnmiTarget was set with WithGNMITarget
+	// and is not created on Start.
+	customGNMITarget bool
 
 	// agent will stream configs individually for each XPath
 	// instead of retrieving full app config
 	streamConfig bool
 
+	// agent will fetch full app config once
+	// for commits received within this window.
+	commitDebounce time.Duration
+
+	// agent will fetch full app config and signal FullConfigReceived
+	// for commits with zero commit sequence.
+	emptyConfigNotif bool
+
 	// SR Linux will wait for explicit acknowledgement
 	// from app after delivering configuration.
 	configAck bool
@@ -61,9 +169,79 @@ type Agent struct {
 	// SR Linux will cache streamed notifications.
 	cacheNotifications bool
 
+	// agent will log full contents of received notifications.
+	verboseNotifLogging bool
+	// logged notifications are marshaled on a single line.
+	compactNotifLogging bool
+
+	// agent will send typed notifications instead of raw NDK notifications.
+	typedNotifications bool
+
+	// routes and nexthop groups targeting unknown network instances
+	// are rejected instead of logged.
+	strictNetInstCheck bool
+
+	// routeBatchSize is the maximum number of routes
+	// sent in a single RouteAddOrUpdate request.
+	routeBatchSize int
+
+	// routeOverflow is the overflow policy of chan Route.
+	routeOverflow OverflowPolicy
+
+	// unresolvedRouteHandler is called for route notifications
+	// of routes without an active nexthop.
+	unresolvedRouteHandler func(*RouteNotification)
+
 	// NDK Service client stubs
 	stubs *stubs
 
+	// appIdents caches AppId notifications keyed by app name.
+	appIdents *registry[*ndk.AppIdentNotification]
+	// interfaces caches interface notifications keyed by interface name.
+	interfaces *registry[*ndk.InterfaceNotification]
+	// networkInstances caches network instance notifications
+	// keyed by network instance name.
+	networkInstances *registry[*ndk.NetworkInstanceNotification]
+	// networkInstancesCached is true once the network instance cache
+	// received its first notification.
+	networkInstancesCached atomic.Bool
+	// nhgs contains nexthop groups programmed by the agent
+	// keyed by network instance and nexthop group name.
+	nhgs *registry[*ndk.NextHopGroupInfo]
+	// routes contains routes programmed by the agent
+	// keyed by network instance and ip prefix.
+	routes *registry[*ndk.RouteInfo]
+	// telemetry contains state data updated by the agent
+	// keyed by XPath.
+	telemetry *registry[string]
+	// subscriptions contains active notification subscriptions
+	// keyed by notification type.
+	subscriptions *registry[subscription]
+	// replaySize is the number of recent notifications
+	// kept per notification type for replay, 0 if disabled.
+	replaySize int
+	// replays contains the replay buffers keyed by notification type.
+	replayMu sync.Mutex
+	replays  map[NotificationType]any
+	// lastNotifs contains the time of the last received notification
+	// keyed by notification type.
+	lastNotifs *registry[time.Time]
+	// receiving contains the notification types
+	// a Receive<type>Notifications method was started for.
+	// Notifications chans are closed once receiving stops,
+	// so every type can only be received once.
+	receiving sync.Map
+	// receivingAll is true once ReceiveAll was called.
+	receivingAll atomic.Bool
+
+	// metrics hook callbacks
+	metrics MetricsHook
+
+	// cfgWaiters contains callers of WaitForConfigPath
+	// waiting for streamed configs.
+	cfgWaitersMu sync.Mutex
+	cfgWaiters   map[*configWaiter]struct{}
+
 	// NDK streamed notification channels
 	Notifications *Notifications
 }
@@ -97,19 +275,38 @@ func NewAgent(name string, opts ...Option) (*Agent, []error) {
 	var errs []error
 
 	a := &Agent{
-		Name:           name,
-		retryTimeout:   defaultRetryTimeout,
-		paths:          make(map[string]struct{}),
-		grpcServerName: defaultGrpcServerName,
+		Name:             name,
+		ndkSocket:        ndkSocket,
+		retryTimeout:     defaultRetryTimeout,
+		shutdownTimeout:  defaultShutdownTimeout,
+		routeBatchSize:   defaultRouteBatchSize,
+		clock:            realClock{},
+		paths:            make(map[string]struct{}),
+		grpcServerName:   defaultGrpcServerName,
+		gnmiUsername:     defaultUsername,
+		gnmiPassword:     defaultPassword,
+		gnmiTimeout:      defaultGNMITimeout,
+		metadataKey:      defaultAgentMetadataKey,
+		appIdents:        newRegistry[*ndk.AppIdentNotification](),
+		interfaces:       newRegistry[*ndk.InterfaceNotification](),
+		networkInstances: newRegistry[*ndk.NetworkInstanceNotification](),
+		nhgs:             newRegistry[*ndk.NextHopGroupInfo](),
+		routes:           newRegistry[*ndk.RouteInfo](),
+		telemetry:        newRegistry[string](),
+		subscriptions:    newRegistry[subscription](),
+		lastNotifs:       newRegistry[time.Time](),
 		Notifications: &Notifications{
 			FullConfigReceived: make(chan struct{}),
 			Config:             make(chan *ConfigNotification),
 			Interface:          make(chan *ndk.InterfaceNotification),
 			Route:              make(chan *ndk.IpRouteNotification),
+			RouteEvent:         make(chan *RouteNotification),
 			NextHopGroup:       make(chan *ndk.NextHopGroupNotification),
 			NwInst:             make(chan *ndk.NetworkInstanceNotification),
 			Lldp:               make(chan *ndk.LldpNeighborNotification),
+			LldpNeighbor:       make(chan *LldpNeighborNotification),
 			Bfd:                make(chan *ndk.BfdSessionNotification),
+			BfdSession:         make(chan *BfdSessionNotification),
 			AppId:              make(chan *ndk.AppIdentNotification),
 		},
 	}
@@ -126,14 +323,44 @@ func NewAgent(name string, opts ...Option) (*Agent, []error) {
 		return nil, errs
 	}
 
-	a.ctx = metadata.AppendToOutgoingContext(a.ctx, agentMetadataKey, a.Name)
+	a.setLoggerFields()
+	a.ctx = metadata.AppendToOutgoingContext(a.ctx, a.metadataKey, a.Name)
 	return a, errs
 }
 
+// setLoggerFields sets the Agent logger to the logger set with WithLogger
+// with fields for the agent name and app id added,
+// so that all log messages are attributable to the agent.
+// The app id field follows the app id assigned on registration.
+func (a *Agent) setLoggerFields() {
+	a.logAppID.Store(a.AppID)
+	if a.baseLogger == nil {
+		return
+	}
+	l := a.baseLogger.With().
+		Str("agent", a.Name).
+		Logger().
+		Hook(zerolog.HookFunc(func(e *zerolog.Event, _ zerolog.Level, _ string) {
+			e.Uint32("app_id", a.logAppID.Load())
+		}))
+	a.logger = &l
+}
+
+// Start connects the Agent to the NDK socket and the gNMI server,
+// registers it with NDK mgr and starts receiving config notifications.
+// An error is returned if Start is called more than once.
+// An error wrapping ErrGNMITargetFailed is returned
+// if the Agent cannot connect to the gNMI server.
 func (a *Agent) Start() error {
+	if !a.started.CompareAndSwap(false, true) {
+		a.logger.Error().Msg("Agent is already started")
+		return ErrAlreadyStarted
+	}
+
 	// connect to NDK socket
 	err := a.connect()
 	if err != nil {
+		a.started.Store(false)
 		return err
 	}
 
@@ -149,9 +376,20 @@ func (a *Agent) Start() error {
 		configService:       ndk.NewSdkMgrConfigServiceClient(a.gRPCConn),
 	}
 
+	// create gNMI target before registering,
+	// so that the agent is not left registered if it fails
+	err = a.startGNMI()
+	if err != nil {
+		a.disconnect()
+		a.started.Store(false)
+		return err
+	}
+
 	// register agent
 	err = a.register()
 	if err != nil {
+		a.disconnect()
+		a.started.Store(false)
 		return err
 	}
 
@@ -162,13 +400,37 @@ func (a *Agent) Start() error {
 		go a.keepAlive(a.ctx, a.keepAliveConfig.interval, a.keepAliveConfig.threshold)
 	}
 
-	a.newGNMITarget()
-
-	go a.receiveConfigNotifications(a.ctx)
+	a.startConfigNotifications(a.ctx)
 
 	return nil
 }
 
+// disconnect closes the gRPC connection and the gNMI target
+// created by a failed Start, so that Start can be retried.
+// The connection set with WithGRPCConn
+// and the target set with WithGNMITarget are kept.
+func (a *Agent) disconnect() {
+	a.stubs = nil
+
+	if a.gRPCConn != nil && !a.externalConn {
+		if err := a.gRPCConn.Close(); err != nil {
+			a.logger.Error().
+				Err(err).
+				Msg("Closing gRPC connection to NDK server failed")
+		}
+		a.gRPCConn = nil
+	}
+
+	if a.GnmiTarget != nil && !a.customGNMITarget {
+		if err := a.GnmiTarget.Close(); err != nil {
+			a.logger.Error().
+				Err(err).
+				Msg("Closing gNMI target failed")
+		}
+		a.GnmiTarget = nil
+	}
+}
+
 // exitHandle handles when the application stops and receives interrupt/SIGTERM signals.
 func (a *Agent) exitHandler() {
 	sig := make(chan os.Signal, 1)
@@ -180,34 +442,54 @@ func (a *Agent) exitHandler() {
 }
 
 // stop performs graceful shutdown of the application.
-// Actions performed include unregistering the agent with ndk server,
+// Actions performed include waiting for in-flight RPCs,
+// unregistering the agent with ndk server,
 // closing the grpc channel, and closing the program context.
-// All program goroutines will react to the context cancellation and exit.
+// All program goroutines will react to the context cancellation and exit,
+// stop waits for the config notification goroutine to exit.
+// stop is safe to call on an Agent that was not started
+// or failed to start, e.g. on SIGTERM before Start connected.
 func (a *Agent) stop() {
+	defer a.waitConfigNotifications()
 	defer a.cancel() // cancel app context
 
 	a.logger.Info().
 		Msg("Application has stopped and will exit gracefully.")
 
-	// unregister agent
-	err := a.unregister()
-	if err != nil {
-		a.logger.Error().
-			Err(err).
-			Msg("Application has failed to unregister.")
-		return
+	a.waitInFlight()
+
+	// Start may have failed before connecting or creating the stubs
+	if a.gRPCConn == nil || a.stubs == nil {
+		a.logger.Debug().
+			Msg("Agent is not connected to NDK, skipping unregistration")
+	} else {
+		// unregister agent
+		err := a.unregister()
+		if err != nil {
+			a.logger.Error().
+				Err(err).
+				Msg("Application has failed to unregister.")
+			return
+		}
 	}
 
-	// close gRPC connection
-	err = a.gRPCConn.Close()
-	if err != nil {
-		a.logger.Error().
-			Err(err).
-			Msg("Closing gRPC connection to NDK server failed")
+	// close gRPC connection, unless it is owned by the caller
+	if a.gRPCConn != nil && !a.externalConn {
+		err := a.gRPCConn.Close()
+		if err != nil {
+			a.logger.Error().
+				Err(err).
+				Msg("Closing gRPC connection to NDK server failed")
+		}
 	}
 
 	// close gNMI target
-	err = a.GnmiTarget.Close()
+	if a.GnmiTarget == nil {
+		a.logger.Debug().
+			Msg("gNMI target is not created, skipping close")
+		return
+	}
+	err := a.GnmiTarget.Close()
 	if err != nil {
 		a.logger.Error().
 			Err(err).
@@ -215,10 +497,94 @@ func (a *Agent) stop() {
 	}
 }
 
-// connect attempts connecting to the NDK socket.
+// trackRPC marks a mutating NDK RPC as in flight
+// until the returned done func is called.
+// stop waits for in-flight RPCs before closing the gRPC connection.
+// ErrAgentStopping is returned, and the RPC must not be sent,
+// once stop started.
+//
+// Usage:
+//
+//	done, err := a.trackRPC()
+//	if err != nil {
+//		return err
+//	}
+//	defer done()
+func (a *Agent) trackRPC() (done func(), err error) {
+	a.inFlightMu.Lock()
+	defer a.inFlightMu.Unlock()
+	if a.stopping {
+		a.logger.Error().Msg("Agent is stopping, not sending NDK request")
+		return nil, ErrAgentStopping
+	}
+	a.inFlight++
+	return func() {
+		a.inFlightMu.Lock()
+		defer a.inFlightMu.Unlock()
+		a.inFlight--
+		if a.inFlight == 0 && a.inFlightIdle != nil {
+			close(a.inFlightIdle)
+			a.inFlightIdle = nil
+		}
+	}, nil
+}
+
+// waitInFlight refuses new RPCs and waits for in-flight RPCs
+// to complete for at most the shutdown timeout.
+func (a *Agent) waitInFlight() {
+	a.inFlightMu.Lock()
+	a.stopping = true
+	if a.inFlight == 0 {
+		a.inFlightMu.Unlock()
+		return
+	}
+	idle := make(chan struct{})
+	a.inFlightIdle = idle
+	a.inFlightMu.Unlock()
+
+	select {
+	case <-idle:
+	case <-a.clock.After(a.shutdownTimeout):
+		a.logger.Warn().
+			Msgf("In-flight RPCs did not complete within %s, shutting down", a.shutdownTimeout)
+	}
+}
+
+// startConfigNotifications starts receiving config notifications
+// in a goroutine, configDone is closed once the goroutine exits.
+func (a *Agent) startConfigNotifications(ctx context.Context) {
+	a.configDone = make(chan struct{})
+	go func() {
+		defer close(a.configDone)
+		a.receiveConfigNotifications(ctx)
+	}()
+}
+
+// waitConfigNotifications waits for the config notification goroutine
+// to exit after the app context is cancelled
+// for at most the shutdown timeout.
+func (a *Agent) waitConfigNotifications() {
+	if a.configDone == nil {
+		return
+	}
+
+	select {
+	case <-a.configDone:
+	case <-a.clock.After(a.shutdownTimeout):
+		a.logger.Warn().
+			Msgf("Config notification stream did not exit within %s", a.shutdownTimeout)
+	}
+}
+
+// connect attempts connecting to the NDK socket
+// set with WithNDKSocket, the SR Linux NDK socket by default.
+// The connection set with WithGRPCConn is used without dialing.
 func (a *Agent) connect() error {
-	conn, err := grpc.Dial(ndkSocket,
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if a.externalConn {
+		return nil
+	}
+
+	conn, err := grpc.Dial(a.ndkSocket, a.dialOptions()...)
 	if err != nil {
 		return err
 	}
@@ -228,26 +594,115 @@ func (a *Agent) connect() error {
 	return err
 }
 
+// dialOptions returns the gRPC dial options used to connect to the NDK socket.
+func (a *Agent) dialOptions() []grpc.DialOption {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	if a.grpcKeepalive != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*a.grpcKeepalive))
+	}
+	if callOpts := a.callOptions(); len(callOpts) != 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	return opts
+}
+
+// callOptions returns the default gRPC call options
+// of RPCs sent over the NDK connection.
+func (a *Agent) callOptions() []grpc.CallOption {
+	var opts []grpc.CallOption
+	if a.maxRecvMsgSize != 0 {
+		opts = append(opts, grpc.MaxCallRecvMsgSize(a.maxRecvMsgSize))
+	}
+	if a.maxSendMsgSize != 0 {
+		opts = append(opts, grpc.MaxCallSendMsgSize(a.maxSendMsgSize))
+	}
+	return opts
+}
+
+// ConnState returns the current connectivity state
+// of the gRPC connection to the NDK socket.
+// connectivity.Idle is returned if the Agent has not connected yet.
+func (a *Agent) ConnState() connectivity.State {
+	if a.gRPCConn == nil {
+		return connectivity.Idle
+	}
+	return a.gRPCConn.GetState()
+}
+
+// WaitForConnReady blocks until the gRPC connection to the NDK socket
+// is ready or ctx is done.
+// An error is returned if ctx is done before the connection is ready
+// or if the Agent has not connected yet.
+func (a *Agent) WaitForConnReady(ctx context.Context) error {
+	if a.gRPCConn == nil {
+		return ErrNotConnected
+	}
+	for {
+		state := a.gRPCConn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			a.gRPCConn.Connect()
+		}
+		if !a.gRPCConn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("%w: connection state %s", ctx.Err(), state)
+		}
+	}
+}
+
+// CachingEnabled returns true if Agent has option WithCaching set,
+// i.e. SR Linux caches notifications streamed to the agent.
+// Caching changes notification semantics, e.g. notifications carry
+// distinct Create and Update ops and Delete notifications carry data,
+// so apps handling notifications can branch on it.
+func (a *Agent) CachingEnabled() bool {
+	return a.cacheNotifications
+}
+
 // register registers the agent with NDK.
+// If Agent has option WithForceReregister set and NDK mgr rejects
+// the registration, e.g. because of a stale registration of the same app,
+// the agent unregisters and registers again.
+// Errors sending the registration request are returned as is.
+// An error wrapping ErrRegistrationFailed is returned if registration fails.
 func (a *Agent) register() error {
+	if a.registered.Load() {
+		a.logger.Error().Msg("Agent is already registered")
+		return ErrAlreadyRegistered
+	}
+
 	req := &ndk.AgentRegistrationRequest{
 		WaitConfigAck:      a.configAck,
 		AutoTelemetryState: a.autoCfgState,
 		EnableCache:        a.cacheNotifications,
 	}
-	resp, err := a.stubs.sdkMgrService.AgentRegister(a.ctx, req)
-	if err != nil || resp.Status != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Fatal().
+	resp, err := a.agentRegister(req)
+	if err != nil && resp != nil && a.forceReregister {
+		// a previous instance of the app may not have unregistered
+		a.logger.Warn().
 			Err(err).
-			Str("status", resp.GetStatus().String()).
-			Msg("Agent registration failed")
+			Msg("Unregistering possibly stale registration before registering again")
 
-		return fmt.Errorf("agent registration failed")
+		if uerr := a.unregister(); uerr != nil {
+			return fmt.Errorf("%w: %w", err, uerr)
+		}
+		resp, err = a.agentRegister(req)
+	}
+	if err != nil {
+		return err
+	}
+
+	a.registered.Store(true)
+
+	if resp.GetAppId() != 0 {
+		a.AppID = resp.GetAppId()
+		a.logAppID.Store(a.AppID)
 	}
 
 	a.logger.Info().
-		Uint32("app-id", resp.GetAppId()).
-		Str("name", a.Name).
 		Bool("config-ack", a.configAck).
 		Bool("auto-telemetry-state", a.autoCfgState).
 		Bool("cache-notifications", a.cacheNotifications).
@@ -256,31 +711,72 @@ func (a *Agent) register() error {
 	return nil
 }
 
+// agentRegister sends the registration request req to NDK mgr.
+// An error wrapping ErrRegistrationFailed is returned if registration fails.
+// If NDK mgr responded with a failure status, the response
+// is returned along with the error.
+func (a *Agent) agentRegister(req *ndk.AgentRegistrationRequest) (*ndk.AgentRegistrationResponse, error) {
+	resp, err := a.stubs.sdkMgrService.AgentRegister(a.ctx, req)
+	if err != nil || resp.Status != ndk.SdkMgrStatus_kSdkMgrSuccess {
+		a.logger.Error().
+			Err(err).
+			Str("status", resp.GetStatus().String()).
+			Str("error", resp.GetErrorStr()).
+			Msg("Agent registration failed")
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRegistrationFailed, err)
+		}
+		return resp, fmt.Errorf("%w: %s", ErrRegistrationFailed, resp.GetErrorStr())
+	}
+	return resp, nil
+}
+
 // unregister unregisters the agent from NDK.
 func (a *Agent) unregister() error {
 	r, err := a.stubs.sdkMgrService.AgentUnRegister(a.ctx, &ndk.AgentRegistrationRequest{})
 	if err != nil || r.Status != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Fatal().
+		a.logger.Error().
 			Err(err).
 			Str("status", r.GetStatus().String()).
+			Str("error", r.GetErrorStr()).
 			Msg("Agent unregistration failed")
 
-		return fmt.Errorf("agent unregistration failed")
+		return ErrUnregistrationFailed
 	}
 
+	a.registered.Store(false)
+
 	a.logger.Info().
-		Uint32("app-id", r.GetAppId()).
-		Str("name", a.Name).
 		Msg("Application unregistered successfully!")
 
 	return nil
 }
 
+// Ping sends a single keepalive message to NDK mgr.
+// An error is returned if the keepalive RPC fails
+// or if NDK mgr responds with a failed status.
+// ErrNotConnected is returned if the Agent is not connected to NDK.
+// Ping can be used by apps to implement health checks.
+func (a *Agent) Ping() error {
+	if a.stubs == nil {
+		return ErrNotConnected
+	}
+	resp, err := a.stubs.sdkMgrService.KeepAlive(a.ctx, &ndk.KeepAliveRequest{})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKeepAliveFailed, err)
+	}
+	if resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
+		return fmt.Errorf("%w: status: %s", ErrKeepAliveFailed, resp.GetStatus().String())
+	}
+	return nil
+}
+
 // keepAlive sends periodic keepalive messages until NDK mgr has failed threshold times.
 // SR Linux will respond with a status message: kSdkMgrSuccess or kSdkMgrFailed.
 func (a *Agent) keepAlive(ctx context.Context, interval time.Duration, threshold int) {
 	errCounter := 0
-	timer := time.NewTicker(interval)
+	timer := a.clock.NewTicker(interval)
 
 	for {
 		select {
@@ -288,11 +784,10 @@ func (a *Agent) keepAlive(ctx context.Context, interval time.Duration, threshold
 			timer.Stop()
 
 			a.logger.Info().
-				Str("name", a.Name).
 				Msg("context has been cancelled, agent stopped sending keepalives.")
 			return
 
-		case <-timer.C: // send keepalives every interval
+		case <-timer.C(): // send keepalives every interval
 			resp, err := a.stubs.sdkMgrService.KeepAlive(a.ctx, &ndk.KeepAliveRequest{})
 			if err != nil { // retry RPC if failure
 				a.logger.Info().
@@ -300,7 +795,7 @@ func (a *Agent) keepAlive(ctx context.Context, interval time.Duration, threshold
 					Str("status", resp.GetStatus().String()).
 					Msgf("Agent failed to send keepalives., retrying in %s", a.retryTimeout)
 
-				time.Sleep(a.retryTimeout)
+				a.clock.Sleep(a.retryTimeout)
 
 				continue
 			}
@@ -308,14 +803,12 @@ func (a *Agent) keepAlive(ctx context.Context, interval time.Duration, threshold
 			status := resp.GetStatus()
 
 			a.logger.Info().
-				Str("name", a.Name).
-				Msgf("Agent sent keepalive at %s and received response status: %s", time.Now(), status.String())
+				Msgf("Agent sent keepalive at %s and received response status: %s", a.clock.Now(), status.String())
 
 			if status == ndk.SdkMgrStatus_kSdkMgrFailed { // sdk_mgr has failed
 				errCounter += 1
 				if errCounter >= a.keepAliveConfig.threshold {
 					a.logger.Info().
-						Str("name", a.Name).
 						Msgf("Agent keepalives have been stopped because sdk mgr has failed %d times.", threshold)
 					return
 				}
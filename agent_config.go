@@ -0,0 +1,88 @@
+package bond
+
+import (
+	"errors"
+	"time"
+)
+
+// AgentConfig is a plain representation of Agent options,
+// e.g. for apps that read their Agent settings from a config file.
+// Zero values leave the corresponding option unset,
+// so Agent defaults apply.
+type AgentConfig struct {
+	Name string // Agent name, required
+	// NDKSocket is the address of the NDK socket, see WithNDKSocket.
+	NDKSocket string
+	// AppRootPath is the app's root XPath, see WithAppRootPath.
+	AppRootPath string
+	// GrpcServerName is the grpc-server whose unix socket
+	// is used for gNMI, see WithGrpcServerName.
+	GrpcServerName string
+	// StreamConfig streams configs individually, see WithStreamConfig.
+	StreamConfig bool
+	// ConfigAcknowledge requires apps to acknowledge configs,
+	// see WithConfigAcknowledge.
+	ConfigAcknowledge bool
+	// Username and Password authenticate gNMI requests,
+	// see WithGNMICredentials.
+	Username string
+	Password string
+	// CommitDebounce is the commit debounce window, see WithCommitDebounce.
+	CommitDebounce time.Duration
+	// ShutdownTimeout limits the wait for in-flight RPCs on shutdown,
+	// see WithShutdownTimeout.
+	ShutdownTimeout time.Duration
+	// KeepAliveInterval and KeepAliveThreshold configure
+	// NDK keepalives, see WithKeepAlive.
+	KeepAliveInterval  time.Duration
+	KeepAliveThreshold int
+}
+
+// NewAgentFromConfig creates a new Agent instance from cfg.
+// cfg fields are mapped onto the corresponding options,
+// which are applied the same way as with NewAgent.
+// Options without an AgentConfig field, e.g. WithContext or WithLogger,
+// are passed as opts and applied after the options mapped from cfg.
+// All option errors are joined into the returned error.
+//
+// Example: NewAgentFromConfig(AgentConfig{Name: "greeter", AppRootPath: "/greeter"}, WithContext(ctx, cancel))
+func NewAgentFromConfig(cfg AgentConfig, opts ...Option) (*Agent, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("creating agent failed. name cannot be empty")
+	}
+
+	var cfgOpts []Option
+	if cfg.NDKSocket != "" {
+		cfgOpts = append(cfgOpts, WithNDKSocket(cfg.NDKSocket))
+	}
+	if cfg.AppRootPath != "" {
+		cfgOpts = append(cfgOpts, WithAppRootPath(cfg.AppRootPath))
+	}
+	if cfg.GrpcServerName != "" {
+		cfgOpts = append(cfgOpts, WithGrpcServerName(cfg.GrpcServerName))
+	}
+	if cfg.StreamConfig {
+		cfgOpts = append(cfgOpts, WithStreamConfig())
+	}
+	if cfg.ConfigAcknowledge {
+		cfgOpts = append(cfgOpts, WithConfigAcknowledge())
+	}
+	if cfg.Username != "" || cfg.Password != "" {
+		cfgOpts = append(cfgOpts, WithGNMICredentials(cfg.Username, cfg.Password))
+	}
+	if cfg.CommitDebounce != 0 {
+		cfgOpts = append(cfgOpts, WithCommitDebounce(cfg.CommitDebounce))
+	}
+	if cfg.ShutdownTimeout != 0 {
+		cfgOpts = append(cfgOpts, WithShutdownTimeout(cfg.ShutdownTimeout))
+	}
+	if cfg.KeepAliveInterval != 0 || cfg.KeepAliveThreshold != 0 {
+		cfgOpts = append(cfgOpts, WithKeepAlive(cfg.KeepAliveInterval, cfg.KeepAliveThreshold))
+	}
+
+	a, errs := NewAgent(cfg.Name, append(cfgOpts, opts...)...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return a, nil
+}
@@ -0,0 +1,128 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNewAgentFromConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logger := zerolog.Nop()
+
+	cfg := AgentConfig{
+		Name:               "greeter",
+		NDKSocket:          "unix:///tmp/ndk.sock",
+		AppRootPath:        "/greeter",
+		GrpcServerName:     "ndk-gnmi",
+		StreamConfig:       true,
+		ConfigAcknowledge:  true,
+		Username:           "bond",
+		Password:           "secret",
+		CommitDebounce:     time.Second,
+		ShutdownTimeout:    2 * time.Second,
+		KeepAliveInterval:  10 * time.Second,
+		KeepAliveThreshold: 3,
+	}
+
+	a, err := NewAgentFromConfig(cfg, WithLogger(&logger), WithContext(ctx, cancel))
+	if err != nil {
+		t.Fatalf("NewAgentFromConfig() returned error: %v", err)
+	}
+
+	if a.Name != cfg.Name {
+		t.Errorf("Name = %s, want %s", a.Name, cfg.Name)
+	}
+	if a.ndkSocket != cfg.NDKSocket {
+		t.Errorf("ndkSocket = %s, want %s", a.ndkSocket, cfg.NDKSocket)
+	}
+	if a.appRootPath != cfg.AppRootPath {
+		t.Errorf("appRootPath = %s, want %s", a.appRootPath, cfg.AppRootPath)
+	}
+	if a.grpcServerName != cfg.GrpcServerName {
+		t.Errorf("grpcServerName = %s, want %s", a.grpcServerName, cfg.GrpcServerName)
+	}
+	if !a.streamConfig || !a.configAck {
+		t.Errorf("streamConfig = %t, configAck = %t, want both true", a.streamConfig, a.configAck)
+	}
+	if a.gnmiUsername != cfg.Username || a.gnmiPassword != cfg.Password {
+		t.Errorf("gNMI credentials = %s/%s, want %s/%s",
+			a.gnmiUsername, a.gnmiPassword, cfg.Username, cfg.Password)
+	}
+	if a.commitDebounce != cfg.CommitDebounce {
+		t.Errorf("commitDebounce = %s, want %s", a.commitDebounce, cfg.CommitDebounce)
+	}
+	if a.shutdownTimeout != cfg.ShutdownTimeout {
+		t.Errorf("shutdownTimeout = %s, want %s", a.shutdownTimeout, cfg.ShutdownTimeout)
+	}
+	if a.keepAliveConfig.interval != cfg.KeepAliveInterval ||
+		a.keepAliveConfig.threshold != cfg.KeepAliveThreshold {
+		t.Errorf("keepalive = %s/%d, want %s/%d", a.keepAliveConfig.interval, a.keepAliveConfig.threshold,
+			cfg.KeepAliveInterval, cfg.KeepAliveThreshold)
+	}
+}
+
+func TestNewAgentFromConfigDefaults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := NewAgentFromConfig(AgentConfig{Name: "greeter"}, WithContext(ctx, cancel))
+	if err != nil {
+		t.Fatalf("NewAgentFromConfig() returned error: %v", err)
+	}
+	if a.ndkSocket != ndkSocket {
+		t.Errorf("ndkSocket = %s, want %s", a.ndkSocket, ndkSocket)
+	}
+	if a.grpcServerName != defaultGrpcServerName {
+		t.Errorf("grpcServerName = %s, want %s", a.grpcServerName, defaultGrpcServerName)
+	}
+	if a.gnmiUsername != defaultUsername || a.gnmiPassword != defaultPassword {
+		t.Errorf("gNMI credentials = %s/%s, want defaults", a.gnmiUsername, a.gnmiPassword)
+	}
+	if a.shutdownTimeout != defaultShutdownTimeout {
+		t.Errorf("shutdownTimeout = %s, want %s", a.shutdownTimeout, defaultShutdownTimeout)
+	}
+	if a.keepAliveConfig.IsSet() {
+		t.Errorf("keepalives are set, want unset")
+	}
+}
+
+func TestNewAgentFromConfigInvalid(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := map[string]struct {
+		cfg     AgentConfig
+		wantErr error
+	}{
+		"Missing name": {
+			cfg: AgentConfig{AppRootPath: "/greeter"},
+		},
+		"Ack without stream": {
+			cfg:     AgentConfig{Name: "greeter", ConfigAcknowledge: true},
+			wantErr: ErrAckCfgAndNotStreamCfg,
+		},
+		"Negative shutdown timeout": {
+			cfg: AgentConfig{Name: "greeter", ShutdownTimeout: -time.Second},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a, err := NewAgentFromConfig(tc.cfg, WithContext(ctx, cancel))
+			if err == nil {
+				t.Fatal("NewAgentFromConfig() returned no error")
+			}
+			if a != nil {
+				t.Errorf("NewAgentFromConfig() returned agent on error")
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("NewAgentFromConfig() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,790 @@
+package bond
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"github.com/openconfig/gnmic/pkg/api/target"
+	"github.com/openconfig/gnmic/pkg/api/types"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestAgent creates an Agent with a no-op logger and a cancellable context.
+// The context is cancelled when the test finishes.
+func newTestAgent(t *testing.T, opts ...Option) *Agent {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	logger := zerolog.Nop()
+	opts = append([]Option{WithLogger(&logger), WithContext(ctx, cancel)}, opts...)
+
+	a, errs := NewAgent("test", opts...)
+	if len(errs) != 0 {
+		t.Fatalf("NewAgent() returned errors: %v", errs)
+	}
+	return a
+}
+
+// fakeSdkMgrService is a fake NDK SdkMgrServiceClient.
+// Calling a method that is not overridden panics.
+type fakeSdkMgrService struct {
+	ndk.SdkMgrServiceClient
+
+	keepAliveResp *ndk.KeepAliveResponse
+	keepAliveErr  error
+
+	// appId is returned in successful AgentRegister responses.
+	appId uint32
+	// registrations is the number of AgentRegister calls.
+	registrations int
+	// agentRegisterResps are returned in order by AgentRegister calls
+	// before calls succeed, agentRegisterErr is returned if set.
+	agentRegisterResps []*ndk.AgentRegistrationResponse
+	agentRegisterErr   error
+	// unregisterResp is returned by AgentUnRegister calls, success if nil.
+	unregisterResp *ndk.AgentRegistrationResponse
+	// calls records AgentRegister and AgentUnRegister calls in order.
+	calls []string
+
+	mu          sync.Mutex
+	registerReq []*ndk.NotificationRegisterRequest
+	// registerFailures is the number of NotificationRegister calls
+	// that fail before calls succeed.
+	registerFailures int
+	// zeroStreamIDs is the number of successful NotificationRegister
+	// calls returning stream ID 0 after registerFailures.
+	zeroStreamIDs int
+}
+
+func (f *fakeSdkMgrService) KeepAlive(_ context.Context, _ *ndk.KeepAliveRequest, _ ...grpc.CallOption) (*ndk.KeepAliveResponse, error) {
+	return f.keepAliveResp, f.keepAliveErr
+}
+
+func (f *fakeSdkMgrService) AgentRegister(_ context.Context, _ *ndk.AgentRegistrationRequest, _ ...grpc.CallOption) (*ndk.AgentRegistrationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.registrations++
+	f.calls = append(f.calls, "register")
+	if f.agentRegisterErr != nil {
+		return nil, f.agentRegisterErr
+	}
+	if len(f.agentRegisterResps) != 0 {
+		resp := f.agentRegisterResps[0]
+		f.agentRegisterResps = f.agentRegisterResps[1:]
+		return resp, nil
+	}
+	return &ndk.AgentRegistrationResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess, AppId: f.appId}, nil
+}
+
+func (f *fakeSdkMgrService) AgentUnRegister(_ context.Context, _ *ndk.AgentRegistrationRequest, _ ...grpc.CallOption) (*ndk.AgentRegistrationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "unregister")
+	if f.unregisterResp != nil {
+		return f.unregisterResp, nil
+	}
+	return &ndk.AgentRegistrationResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+// NotificationRegister records the request and returns a successful response
+// with stream ID 1 and a subscription ID for each added subscription.
+// The first registerFailures calls return a failed status,
+// the next zeroStreamIDs calls a successful status with stream ID 0.
+func (f *fakeSdkMgrService) NotificationRegister(_ context.Context, req *ndk.NotificationRegisterRequest, _ ...grpc.CallOption) (*ndk.NotificationRegisterResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.registerReq = append(f.registerReq, req)
+	if f.registerFailures > 0 {
+		f.registerFailures--
+		return &ndk.NotificationRegisterResponse{Status: ndk.SdkMgrStatus_kSdkMgrFailed}, nil
+	}
+	if f.zeroStreamIDs > 0 {
+		f.zeroStreamIDs--
+		return &ndk.NotificationRegisterResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+	}
+	return &ndk.NotificationRegisterResponse{
+		Status:   ndk.SdkMgrStatus_kSdkMgrSuccess,
+		StreamId: 1,
+		SubId:    uint64(len(f.registerReq)),
+	}, nil
+}
+
+// registerRequests returns the recorded NotificationRegister requests.
+func (f *fakeSdkMgrService) registerRequests() []*ndk.NotificationRegisterRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*ndk.NotificationRegisterRequest{}, f.registerReq...)
+}
+
+// fakeNotificationService is a fake NDK SdkNotificationServiceClient
+// that streams the configured responses.
+type fakeNotificationService struct {
+	ndk.SdkNotificationServiceClient
+
+	responses []*ndk.NotificationStreamResponse
+	// streamErr makes NotificationStream calls fail if set.
+	streamErr error
+}
+
+func (f *fakeNotificationService) NotificationStream(ctx context.Context, _ *ndk.NotificationStreamRequest, _ ...grpc.CallOption) (ndk.SdkNotificationService_NotificationStreamClient, error) {
+	if f.streamErr != nil {
+		return nil, f.streamErr
+	}
+	return &fakeNotificationStream{ctx: ctx, responses: f.responses}, nil
+}
+
+// fakeNotificationStream returns the configured responses in order
+// and then blocks until its context is cancelled.
+type fakeNotificationStream struct {
+	grpc.ClientStream
+
+	ctx       context.Context
+	responses []*ndk.NotificationStreamResponse
+}
+
+func (f *fakeNotificationStream) Recv() (*ndk.NotificationStreamResponse, error) {
+	if len(f.responses) == 0 {
+		<-f.ctx.Done()
+		return nil, f.ctx.Err()
+	}
+	resp := f.responses[0]
+	f.responses = f.responses[1:]
+	return resp, nil
+}
+
+// withFakeStream sets Agent stubs to fakes which stream the notifications
+// ns in a single response on every notification stream.
+func withFakeStream(a *Agent, ns ...*ndk.Notification) *fakeSdkMgrService {
+	mgr := &fakeSdkMgrService{}
+	a.stubs = &stubs{
+		sdkMgrService: mgr,
+		notificationService: &fakeNotificationService{
+			responses: []*ndk.NotificationStreamResponse{{Notification: ns}},
+		},
+	}
+	return mgr
+}
+
+// newBufConn starts an in-memory gRPC server with the services added by register
+// and returns a client connection to it.
+func newBufConn(t *testing.T, register ...func(srv *grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	for _, r := range register {
+		r(srv)
+	}
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestWithNDKSocket(t *testing.T) {
+	if a := newTestAgent(t); a.ndkSocket != ndkSocket {
+		t.Errorf("default NDK socket = %s, want %s", a.ndkSocket, ndkSocket)
+	}
+	if _, errs := NewAgent("test", WithNDKSocket("")); len(errs) == 0 {
+		t.Errorf("NewAgent() with empty NDK socket returned no errors")
+	}
+
+	sock := filepath.Join(t.TempDir(), "ndk.sock")
+	lis, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", sock, err)
+	}
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	a := newTestAgent(t, WithNDKSocket("unix://"+sock))
+	if err := a.connect(); err != nil {
+		t.Fatalf("connect() returned error: %v", err)
+	}
+	t.Cleanup(func() { a.gRPCConn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.WaitForConnReady(ctx); err != nil {
+		t.Errorf("WaitForConnReady() returned error: %v", err)
+	}
+}
+
+// fakeNdkServer is an in-process NDK server which accepts
+// agent registrations and notification subscriptions.
+// Notification streams send no notifications.
+type fakeNdkServer struct {
+	ndk.UnimplementedSdkMgrServiceServer
+	ndk.UnimplementedSdkNotificationServiceServer
+
+	registrations   atomic.Int32
+	unregistrations atomic.Int32
+	// streams receives a value for every started notification stream.
+	streams chan struct{}
+}
+
+func (f *fakeNdkServer) AgentRegister(context.Context, *ndk.AgentRegistrationRequest) (*ndk.AgentRegistrationResponse, error) {
+	f.registrations.Add(1)
+	return &ndk.AgentRegistrationResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess, AppId: 7}, nil
+}
+
+func (f *fakeNdkServer) AgentUnRegister(context.Context, *ndk.AgentRegistrationRequest) (*ndk.AgentRegistrationResponse, error) {
+	f.unregistrations.Add(1)
+	return &ndk.AgentRegistrationResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeNdkServer) NotificationRegister(_ context.Context, req *ndk.NotificationRegisterRequest) (*ndk.NotificationRegisterResponse, error) {
+	return &ndk.NotificationRegisterResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess, StreamId: 1, SubId: 1}, nil
+}
+
+func (f *fakeNdkServer) NotificationStream(_ *ndk.NotificationStreamRequest, stream ndk.SdkNotificationService_NotificationStreamServer) error {
+	f.streams <- struct{}{}
+	<-stream.Context().Done()
+	return stream.Context().Err()
+}
+
+func TestWithGRPCConn(t *testing.T) {
+	if _, errs := NewAgent("test", WithGRPCConn(nil)); len(errs) == 0 {
+		t.Errorf("NewAgent() with nil connection returned no errors")
+	}
+
+	srv := &fakeNdkServer{streams: make(chan struct{}, 1)}
+	conn := newBufConn(t, func(s *grpc.Server) {
+		ndk.RegisterSdkMgrServiceServer(s, srv)
+		ndk.RegisterSdkNotificationServiceServer(s, srv)
+	})
+	// stop closes the gNMI target, which requires a target created by NewTarget
+	gnmiTarget := target.NewTarget(&types.TargetConfig{})
+	gnmiTarget.Client = &fakeGNMIClient{}
+	a := newTestAgent(t, WithGRPCConn(conn), WithGNMITarget(gnmiTarget))
+
+	if err := a.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if a.gRPCConn != conn {
+		t.Errorf("Start() dialed a new connection, want provided connection")
+	}
+	if got := srv.registrations.Load(); got != 1 || a.AppID != 7 {
+		t.Errorf("agent registered %d times with app id %d, want 1 time with app id 7", got, a.AppID)
+	}
+	// config notifications are streamed over the provided connection
+	select {
+	case <-srv.streams:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config notification stream was not started")
+	}
+
+	a.stop()
+
+	if got := srv.unregistrations.Load(); got != 1 {
+		t.Errorf("agent unregistered %d times, want 1", got)
+	}
+	if state := conn.GetState(); state == connectivity.Shutdown {
+		t.Errorf("stop() closed the provided connection")
+	}
+}
+
+func TestStartGNMITargetFailure(t *testing.T) {
+	srv := &fakeNdkServer{streams: make(chan struct{}, 1)}
+	conn := newBufConn(t, func(s *grpc.Server) {
+		ndk.RegisterSdkMgrServiceServer(s, srv)
+		ndk.RegisterSdkNotificationServiceServer(s, srv)
+	})
+	// the gNMI client dial blocks until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	a := newTestAgent(t, WithContext(ctx, cancel), WithGRPCConn(conn),
+		WithGrpcServerName("bond-test-missing"))
+
+	err := a.Start()
+	if !errors.Is(err, ErrGNMITargetFailed) {
+		t.Fatalf("Start() error = %v, want %v", err, ErrGNMITargetFailed)
+	}
+	if got := srv.registrations.Load(); got != 0 {
+		t.Errorf("agent registered %d times, want 0", got)
+	}
+	if a.started.Load() {
+		t.Errorf("agent is started after failed Start()")
+	}
+}
+
+func TestStartRegisterFailure(t *testing.T) {
+	gnmiTarget := &target.Target{Config: &types.TargetConfig{}, Client: &fakeGNMIClient{}}
+	// nothing listens on the NDK socket, registration fails
+	a := newTestAgent(t, WithNDKSocket("unix://"+filepath.Join(t.TempDir(), "ndk.sock")),
+		WithGNMITarget(gnmiTarget))
+
+	if err := a.Start(); err == nil {
+		t.Fatal("Start() returned no error, want registration error")
+	}
+	if a.gRPCConn != nil || a.stubs != nil {
+		t.Errorf("gRPC connection kept after failed Start()")
+	}
+	if a.GnmiTarget != gnmiTarget {
+		t.Errorf("provided gNMI target dropped after failed Start()")
+	}
+	if a.started.Load() {
+		t.Errorf("agent is started after failed Start()")
+	}
+}
+
+func TestStopNotStarted(t *testing.T) {
+	buf := &syncBuffer{}
+	logger := zerolog.New(buf).Level(zerolog.DebugLevel)
+	a := newTestAgent(t, WithLogger(&logger))
+
+	a.stop()
+
+	if a.ctx.Err() == nil {
+		t.Errorf("stop() did not cancel the agent context")
+	}
+	if !strings.Contains(buf.String(), "skipping unregistration") {
+		t.Errorf("skipped unregistration not logged: %s", buf.String())
+	}
+}
+
+func TestConnState(t *testing.T) {
+	a := newTestAgent(t)
+	if got := a.ConnState(); got != connectivity.Idle {
+		t.Errorf("ConnState() before connect = %s, want %s", got, connectivity.Idle)
+	}
+
+	a.gRPCConn = newBufConn(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.WaitForConnReady(ctx); err != nil {
+		t.Fatalf("WaitForConnReady() returned error: %v", err)
+	}
+	if got := a.ConnState(); got != connectivity.Ready {
+		t.Errorf("ConnState() = %s, want %s", got, connectivity.Ready)
+	}
+}
+
+func TestWaitForConnReady(t *testing.T) {
+	t.Run("Not connected", func(t *testing.T) {
+		a := newTestAgent(t)
+		err := a.WaitForConnReady(context.Background())
+		if !errors.Is(err, ErrNotConnected) {
+			t.Errorf("WaitForConnReady() = %v, want %v", err, ErrNotConnected)
+		}
+	})
+
+	t.Run("Context deadline", func(t *testing.T) {
+		a := newTestAgent(t)
+		conn, err := grpc.Dial("unix:///nonexistent/ndk.sock",
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		a.gRPCConn = conn
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err = a.WaitForConnReady(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("WaitForConnReady() = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestCachingEnabled(t *testing.T) {
+	tests := map[string]struct {
+		opts []Option
+		want bool
+	}{
+		"Default":      {},
+		"With caching": {opts: []Option{WithCaching()}, want: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tt.opts...)
+			if got := a.CachingEnabled(); got != tt.want {
+				t.Errorf("CachingEnabled() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	tests := map[string]struct {
+		resp    *ndk.KeepAliveResponse
+		err     error
+		wantErr bool
+	}{
+		"Success": {
+			resp: &ndk.KeepAliveResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess},
+		},
+		"Failed status": {
+			resp:    &ndk.KeepAliveResponse{Status: ndk.SdkMgrStatus_kSdkMgrFailed},
+			wantErr: true,
+		},
+		"RPC error": {
+			err:     errors.New("connection refused"),
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			a.stubs = &stubs{
+				sdkMgrService: &fakeSdkMgrService{keepAliveResp: tt.resp, keepAliveErr: tt.err},
+			}
+
+			err := a.Ping()
+			if tt.wantErr && !errors.Is(err, ErrKeepAliveFailed) {
+				t.Errorf("Ping() = %v, want %v", err, ErrKeepAliveFailed)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Ping() returned unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPingNotConnected(t *testing.T) {
+	a := newTestAgent(t)
+	if err := a.Ping(); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Ping() = %v, want %v", err, ErrNotConnected)
+	}
+}
+
+func TestStartTwice(t *testing.T) {
+	a := newTestAgent(t)
+	mgr := &fakeSdkMgrService{}
+	a.stubs = &stubs{sdkMgrService: mgr}
+	// first Start is in progress or done
+	a.started.Store(true)
+
+	if err := a.Start(); !errors.Is(err, ErrAlreadyStarted) {
+		t.Errorf("second Start() error = %v, want %v", err, ErrAlreadyStarted)
+	}
+	if mgr.registrations != 0 {
+		t.Errorf("second Start() registered agent %d times, want 0", mgr.registrations)
+	}
+	if a.gRPCConn != nil {
+		t.Errorf("second Start() connected to NDK socket")
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	a := newTestAgent(t)
+	mgr := &fakeSdkMgrService{appId: 7}
+	a.stubs = &stubs{sdkMgrService: mgr}
+
+	if err := a.register(); err != nil {
+		t.Fatalf("register() returned error: %v", err)
+	}
+	if err := a.register(); !errors.Is(err, ErrAlreadyRegistered) {
+		t.Errorf("second register() error = %v, want %v", err, ErrAlreadyRegistered)
+	}
+	if mgr.registrations != 1 {
+		t.Errorf("agent registered %d times, want 1", mgr.registrations)
+	}
+}
+
+func TestRegisterFailures(t *testing.T) {
+	errUnavailable := errors.New("connection refused")
+
+	tests := map[string]struct {
+		errStr  string
+		rpcErr  error
+		wantErr error
+	}{
+		"Failed status": {
+			errStr:  "out of resources",
+			wantErr: ErrRegistrationFailed,
+		},
+		"RPC error": {
+			rpcErr:  errUnavailable,
+			wantErr: errUnavailable,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			mgr := &fakeSdkMgrService{
+				agentRegisterErr: tc.rpcErr,
+				agentRegisterResps: []*ndk.AgentRegistrationResponse{
+					{Status: ndk.SdkMgrStatus_kSdkMgrFailed, ErrorStr: tc.errStr},
+				},
+			}
+			a.stubs = &stubs{sdkMgrService: mgr}
+
+			err := a.register()
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("register() error = %v, want %v", err, tc.wantErr)
+			}
+			if !errors.Is(err, ErrRegistrationFailed) {
+				t.Errorf("register() error = %v, want %v", err, ErrRegistrationFailed)
+			}
+			if tc.errStr != "" && !strings.Contains(err.Error(), tc.errStr) {
+				t.Errorf("register() error = %v, want error text %q", err, tc.errStr)
+			}
+			if a.registered.Load() {
+				t.Errorf("agent marked registered after failed registration")
+			}
+		})
+	}
+}
+
+func TestForceReregister(t *testing.T) {
+	failed := &ndk.AgentRegistrationResponse{Status: ndk.SdkMgrStatus_kSdkMgrFailed}
+	errUnavailable := errors.New("connection refused")
+
+	tests := map[string]struct {
+		opts           []Option
+		rpcErr         error
+		unregisterResp *ndk.AgentRegistrationResponse
+		wantErr        error
+		wantCalls      []string
+	}{
+		"Failure then success": {
+			opts:      []Option{WithForceReregister()},
+			wantCalls: []string{"register", "unregister", "register"},
+		},
+		"Without option": {
+			wantErr:   ErrRegistrationFailed,
+			wantCalls: []string{"register"},
+		},
+		"Unregister failure": {
+			opts:           []Option{WithForceReregister()},
+			unregisterResp: &ndk.AgentRegistrationResponse{Status: ndk.SdkMgrStatus_kSdkMgrFailed},
+			wantErr:        ErrUnregistrationFailed,
+			wantCalls:      []string{"register", "unregister"},
+		},
+		"Transport error": {
+			opts:      []Option{WithForceReregister()},
+			rpcErr:    errUnavailable,
+			wantErr:   errUnavailable,
+			wantCalls: []string{"register"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tc.opts...)
+			mgr := &fakeSdkMgrService{
+				appId:              7,
+				agentRegisterResps: []*ndk.AgentRegistrationResponse{failed},
+				agentRegisterErr:   tc.rpcErr,
+				unregisterResp:     tc.unregisterResp,
+			}
+			a.stubs = &stubs{sdkMgrService: mgr}
+
+			err := a.register()
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("register() error = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(mgr.calls, tc.wantCalls) {
+				t.Errorf("NDK mgr calls = %v, want %v", mgr.calls, tc.wantCalls)
+			}
+			if registered := a.registered.Load(); registered != (tc.wantErr == nil) {
+				t.Errorf("agent registered = %t, want %t", registered, tc.wantErr == nil)
+			}
+			if tc.wantErr == nil && a.AppID != 7 {
+				t.Errorf("AppID = %d, want 7", a.AppID)
+			}
+		})
+	}
+}
+
+// slowRouteService is a fakeRouteService
+// whose RouteAddOrUpdate blocks until release is closed.
+type slowRouteService struct {
+	fakeRouteService
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *slowRouteService) RouteAddOrUpdate(ctx context.Context, req *ndk.RouteAddRequest, opts ...grpc.CallOption) (*ndk.RouteAddResponse, error) {
+	close(f.started)
+	<-f.release
+	return f.fakeRouteService.RouteAddOrUpdate(ctx, req, opts...)
+}
+
+func TestStopWaitsForInFlightRPCs(t *testing.T) {
+	tests := map[string]struct {
+		shutdownTimeout time.Duration
+		rpcDuration     time.Duration
+		wantProgrammed  bool
+	}{
+		"RPC completes": {
+			shutdownTimeout: 5 * time.Second,
+			rpcDuration:     50 * time.Millisecond,
+			wantProgrammed:  true,
+		},
+		"Shutdown timeout": {
+			shutdownTimeout: 20 * time.Millisecond,
+			rpcDuration:     5 * time.Second,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, WithShutdownTimeout(tc.shutdownTimeout))
+			routeService := &slowRouteService{
+				started: make(chan struct{}),
+				release: make(chan struct{}),
+			}
+			a.stubs = &stubs{sdkMgrService: &fakeSdkMgrService{}, routeService: routeService}
+			a.gRPCConn = newBufConn(t)
+			a.GnmiTarget = target.NewTarget(&types.TargetConfig{})
+
+			route := NewRoute(
+				WithNetInstName("default"),
+				WithIpPrefix("10.0.0.0/24"),
+				WithNextHopGroupName("ndk_sdk"),
+			)
+			errCh := make(chan error, 1)
+			go func() { errCh <- a.RouteAdd(route) }()
+			<-routeService.started
+
+			release := time.AfterFunc(tc.rpcDuration, func() { close(routeService.release) })
+			defer func() {
+				// unblock the RPC if stop did not wait for it
+				if release.Stop() {
+					close(routeService.release)
+				}
+				<-errCh
+			}()
+
+			start := time.Now()
+			a.stop()
+
+			if d := time.Since(start); d > tc.rpcDuration+time.Second {
+				t.Errorf("stop() took %s", d)
+			}
+			_, programmed := a.routes.get(routeKey("default", route.GetKey().GetIpPrefix()))
+			if programmed != tc.wantProgrammed {
+				t.Errorf("route programmed before stop() returned = %t, want %t", programmed, tc.wantProgrammed)
+			}
+			if got := a.gRPCConn.GetState(); got != connectivity.Shutdown {
+				t.Errorf("gRPC connection state after stop() = %s, want %s", got, connectivity.Shutdown)
+			}
+		})
+	}
+}
+
+func TestRPCAfterStop(t *testing.T) {
+	a := newTestAgent(t)
+	routeService := &fakeRouteService{}
+	a.stubs = &stubs{sdkMgrService: &fakeSdkMgrService{}, routeService: routeService}
+	a.gRPCConn = newBufConn(t)
+	a.GnmiTarget = target.NewTarget(&types.TargetConfig{})
+
+	a.stop()
+
+	route := NewRoute(
+		WithNetInstName("default"),
+		WithIpPrefix("10.0.0.0/24"),
+		WithNextHopGroupName("ndk_sdk"),
+	)
+	if err := a.RouteAdd(route); !errors.Is(err, ErrAgentStopping) {
+		t.Errorf("RouteAdd() after stop() = %v, want %v", err, ErrAgentStopping)
+	}
+	if len(routeService.addReqs) != 0 {
+		t.Errorf("got %d RouteAddOrUpdate requests after stop(), want 0", len(routeService.addReqs))
+	}
+}
+
+func TestStopWaitsForConfigNotifications(t *testing.T) {
+	a := newTestAgent(t)
+	withFakeStream(a)
+	a.gRPCConn = newBufConn(t)
+	a.GnmiTarget = target.NewTarget(&types.TargetConfig{})
+
+	a.startConfigNotifications(a.ctx)
+	waitForSubscription(t, a, NotificationTypeConfig)
+	a.stop()
+
+	select {
+	case <-a.configDone:
+	default:
+		t.Error("config notification goroutine running after stop() returned")
+	}
+}
+
+func TestLoggerAgentFields(t *testing.T) {
+	buf := &syncBuffer{}
+	logger := zerolog.New(buf)
+	a := newTestAgent(t, WithLogger(&logger), WithAppID(5))
+	a.stubs = &stubs{sdkMgrService: &fakeSdkMgrService{appId: 7}}
+
+	// fields are attached to log messages
+	// before and after the app id is assigned on registration
+	agentLogger := a.logger
+	a.logger.Info().Msg("before registration")
+	if err := a.register(); err != nil {
+		t.Fatalf("register() returned error: %v", err)
+	}
+	a.logger.Info().Msg("after registration")
+	if err := a.unregister(); err != nil {
+		t.Fatalf("unregister() returned error: %v", err)
+	}
+	if a.logger != agentLogger {
+		t.Error("logger replaced on registration")
+	}
+
+	lines := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if n := strings.Count(line, `"app_id"`); n != 1 {
+			t.Errorf("log line %q has %d app_id fields, want 1", line, n)
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to parse log line %q: %v", line, err)
+		}
+		if msg, ok := entry["message"].(string); ok {
+			lines[msg] = entry
+		}
+	}
+
+	wantAppID := map[string]float64{
+		"before registration":                    5,
+		"after registration":                     7,
+		"Application unregistered successfully!": 7,
+	}
+	for msg, appID := range wantAppID {
+		entry, ok := lines[msg]
+		if !ok {
+			t.Fatalf("log message %q not found in %s", msg, buf.String())
+		}
+		if entry["agent"] != "test" {
+			t.Errorf("log message %q agent = %v, want test", msg, entry["agent"])
+		}
+		if entry["app_id"] != appID {
+			t.Errorf("log message %q app_id = %v, want %v", msg, entry["app_id"], appID)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
 // ReceiveAppIdNotifications starts an AppId notification stream
@@ -12,66 +11,60 @@ import (
 // If the main execution intends to continue running after calling this method,
 // it should be called as a goroutine.
 // `AppId` chan carries values of type ndk.AppIdentNotification
+// Received notifications are also stored in the AppId cache,
+// which can be queried with SelfAppIdent.
 func (a *Agent) ReceiveAppIdNotifications(ctx context.Context) {
+	if !a.startReceiving(NotificationTypeAppId) {
+		return
+	}
 	defer close(a.Notifications.AppId)
-	AppIdStream := a.startAppIdNotificationStream(ctx)
-
-	for AppIdStreamResp := range AppIdStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(AppIdStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("AppId notification Marshal failed: %+v", err)
-			continue
-		}
 
-		a.logger.Info().
-			Msgf("Received AppId notifications:\n%s", b)
-
-		for _, n := range AppIdStreamResp.GetNotification() {
-			AppIdNotif := n.GetAppid()
-			if AppIdNotif == nil {
-				a.logger.Info().
-					Msgf("Empty AppId notification:%+v", n)
-				continue
+	subscribe(ctx, a, NotificationTypeAppId,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_Appid{
+				Appid: &ndk.AppIdentSubscriptionRequest{},
 			}
-			a.Notifications.AppId <- AppIdNotif
-		}
-	}
+		},
+		(*ndk.Notification).GetAppid,
+		func(n *ndk.AppIdentNotification) {
+			a.cacheAppIdent(n)
+			sendNotification(ctx, a, NotificationTypeAppId, a.Notifications.AppId, n)
+		})
 }
 
-// startAppIdNotificationStream starts a notification stream for AppId service notifications.
-func (a *Agent) startAppIdNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
-
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("AppId Notification stream created")
-
-	a.addAppIdSubscription(ctx, streamID)
-
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"AppId", streamChan)
-
-	return streamChan
+// cacheAppIdent stores the AppId notification n in the AppId cache keyed by app name.
+// Delete notifications evict the cached entry with the same app id.
+func (a *Agent) cacheAppIdent(n *ndk.AppIdentNotification) {
+	if n.GetOp() == ndk.SdkMgrOperation_Delete {
+		id := n.GetKey().GetId()
+		a.appIdents.deleteFunc(func(c *ndk.AppIdentNotification) bool {
+			return c.GetKey().GetId() == id
+		})
+		return
+	}
+	if n.GetData().GetName() == "" {
+		return
+	}
+	a.appIdents.set(n.GetData().GetName(), n)
 }
 
-// addAppIdSubscription adds a subscription for AppId service notifications
-// to the allocated notification stream.
-func (a *Agent) addAppIdSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for AppId service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
-		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_Appid{ // AppId service
-			Appid: &ndk.AppIdentSubscriptionRequest{},
-		},
+// SelfAppIdent returns the AppId notification of this Agent,
+// looked up by the Agent's name in the AppId cache.
+// The cache is populated by ReceiveAppIdNotifications.
+// Apps can use this to confirm that SR Linux sees the app correctly
+// (e.g. it is connected and reports the expected version).
+// false is returned if no AppId notification was received for the Agent.
+func (a *Agent) SelfAppIdent() (*ndk.AppIdentNotification, bool) {
+	n, ok := a.appIdents.get(a.Name)
+	if !ok {
+		return nil, false
 	}
+	return cloneProto(n), true
+}
 
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
-	}
+// AppIdentSnapshot returns a copy of all cached AppId notifications keyed by app name.
+// The cache is populated by ReceiveAppIdNotifications.
+// It is safe to call while notifications are being received.
+func (a *Agent) AppIdentSnapshot() map[string]*ndk.AppIdentNotification {
+	return a.appIdents.snapshot(cloneProto[*ndk.AppIdentNotification])
 }
@@ -0,0 +1,78 @@
+package bond
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func appIdentNotification(op ndk.SdkMgrOperation, id uint32, name string) *ndk.Notification {
+	return &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_Appid{
+			Appid: &ndk.AppIdentNotification{
+				Op:   op,
+				Key:  &ndk.AppIdentKey{Id: id},
+				Data: &ndk.AppIdentData{Name: name, IsConnected: true},
+			},
+		},
+	}
+}
+
+func TestSelfAppIdent(t *testing.T) {
+	tests := map[string]struct {
+		notifications []*ndk.Notification
+		wantFound     bool
+		wantId        uint32
+	}{
+		"Own app ident": {
+			notifications: []*ndk.Notification{
+				appIdentNotification(ndk.SdkMgrOperation_Create, 10, "other"),
+				appIdentNotification(ndk.SdkMgrOperation_Create, 11, "test"),
+			},
+			wantFound: true,
+			wantId:    11,
+		},
+		"Only other apps": {
+			notifications: []*ndk.Notification{
+				appIdentNotification(ndk.SdkMgrOperation_Create, 10, "other"),
+			},
+		},
+		"Own app ident deleted": {
+			notifications: []*ndk.Notification{
+				appIdentNotification(ndk.SdkMgrOperation_Create, 11, "test"),
+				{
+					SubscriptionTypes: &ndk.Notification_Appid{
+						Appid: &ndk.AppIdentNotification{
+							Op:  ndk.SdkMgrOperation_Delete,
+							Key: &ndk.AppIdentKey{Id: 11},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			withFakeStream(a, tt.notifications...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.ReceiveAppIdNotifications(ctx)
+
+			for range tt.notifications {
+				<-a.Notifications.AppId
+			}
+
+			n, ok := a.SelfAppIdent()
+			if ok != tt.wantFound {
+				t.Fatalf("SelfAppIdent() found = %t, want %t", ok, tt.wantFound)
+			}
+			if ok && n.GetKey().GetId() != tt.wantId {
+				t.Errorf("SelfAppIdent() id = %d, want %d", n.GetKey().GetId(), tt.wantId)
+			}
+		})
+	}
+}
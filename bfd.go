@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
 // ReceiveBfdNotifications starts an Bfd Session notification
@@ -12,67 +11,82 @@ import (
 // If the main execution intends to continue running after calling this method,
 // it should be called as a goroutine.
 // `Bfd` chan carries values of type ndk.BfdSessionNotification
+// If Agent is created with option WithTypedNotifications,
+// every notification is also sent to channel `BfdSession`
+// after it was sent to `Bfd`, so both chans must be read.
+// `BfdSession` carries values of type BfdSessionNotification.
 func (a *Agent) ReceiveBfdNotifications(ctx context.Context) {
+	if !a.startReceiving(NotificationTypeBfdSession) {
+		return
+	}
 	defer close(a.Notifications.Bfd)
-	BfdStream := a.startBfdNotificationStream(ctx)
-
-	for BfdStreamResp := range BfdStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(BfdStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("Bfd Session notification Marshal failed: %+v", err)
-			continue
-		}
+	defer close(a.Notifications.BfdSession)
 
-		a.logger.Info().
-			Msgf("Received Bfd Session notifications:\n%s", b)
-
-		for _, n := range BfdStreamResp.GetNotification() {
-			BfdNotif := n.GetBfdSession()
-			if BfdNotif == nil {
-				a.logger.Info().
-					Msgf("Empty Bfd Session notification:%+v", n)
-				continue
+	subscribe(ctx, a, NotificationTypeBfdSession,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_BfdSession{
+				BfdSession: &ndk.BfdSessionSubscriptionRequest{},
 			}
-			a.Notifications.Bfd <- BfdNotif
-		}
-	}
+		},
+		(*ndk.Notification).GetBfdSession,
+		func(n *ndk.BfdSessionNotification) {
+			if !sendNotification(ctx, a, NotificationTypeBfdSession, a.Notifications.Bfd, n) {
+				return
+			}
+			if a.typedNotifications {
+				deliverNotification(ctx, a, NotificationTypeBfdSession, a.Notifications.BfdSession, ParseBfdSessionNotification(n))
+			}
+		})
 }
 
-// startBfdNotificationStream starts a notification stream
-// for Bfd Session service notifications.
-func (a *Agent) startBfdNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
-
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("Bfd Session notification stream created")
-
-	a.addBfdSubscription(ctx, streamID)
-
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"bfdSession", streamChan)
+// BfdSessionNotification type defines the contents of a streamed BFD session notification.
+// Possible Op values are Create, Update, Delete or CreateOrUpdate
+// depending on whether caching is enabled with WithCaching.
+// Type is the session type, e.g. SESSION_TYPE_P2P.
+// State is the session status, e.g. UP or DOWN, apps can use it to drive failover.
+// SrcAddr, DstAddr and InstanceId are only set for P2P sessions,
+// Interface is only set for micro BFD sessions.
+// NDK does not expose session discriminators or timer intervals,
+// SpecifiedDiscr only reports if the P2P session uses a specified discriminator.
+// Raw is the NDK notification the BfdSessionNotification was parsed from.
+type BfdSessionNotification struct {
+	Op             string // NDK operation
+	Type           string // Session type
+	SubType        string // Session subtype, e.g. SESSION_SUB_TYPE_SINGLE_HOP
+	State          string // Session status
+	SrcAddr        string // Source IP address
+	DstAddr        string // Destination IP address
+	InstanceId     uint32 // Network instance identifier
+	SpecifiedDiscr bool   // P2P session uses a specified discriminator
+	Interface      string // Interface name of micro BFD sessions
+	SrcIfId        uint32 // Source interface identifier of P2P sessions
+	Raw            *ndk.BfdSessionNotification
+}
 
-	return streamChan
+// Up returns true if the BFD session is up.
+func (b *BfdSessionNotification) Up() bool {
+	return b.State == ndk.BfdmgrSessionStatus_UP.String()
 }
 
-// addBfdSubscription adds a subscription for Bfd Session service
-// notifications to the allocated notification stream.
-func (a *Agent) addBfdSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for Bfd service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
-		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_BfdSession{ // Bfd service
-			BfdSession: &ndk.BfdSessionSubscriptionRequest{},
-		},
+// ParseBfdSessionNotification parses an NDK BFD session notification
+// and returns its contents as BfdSessionNotification.
+// nil is returned if n is nil.
+func ParseBfdSessionNotification(n *ndk.BfdSessionNotification) *BfdSessionNotification {
+	if n == nil {
+		return nil
 	}
-
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
+	p2p := n.GetKey().GetP2P()
+	return &BfdSessionNotification{
+		Op:             n.GetOp().String(),
+		Type:           n.GetKey().GetType().String(),
+		SubType:        n.GetData().GetSubType().String(),
+		State:          n.GetData().GetStatus().String(),
+		SrcAddr:        formatAddr(p2p.GetSrcIpAddr()),
+		DstAddr:        formatAddr(p2p.GetDstIpAddr()),
+		InstanceId:     p2p.GetInstanceId(),
+		SpecifiedDiscr: p2p.GetSpecifiedDiscr(),
+		Interface:      n.GetKey().GetMicrobfd().GetInterfaceName(),
+		SrcIfId:        n.GetData().GetSrcIfId(),
+		Raw:            n,
 	}
 }
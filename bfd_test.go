@@ -0,0 +1,132 @@
+package bond
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func p2pBfdSession(status ndk.BfdmgrSessionStatus) *ndk.BfdSessionNotification {
+	return &ndk.BfdSessionNotification{
+		Op: ndk.SdkMgrOperation_Create,
+		Key: &ndk.BfdmgrGeneralSessionKeyPb{
+			Type: ndk.BfdmgrSessionType_SESSION_TYPE_P2P,
+			Key: &ndk.BfdmgrGeneralSessionKeyPb_P2P{
+				P2P: &ndk.BfdmgrGeneralSessionKeyPb_P2PKey{
+					SrcIpAddr:      &ndk.IpAddressPb{Addr: net.ParseIP("192.168.1.1").To4()},
+					DstIpAddr:      &ndk.IpAddressPb{Addr: net.ParseIP("192.168.1.2").To4()},
+					InstanceId:     3,
+					SpecifiedDiscr: true,
+				},
+			},
+		},
+		Data: &ndk.BfdmgrGeneralSessionDataPb{
+			Status:  status,
+			SubType: ndk.BfdmgrGeneralSessionDataPb_SESSION_SUB_TYPE_SINGLE_HOP,
+			SrcIfId: 7,
+		},
+	}
+}
+
+func TestParseBfdSessionNotification(t *testing.T) {
+	microBfd := &ndk.BfdSessionNotification{
+		Op: ndk.SdkMgrOperation_Delete,
+		Key: &ndk.BfdmgrGeneralSessionKeyPb{
+			Type: ndk.BfdmgrSessionType_SESSION_TYPE_MICROBFD,
+			Key: &ndk.BfdmgrGeneralSessionKeyPb_Microbfd{
+				Microbfd: &ndk.BfdmgrGeneralSessionKeyPb_MicrobfdKey{InterfaceName: "ethernet-1/1"},
+			},
+		},
+		Data: &ndk.BfdmgrGeneralSessionDataPb{
+			Status:  ndk.BfdmgrSessionStatus_DOWN,
+			SubType: ndk.BfdmgrGeneralSessionDataPb_SESSION_SUB_TYPE_MICROBFD,
+		},
+	}
+
+	tests := map[string]struct {
+		input    *ndk.BfdSessionNotification
+		expected *BfdSessionNotification
+		wantUp   bool
+	}{
+		"P2P session up": {
+			input: p2pBfdSession(ndk.BfdmgrSessionStatus_UP),
+			expected: &BfdSessionNotification{
+				Op:             "Create",
+				Type:           "SESSION_TYPE_P2P",
+				SubType:        "SESSION_SUB_TYPE_SINGLE_HOP",
+				State:          "UP",
+				SrcAddr:        "192.168.1.1",
+				DstAddr:        "192.168.1.2",
+				InstanceId:     3,
+				SpecifiedDiscr: true,
+				SrcIfId:        7,
+			},
+			wantUp: true,
+		},
+		"Micro BFD session down": {
+			input: microBfd,
+			expected: &BfdSessionNotification{
+				Op:        "Delete",
+				Type:      "SESSION_TYPE_MICROBFD",
+				SubType:   "SESSION_SUB_TYPE_MICROBFD",
+				State:     "DOWN",
+				Interface: "ethernet-1/1",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := ParseBfdSessionNotification(tt.input)
+			if result.Raw != tt.input {
+				t.Errorf("ParseBfdSessionNotification() Raw is not the parsed notification")
+			}
+			result.Raw = nil
+			if *result != *tt.expected {
+				t.Errorf("ParseBfdSessionNotification() = %+v, want %+v", result, tt.expected)
+			}
+			if result.Up() != tt.wantUp {
+				t.Errorf("Up() = %t, want %t", result.Up(), tt.wantUp)
+			}
+		})
+	}
+
+	if ParseBfdSessionNotification(nil) != nil {
+		t.Errorf("ParseBfdSessionNotification(nil) is not nil")
+	}
+}
+
+func TestReceiveTypedBfdNotifications(t *testing.T) {
+	a := newTestAgent(t, WithTypedNotifications())
+	sessions := []*ndk.BfdSessionNotification{
+		p2pBfdSession(ndk.BfdmgrSessionStatus_UP),
+		p2pBfdSession(ndk.BfdmgrSessionStatus_DOWN),
+	}
+	var ns []*ndk.Notification
+	for _, s := range sessions {
+		ns = append(ns, &ndk.Notification{
+			SubscriptionTypes: &ndk.Notification_BfdSession{BfdSession: s},
+		})
+	}
+	withFakeStream(a, ns...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveBfdNotifications(ctx)
+
+	for i, want := range []bool{true, false} {
+		// notifications are sent to the raw chan first
+		if raw := <-a.Notifications.Bfd; raw != sessions[i] {
+			t.Errorf("session %d raw notification is not the streamed notification", i)
+		}
+		n := <-a.Notifications.BfdSession
+		if n.Up() != want {
+			t.Errorf("session %d Up() = %t, want %t", i, n.Up(), want)
+		}
+		if n.Raw != sessions[i] {
+			t.Errorf("session %d Raw is not the streamed notification", i)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+// fakeClock is a clock whose time only advances when Sleep is called.
+// Tickers and timers created by fakeClock fire when tick is called.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+	ticks  chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ticks: make(chan time.Time),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep records d and advances the clock by d without blocking.
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) NewTicker(time.Duration) ticker {
+	return fakeTicker{c: c.ticks}
+}
+
+// After returns a channel that fires when tick is called.
+func (c *fakeClock) After(time.Duration) <-chan time.Time {
+	return c.ticks
+}
+
+// tick fires all tickers created by the clock.
+// It blocks until the tick is received.
+func (c *fakeClock) tick() {
+	c.ticks <- c.Now()
+}
+
+// slept returns the recorded Sleep durations.
+func (c *fakeClock) slept() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration{}, c.sleeps...)
+}
+
+type fakeTicker struct {
+	c chan time.Time
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t fakeTicker) Stop() {}
+
+func TestCreateNotificationStreamRetries(t *testing.T) {
+	tests := map[string]struct {
+		mgr *fakeSdkMgrService
+		// retries is the number of retries before the stream is created.
+		retries int
+	}{
+		"Register failures": {
+			mgr:     &fakeSdkMgrService{registerFailures: 3},
+			retries: 3,
+		},
+		"Zero stream ID": {
+			mgr:     &fakeSdkMgrService{zeroStreamIDs: 1},
+			retries: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clk := newFakeClock()
+			a := newTestAgent(t, withClock(clk))
+			a.stubs = &stubs{sdkMgrService: tc.mgr}
+
+			type result struct {
+				streamID uint64
+				err      error
+			}
+			done := make(chan result)
+			go func() {
+				streamID, err := a.createNotificationStream(context.Background())
+				done <- result{streamID, err}
+			}()
+			// every retry waits for the retry timeout
+			for i := 0; i < tc.retries; i++ {
+				clk.tick()
+			}
+
+			res := <-done
+			if res.err != nil || res.streamID != 1 {
+				t.Errorf("createNotificationStream() = %d, %v, want 1", res.streamID, res.err)
+			}
+			if got := len(tc.mgr.registerRequests()); got != tc.retries+1 {
+				t.Errorf("NotificationRegister called %d times, want %d", got, tc.retries+1)
+			}
+		})
+	}
+}
+
+func TestCreateNotificationStreamCancel(t *testing.T) {
+	a := newTestAgent(t, withClock(newFakeClock()))
+	a.stubs = &stubs{sdkMgrService: &fakeSdkMgrService{registerFailures: 1}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.createNotificationStream(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("createNotificationStream() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestKeepAliveThreshold(t *testing.T) {
+	clk := newFakeClock()
+	a := newTestAgent(t, withClock(clk), WithKeepAlive(time.Minute, 2))
+	a.stubs = &stubs{
+		sdkMgrService: &fakeSdkMgrService{
+			keepAliveResp: &ndk.KeepAliveResponse{Status: ndk.SdkMgrStatus_kSdkMgrFailed},
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.keepAlive(context.Background(), time.Minute, 2)
+		close(done)
+	}()
+
+	clk.tick()
+	clk.tick()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("keepAlive did not stop after reaching the failure threshold")
+	}
+}
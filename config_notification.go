@@ -3,15 +3,20 @@ package bond
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"time"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
 const (
 	commitEndKeyPath = ".commit.end"
 )
 
+// An error is returned if Agent waits for streamed configs
+// without WithStreamConfig option enabled.
+var ErrStreamCfgOptionNotSet = errors.New("agent is not registered with WithStreamConfig option")
+
 // ConfigNotification type defines streamed notification contents.
 // Possible Path targets are the app's
 // root YANG container or any list entries.
@@ -26,85 +31,72 @@ const (
 // would have an Op Delete.
 // Json contains leaf, leaf-list, or child container
 // configs for the target Path.
+// CommitSeq is the commit sequence number parsed from the Json
+// of the .commit.end notification, apps can use it to sequence commits.
 type ConfigNotification struct {
 	Op              string   // NDK config operation
 	Path            string   // YANG path that follows XPath format
 	PathWithoutKeys string   // YANG path without list keys
 	Keys            []string // Value for keys, only returned for YANG list configs
 	Json            string   // Entire configuration fragment as JSON string
+	CommitSeq       int      // Commit sequence, only set for .commit.end notifications
 }
 
 // receiveConfigNotifications receives a stream of configuration notifications
 // buffer them in the configuration buffer and populates ConfigState struct of the App
 // once the whole committed config is received.
+// If commit debouncing is enabled with WithCommitDebounce,
+// the full config is fetched once the debounce window
+// after the last received commit.end notification expires.
 func (a *Agent) receiveConfigNotifications(ctx context.Context) {
-	configStream := a.startConfigNotificationStream(ctx)
+	// config notifications are handled per stream response,
+	// as config is only processed once a whole commit is received
+	configStream := a.startSubscriptionStream(ctx, NotificationTypeConfig,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_Config{
+				Config: &ndk.ConfigSubscriptionRequest{},
+			}
+		})
+
+	// debounce fires when the debounce window of a deferred commit expires
+	var debounce <-chan time.Time
+	for {
+		select {
+		case cfgStreamResp, ok := <-configStream:
+			if !ok {
+				return
+			}
+			a.logNotificationResponse(NotificationTypeConfig, cfgStreamResp)
 
-	for cfgStreamResp := range configStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(cfgStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("Config notification Marshal failed: %+v", err)
-			continue
+			if a.handleConfigNotifications(ctx, cfgStreamResp) {
+				// restart the debounce window on every deferred commit
+				debounce = a.clock.After(a.commitDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			a.fetchFullConfig()
 		}
-
-		a.logger.Info().
-			Msgf("Received Config notifications:\n%s", b)
-
-		a.handleConfigNotifications(cfgStreamResp)
-	}
-}
-
-// startConfigNotificationStream starts a notification stream for Config service notifications.
-func (a *Agent) startConfigNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
-
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("Config notification stream created")
-
-	a.addConfigSubscription(ctx, streamID)
-
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"config", streamChan)
-
-	return streamChan
-}
-
-// addConfigSubscription adds a subscription for Config service notifications
-// to the allocated notification stream.
-func (a *Agent) addConfigSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for Config service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
-		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_Config{ // config service
-			Config: &ndk.ConfigSubscriptionRequest{},
-		},
-	}
-
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
 	}
 }
 
 // handleConfigNotifications logs configuration notifications received
 // from the config notification stream and signals the
 // FullConfigReceived chan when the full config is received.
-func (a *Agent) handleConfigNotifications(
+// If commit debouncing is enabled, the full config is not fetched
+// and true is returned when a commit.end notification is received.
+// Streamed configs are dropped if ctx is done while sending them to chan Config.
+func (a *Agent) handleConfigNotifications(ctx context.Context,
 	notifStreamResp *ndk.NotificationStreamResponse,
-) {
+) (commitDeferred bool) {
 	notifs := notifStreamResp.GetNotification()
 
 	for _, n := range notifs {
+		a.notificationReceived(NotificationTypeConfig)
 		cfgNotif := n.GetConfig()
 		if cfgNotif == nil {
 			a.logger.Info().
 				Msgf("Empty configuration notification:%+v", n)
+			a.emptyNotification(NotificationTypeConfig)
 			continue
 		}
 
@@ -123,22 +115,119 @@ func (a *Agent) handleConfigNotifications(
 		}
 
 		// commit.end notification is received and it is not a zero commit sequence
-		// this means that the full config is received and we can process it
+		// this means that the full config is received and we can process it.
+		// zero commit sequences are processed if empty configs are notified
 		if !a.streamConfig {
 			if cfgNotif.Key.JsPath == commitEndKeyPath &&
-				!a.isCommitSeqZero(cfgNotif.GetData().GetJson()) {
+				(a.emptyConfigNotif || !a.isCommitSeqZero(cfgNotif.GetData().GetJson())) {
 				a.logger.Debug().
 					Msgf("Received commit end notification: %+v", cfgNotif)
+				commitEnd := cfgNotif.GetData().GetJson()
+				a.lastCommitEnd.Store(&commitEnd)
+				a.commitSeq.Store(int64(ParseConfigNotification(cfgNotif).CommitSeq))
 
-				a.getConfigWithGNMI()
+				if a.commitDebounce > 0 {
+					commitDeferred = true
+					continue
+				}
 
-				a.Notifications.FullConfigReceived <- struct{}{}
+				a.fetchFullConfig()
 			}
 		} else { // stream configs individually
-			a.Notifications.Config <- parseConfig(cfgNotif)
+			cfg := ParseConfigNotification(cfgNotif)
+			if cfg.Path == commitEndKeyPath {
+				a.commitSeq.Store(int64(cfg.CommitSeq))
+			}
+			a.notifyConfigWaiters(cfg)
+			if !sendNotification(ctx, a, NotificationTypeConfig, a.Notifications.Config, cfg) {
+				return commitDeferred
+			}
 		}
 
 	}
+
+	return commitDeferred
+}
+
+// fetchFullConfig retrieves the app's full config with gNMI
+// and signals the FullConfigReceived chan.
+func (a *Agent) fetchFullConfig() {
+	a.logger.Debug().
+		Str("commit-end", a.LastCommitEnd()).
+		Msg("Fetching full config")
+
+	a.getConfigWithGNMI()
+
+	a.Notifications.FullConfigReceived <- struct{}{}
+}
+
+// LastCommitEnd returns the json of the last .commit.end notification
+// that triggered a full config fetch, e.g. {"commit_seq": 3}.
+// Apps can log it to trace which commit FullConfig belongs to.
+// With WithCommitDebounce, it is the last commit of the debounce window.
+// An empty string is returned if no full config was fetched yet
+// or Agent has option WithStreamConfig set.
+func (a *Agent) LastCommitEnd() string {
+	if commitEnd := a.lastCommitEnd.Load(); commitEnd != nil {
+		return *commitEnd
+	}
+	return ""
+}
+
+// configWaiter waits for a created or updated config of path.
+type configWaiter struct {
+	path string
+	// ch receives a single matching config notification.
+	ch chan *ConfigNotification
+}
+
+// WaitForConfigPath blocks until a Create, Update or CreateOrUpdate
+// config notification for xpath is streamed and returns it.
+// xpath is in XPath format, e.g. /greeter/list-node[name=entry1],
+// and must match the notification Path exactly.
+// Only notifications streamed after the call are considered.
+// Streamed notifications are still sent to chan Config.
+// An error is returned if ctx is done before the config appears
+// or if Agent does not have option WithStreamConfig set.
+func (a *Agent) WaitForConfigPath(ctx context.Context, xpath string) (ConfigNotification, error) {
+	if !a.streamConfig {
+		return ConfigNotification{}, ErrStreamCfgOptionNotSet
+	}
+
+	w := &configWaiter{path: xpath, ch: make(chan *ConfigNotification, 1)}
+	a.cfgWaitersMu.Lock()
+	if a.cfgWaiters == nil {
+		a.cfgWaiters = make(map[*configWaiter]struct{})
+	}
+	a.cfgWaiters[w] = struct{}{}
+	a.cfgWaitersMu.Unlock()
+
+	select {
+	case cfg := <-w.ch:
+		return *cfg, nil
+	case <-ctx.Done():
+		a.cfgWaitersMu.Lock()
+		delete(a.cfgWaiters, w)
+		a.cfgWaitersMu.Unlock()
+		return ConfigNotification{}, ctx.Err()
+	}
+}
+
+// notifyConfigWaiters sends created or updated config cfg
+// to all waiters of its path and removes them.
+func (a *Agent) notifyConfigWaiters(cfg *ConfigNotification) {
+	if cfg.Op == ndk.SdkMgrOperation_Delete.String() {
+		return
+	}
+
+	a.cfgWaitersMu.Lock()
+	defer a.cfgWaitersMu.Unlock()
+	for w := range a.cfgWaiters {
+		if w.path == cfg.Path {
+			w.ch <- cfg
+			delete(a.cfgWaiters, w)
+		}
+	}
 }
 
 type CommitSeq struct {
@@ -175,9 +264,16 @@ func (a *Agent) isEmptyObject(jsonStr string) bool {
 	return false
 }
 
-// parseConfig parses a streamed config notification and returns the contents ConfigNotification.
+// ParseConfigNotification parses a NDK config notification
+// and returns the contents as ConfigNotification.
 // Most of the post-processing involves converting NDK JsPaths to YANG XPaths.
-func parseConfig(n *ndk.ConfigNotification) *ConfigNotification {
+// The .commit.end notification path is returned as is
+// and its commit sequence is parsed into CommitSeq.
+// Apps that obtain NDK config notifications through their own means
+// (e.g. replaying recorded notifications) can use this function to get
+// the same ConfigNotification as streamed on chan Config.
+// nil is returned if n is nil.
+func ParseConfigNotification(n *ndk.ConfigNotification) *ConfigNotification {
 	if n == nil {
 		return nil
 	}
@@ -187,6 +283,10 @@ func parseConfig(n *ndk.ConfigNotification) *ConfigNotification {
 	cfg.Path = n.GetKey().GetJsPathWithKeys()
 	cfg.PathWithoutKeys = n.GetKey().GetJsPath()
 	if cfg.Path == commitEndKeyPath { // don't convert commit end path
+		var commitSeq CommitSeq
+		if err := json.Unmarshal([]byte(cfg.Json), &commitSeq); err == nil {
+			cfg.CommitSeq = commitSeq.CommitSeq
+		}
 		return cfg
 	}
 	cfg.Path = convertJSPathToXPath(cfg.Path)
@@ -0,0 +1,423 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"github.com/openconfig/gnmi/proto/gnmi"
+)
+
+func TestParseConfigNotification(t *testing.T) {
+	tests := map[string]struct {
+		input    *ndk.ConfigNotification
+		expected *ConfigNotification
+	}{
+		"Container": {
+			input: &ndk.ConfigNotification{
+				Op: ndk.SdkMgrOperation_Create,
+				Key: &ndk.ConfigKey{
+					JsPath:         ".greeter",
+					JsPathWithKeys: ".greeter",
+				},
+				Data: &ndk.ConfigData{DataType: &ndk.ConfigData_Json{Json: `{"name": "me"}`}},
+			},
+			expected: &ConfigNotification{
+				Op:              "Create",
+				Path:            "/greeter",
+				PathWithoutKeys: "/greeter",
+				Json:            `{"name": "me"}`,
+			},
+		},
+		"List entry": {
+			input: &ndk.ConfigNotification{
+				Op: ndk.SdkMgrOperation_Delete,
+				Key: &ndk.ConfigKey{
+					JsPath:         ".greeter.list_node",
+					JsPathWithKeys: `.greeter.list_node{.name=="entry1"}`,
+					Keys:           []string{"entry1"},
+				},
+				Data: &ndk.ConfigData{DataType: &ndk.ConfigData_Json{Json: "{}"}},
+			},
+			expected: &ConfigNotification{
+				Op:              "Delete",
+				Path:            "/greeter/list-node[name=entry1]",
+				PathWithoutKeys: "/greeter/list-node",
+				Keys:            []string{"entry1"},
+				Json:            "{}",
+			},
+		},
+		"Commit end": {
+			input: &ndk.ConfigNotification{
+				Op: ndk.SdkMgrOperation_Create,
+				Key: &ndk.ConfigKey{
+					JsPath:         commitEndKeyPath,
+					JsPathWithKeys: commitEndKeyPath,
+				},
+				Data: &ndk.ConfigData{DataType: &ndk.ConfigData_Json{Json: `{"commit_seq": 2}`}},
+			},
+			expected: &ConfigNotification{
+				Op:              "Create",
+				Path:            ".commit.end",
+				PathWithoutKeys: ".commit.end",
+				Json:            `{"commit_seq": 2}`,
+				CommitSeq:       2,
+			},
+		},
+		"Nil notification": {},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := ParseConfigNotification(tt.input)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ParseConfigNotification() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStreamedCommitEndSeq(t *testing.T) {
+	a := newTestAgent(t, WithStreamConfig())
+	withFakeStream(a,
+		&ndk.Notification{
+			SubscriptionTypes: &ndk.Notification_Config{
+				Config: &ndk.ConfigNotification{
+					Op:   ndk.SdkMgrOperation_Create,
+					Key:  &ndk.ConfigKey{JsPath: ".greeter", JsPathWithKeys: ".greeter"},
+					Data: &ndk.ConfigData{DataType: &ndk.ConfigData_Json{Json: `{"name": "me"}`}},
+				},
+			},
+		},
+		&ndk.Notification{
+			SubscriptionTypes: &ndk.Notification_Config{
+				Config: &ndk.ConfigNotification{
+					Op:   ndk.SdkMgrOperation_Create,
+					Key:  &ndk.ConfigKey{JsPath: commitEndKeyPath, JsPathWithKeys: commitEndKeyPath},
+					Data: &ndk.ConfigData{DataType: &ndk.ConfigData_Json{Json: `{"commit_seq": 7}`}},
+				},
+			},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.receiveConfigNotifications(ctx)
+
+	if cfg := <-a.Notifications.Config; cfg.CommitSeq != 0 {
+		t.Errorf("config notification CommitSeq = %d, want 0", cfg.CommitSeq)
+	}
+	cfg := <-a.Notifications.Config
+	if cfg.Path != commitEndKeyPath {
+		t.Fatalf("notification Path = %s, want %s", cfg.Path, commitEndKeyPath)
+	}
+	if cfg.CommitSeq != 7 {
+		t.Errorf("commit end CommitSeq = %d, want 7", cfg.CommitSeq)
+	}
+}
+
+func commitEndNotification(seq int) *ndk.Notification {
+	return &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_Config{
+			Config: &ndk.ConfigNotification{
+				Op:   ndk.SdkMgrOperation_Create,
+				Key:  &ndk.ConfigKey{JsPath: commitEndKeyPath, JsPathWithKeys: commitEndKeyPath},
+				Data: &ndk.ConfigData{DataType: &ndk.ConfigData_Json{Json: fmt.Sprintf(`{"commit_seq": %d}`, seq)}},
+			},
+		},
+	}
+}
+
+func TestCommitDebounce(t *testing.T) {
+	commits := []*ndk.Notification{commitEndNotification(1), commitEndNotification(2), commitEndNotification(3)}
+
+	t.Run("Without debounce", func(t *testing.T) {
+		a := newTestAgent(t, WithAppRootPath("/greeter"))
+		withFakeStream(a, commits...)
+		gnmiClient := withFakeGNMI(a)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go a.receiveConfigNotifications(ctx)
+
+		for range commits {
+			<-a.Notifications.FullConfigReceived
+		}
+		if got := len(gnmiClient.getRequests()); got != len(commits) {
+			t.Errorf("config fetched %d times, want %d", got, len(commits))
+		}
+	})
+
+	t.Run("With debounce", func(t *testing.T) {
+		clk := newFakeClock()
+		a := newTestAgent(t, WithAppRootPath("/greeter"), WithCommitDebounce(time.Second), withClock(clk))
+		withFakeStream(a, commits...)
+		gnmiClient := withFakeGNMI(a)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go a.receiveConfigNotifications(ctx)
+
+		// debounce window expires after all commits are received
+		clk.tick()
+		<-a.Notifications.FullConfigReceived
+
+		if got := len(gnmiClient.getRequests()); got != 1 {
+			t.Errorf("config fetched %d times, want 1", got)
+		}
+		select {
+		case <-a.Notifications.FullConfigReceived:
+			t.Errorf("FullConfigReceived signaled more than once")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestLastCommitEnd(t *testing.T) {
+	tests := map[string]struct {
+		commits []*ndk.Notification
+		want    string
+	}{
+		"Single commit": {
+			commits: []*ndk.Notification{commitEndNotification(1)},
+			want:    `{"commit_seq": 1}`,
+		},
+		"Last commit": {
+			commits: []*ndk.Notification{commitEndNotification(1), commitEndNotification(2)},
+			want:    `{"commit_seq": 2}`,
+		},
+		"Zero commit sequence ignored": {
+			commits: []*ndk.Notification{commitEndNotification(1), commitEndNotification(0), commitEndNotification(2)},
+			want:    `{"commit_seq": 2}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, WithAppRootPath("/greeter"))
+			if got := a.LastCommitEnd(); got != "" {
+				t.Errorf("LastCommitEnd() before commits = %s, want empty", got)
+			}
+			withFakeStream(a, tc.commits...)
+			withFakeGNMI(a)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.receiveConfigNotifications(ctx)
+
+			for _, c := range tc.commits {
+				if c.GetConfig().GetData().GetJson() != `{"commit_seq": 0}` {
+					<-a.Notifications.FullConfigReceived
+				}
+			}
+			if got := a.LastCommitEnd(); got != tc.want {
+				t.Errorf("LastCommitEnd() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func configNotification(op ndk.SdkMgrOperation, jsPath, jsPathWithKeys string) *ndk.Notification {
+	return &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_Config{
+			Config: &ndk.ConfigNotification{
+				Op:   op,
+				Key:  &ndk.ConfigKey{JsPath: jsPath, JsPathWithKeys: jsPathWithKeys},
+				Data: &ndk.ConfigData{DataType: &ndk.ConfigData_Json{Json: "{}"}},
+			},
+		},
+	}
+}
+
+// waitForConfigWaiters blocks until n callers wait in WaitForConfigPath.
+func waitForConfigWaiters(t *testing.T, a *Agent, n int) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		a.cfgWaitersMu.Lock()
+		waiting := len(a.cfgWaiters)
+		a.cfgWaitersMu.Unlock()
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d callers are not waiting for config path", n)
+}
+
+func TestWaitForConfigPath(t *testing.T) {
+	a := newTestAgent(t, WithStreamConfig())
+	withFakeStream(a,
+		configNotification(ndk.SdkMgrOperation_Create, ".greeter", ".greeter"),
+		configNotification(ndk.SdkMgrOperation_Delete, ".greeter.list_node", `.greeter.list_node{.name=="entry1"}`),
+		configNotification(ndk.SdkMgrOperation_Create, ".greeter.list_node", `.greeter.list_node{.name=="entry2"}`),
+		configNotification(ndk.SdkMgrOperation_Update, ".greeter.list_node", `.greeter.list_node{.name=="entry1"}`),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.receiveConfigNotifications(ctx)
+
+	type result struct {
+		cfg ConfigNotification
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		cfg, err := a.WaitForConfigPath(ctx, "/greeter/list-node[name=entry1]")
+		done <- result{cfg, err}
+	}()
+	waitForConfigWaiters(t, a, 1)
+
+	for i := 0; i < 4; i++ {
+		<-a.Notifications.Config
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("WaitForConfigPath() returned error: %v", r.err)
+	}
+	if r.cfg.Op != "Update" || r.cfg.Path != "/greeter/list-node[name=entry1]" {
+		t.Errorf("WaitForConfigPath() = %+v, want Update of /greeter/list-node[name=entry1]", r.cfg)
+	}
+}
+
+func TestWaitForConfigPathTimeout(t *testing.T) {
+	a := newTestAgent(t, WithStreamConfig())
+	withFakeStream(a,
+		configNotification(ndk.SdkMgrOperation_Create, ".greeter", ".greeter"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.receiveConfigNotifications(ctx)
+	go func() {
+		for range a.Notifications.Config {
+		}
+	}()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	_, err := a.WaitForConfigPath(waitCtx, "/greeter/list-node[name=entry1]")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForConfigPath() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	waitForConfigWaiters(t, a, 0)
+}
+
+func TestWaitForConfigPathNotStreaming(t *testing.T) {
+	a := newTestAgent(t)
+	_, err := a.WaitForConfigPath(context.Background(), "/greeter")
+	if !errors.Is(err, ErrStreamCfgOptionNotSet) {
+		t.Errorf("WaitForConfigPath() = %v, want %v", err, ErrStreamCfgOptionNotSet)
+	}
+}
+
+func TestConfigHandlerUnblocksOnCancel(t *testing.T) {
+	a := newTestAgent(t, WithStreamConfig())
+	resp := &ndk.NotificationStreamResponse{
+		Notification: []*ndk.Notification{
+			configNotification(ndk.SdkMgrOperation_Create, ".greeter", ".greeter"),
+			configNotification(ndk.SdkMgrOperation_Update, ".greeter", ".greeter"),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		// chan Config is never read
+		a.handleConfigNotifications(ctx, resp)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("handleConfigNotifications() returned before ctx was cancelled")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handleConfigNotifications() is blocked after ctx was cancelled")
+	}
+}
+
+func TestEmptyConfigNotification(t *testing.T) {
+	tests := map[string]struct {
+		opts       []Option
+		commitSeq  int
+		config     string // config value returned by gNMI, no update if empty
+		wantSignal bool
+	}{
+		"Config deleted": {
+			commitSeq:  2,
+			config:     "{}",
+			wantSignal: true,
+		},
+		"Config deleted without update": {
+			commitSeq:  2,
+			wantSignal: true,
+		},
+		"Zero commit sequence ignored": {
+			commitSeq: 0,
+		},
+		"Zero commit sequence notified": {
+			opts:       []Option{WithEmptyConfigNotification()},
+			commitSeq:  0,
+			wantSignal: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, append([]Option{WithAppRootPath("/greeter")}, tc.opts...)...)
+			a.Notifications.FullConfig = []byte(`{"name": "previous"}`)
+			withFakeStream(a, commitEndNotification(tc.commitSeq))
+			gnmiClient := withFakeGNMI(a)
+			n := &gnmi.Notification{}
+			if tc.config != "" {
+				n.Update = append(n.Update, jsonIetfUpdate(t, "/greeter", tc.config))
+			}
+			gnmiClient.getResp = &gnmi.GetResponse{Notification: []*gnmi.Notification{n}}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.receiveConfigNotifications(ctx)
+
+			select {
+			case <-a.Notifications.FullConfigReceived:
+				if !tc.wantSignal {
+					t.Fatalf("FullConfigReceived signaled, want no signal")
+				}
+				if a.Notifications.FullConfig != nil {
+					t.Errorf("FullConfig = %s, want nil", a.Notifications.FullConfig)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tc.wantSignal {
+					t.Fatalf("FullConfigReceived not signaled")
+				}
+			}
+		})
+	}
+}
+
+func TestConfigNotificationsExitOnCancel(t *testing.T) {
+	a := newTestAgent(t, WithStreamConfig())
+	withFakeStream(a, configNotification(ndk.SdkMgrOperation_Create, ".greeter", ".greeter"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.startConfigNotifications(ctx)
+	<-a.Notifications.Config
+	cancel()
+
+	select {
+	case <-a.configDone:
+	case <-time.After(time.Second):
+		t.Fatal("config notification goroutine did not exit after context cancel")
+	}
+}
@@ -3,13 +3,20 @@ package bond
 import (
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/grpc/metadata"
 )
 
+// commitSeqMetadataKey is the gRPC metadata key
+// carrying the commit sequence of acknowledged configs.
+const commitSeqMetadataKey = "commit_seq"
+
 var (
 	ErrAckCfgFailed       = errors.New("acknowledge config failed")
 	ErrAckCfgOptionNotSet = errors.New("agent is not registered with WaitAckConfig option")
+	ErrInvalidAck         = errors.New("invalid acknowledgement")
 )
 
 type Acknowledgement = ndk.AcknowledgeConfigRequestInfo
@@ -47,6 +54,24 @@ func NewAcknowledgement(path string, m Message) *Acknowledgement {
 	return a
 }
 
+// NewAcknowledgementE creates a config Acknowledgement
+// like NewAcknowledgement, but returns an error
+// instead of an empty acknowledgement
+// if path is empty, m is nil or m does not set a message.
+func NewAcknowledgementE(path string, m Message) (*Acknowledgement, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: path is empty", ErrInvalidAck)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%w: message is nil for path %s", ErrInvalidAck, path)
+	}
+	a := NewAcknowledgement(path, m)
+	if a.GetResult() == nil {
+		return nil, fmt.Errorf("%w: message is empty for path %s", ErrInvalidAck, path)
+	}
+	return a, nil
+}
+
 // Output returns an output Message, given the string o.
 func Output(o string) Message {
 	return func(a *Acknowledgement) {
@@ -92,6 +117,9 @@ func Error(e string) Message {
 // the valid config notifications.
 // If `acks` is empty, SR Linux will still treat this as
 // a valid acknowledgement, but with empty data.
+// The commit sequence of the last received .commit.end notification
+// is sent in the commit_seq request metadata,
+// so that the acknowledgement can be correlated with the commit in server logs.
 func (a *Agent) AcknowledgeConfig(acks ...*Acknowledgement) error {
 	if !a.configAck {
 		a.logger.Error().
@@ -110,9 +138,18 @@ func (a *Agent) AcknowledgeConfig(acks ...*Acknowledgement) error {
 	req := &ndk.AcknowledgeConfigRequest{
 		Infos: infos,
 	}
+	ctx := a.ctx
+	if seq := a.commitSeq.Load(); seq != 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, commitSeqMetadataKey, strconv.FormatInt(seq, 10))
+	}
 	// Call NDK RPC
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	a.logger.Info().Msgf("Acknowledge Config %v with NDK server", req)
-	resp, err := a.stubs.configService.AcknowledgeConfig(a.ctx, req)
+	resp, err := a.stubs.configService.AcknowledgeConfig(ctx, req)
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
 		a.logger.Error().
 			Msgf("Failed to acknowledge config, response: %v", resp)
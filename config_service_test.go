@@ -0,0 +1,137 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNewAcknowledgementE(t *testing.T) {
+	tests := map[string]struct {
+		path    string
+		msg     Message
+		want    *Acknowledgement
+		wantErr error
+	}{
+		"Valid acknowledgement": {
+			path: "/greeter/list-node[name=entry1]",
+			msg:  Warning("deprecated"),
+			want: &Acknowledgement{
+				JsPathWithKeys: `.greeter.list-node{.name=="entry1"}`,
+				Result:         &ndk.AcknowledgeConfigRequestInfo_Warning{Warning: "deprecated"},
+			},
+		},
+		"Empty path": {
+			msg:     Output("ok"),
+			wantErr: ErrInvalidAck,
+		},
+		"Nil message": {
+			path:    "/greeter",
+			wantErr: ErrInvalidAck,
+		},
+		"Empty message": {
+			path:    "/greeter",
+			msg:     func(*Acknowledgement) {},
+			wantErr: ErrInvalidAck,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewAcknowledgementE(tc.path, tc.msg)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("NewAcknowledgementE() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				if got != nil {
+					t.Errorf("NewAcknowledgementE() = %v, want nil", got)
+				}
+				return
+			}
+			if !proto.Equal(got, tc.want) {
+				t.Errorf("NewAcknowledgementE() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// fakeConfigService is a fake NDK SdkMgrConfigServiceClient
+// which records the outgoing metadata of acknowledgements.
+type fakeConfigService struct {
+	ndk.SdkMgrConfigServiceClient
+
+	ackMD []metadata.MD
+}
+
+func (f *fakeConfigService) AcknowledgeConfig(ctx context.Context, _ *ndk.AcknowledgeConfigRequest, _ ...grpc.CallOption) (*ndk.AcknowledgeConfigResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	f.ackMD = append(f.ackMD, md)
+	return &ndk.AcknowledgeConfigResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func TestAcknowledgeConfigCommitSeq(t *testing.T) {
+	a := newTestAgent(t, WithStreamConfig(), WithConfigAcknowledge())
+	withFakeStream(a,
+		configNotification(ndk.SdkMgrOperation_Create, ".greeter", ".greeter"),
+		commitEndNotification(7),
+	)
+	cfgService := &fakeConfigService{}
+	a.stubs.configService = cfgService
+
+	// acknowledgements before any commit carry no commit sequence
+	if err := a.AcknowledgeConfig(); err != nil {
+		t.Fatalf("AcknowledgeConfig() returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.receiveConfigNotifications(ctx)
+	<-a.Notifications.Config
+	if cfg := <-a.Notifications.Config; cfg.Path != commitEndKeyPath {
+		t.Fatalf("notification Path = %s, want %s", cfg.Path, commitEndKeyPath)
+	}
+
+	ack, err := NewAcknowledgementE("/greeter", Warning("check"))
+	if err != nil {
+		t.Fatalf("NewAcknowledgementE() returned error: %v", err)
+	}
+	if err := a.AcknowledgeConfig(ack); err != nil {
+		t.Fatalf("AcknowledgeConfig() returned error: %v", err)
+	}
+
+	if len(cfgService.ackMD) != 2 {
+		t.Fatalf("got %d acknowledgements, want 2", len(cfgService.ackMD))
+	}
+	if got := cfgService.ackMD[0].Get(commitSeqMetadataKey); len(got) != 0 {
+		t.Errorf("metadata %s before commit = %v, want none", commitSeqMetadataKey, got)
+	}
+	if got := cfgService.ackMD[1].Get(commitSeqMetadataKey); !reflect.DeepEqual(got, []string{"7"}) {
+		t.Errorf("metadata %s = %v, want [7]", commitSeqMetadataKey, got)
+	}
+	if got := cfgService.ackMD[1].Get(a.metadataKey); !reflect.DeepEqual(got, []string{a.Name}) {
+		t.Errorf("metadata %s = %v, want [%s]", a.metadataKey, got, a.Name)
+	}
+}
+
+func TestCommitSeqFullConfig(t *testing.T) {
+	a := newTestAgent(t, WithAppRootPath("/greeter"))
+	withFakeStream(a, commitEndNotification(7))
+	withFakeGNMI(a)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.receiveConfigNotifications(ctx)
+	<-a.Notifications.FullConfigReceived
+
+	// the commit sequence is kept for acknowledgements
+	// when configs are not streamed too
+	if got := a.commitSeq.Load(); got != 7 {
+		t.Errorf("commit sequence = %d, want 7", got)
+	}
+}
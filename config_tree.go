@@ -0,0 +1,95 @@
+package bond
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+// ConfigTree reconstructs the app's config from streamed config notifications.
+// Apps streaming configs with WithStreamConfig only receive
+// config fragments of the changed paths,
+// ConfigTree applies these fragments to provide a view of the whole config.
+// The tree is keyed by path in XPath format, e.g. /greeter/list-node[name=entry1],
+// and stores the Json fragment of each path.
+// ConfigTree is safe for concurrent use.
+//
+// Example:
+//
+//	tree := NewConfigTree()
+//	for cfg := range agent.Notifications.Config {
+//		tree.Apply(cfg)
+//	}
+type ConfigTree struct {
+	mu    sync.RWMutex
+	nodes map[string]string
+}
+
+// NewConfigTree creates an empty ConfigTree.
+func NewConfigTree() *ConfigTree {
+	return &ConfigTree{nodes: make(map[string]string)}
+}
+
+// Apply applies config notification cfg to the tree.
+// Create and Update notifications store the Json fragment of cfg.Path,
+// Delete notifications remove cfg.Path and all paths below it.
+// .commit.end notifications and nil cfg are ignored.
+func (t *ConfigTree) Apply(cfg *ConfigNotification) {
+	if cfg == nil || cfg.Path == commitEndKeyPath {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cfg.Op != ndk.SdkMgrOperation_Delete.String() {
+		t.nodes[cfg.Path] = cfg.Json
+		return
+	}
+
+	for p := range t.nodes {
+		if isSubPath(p, cfg.Path) {
+			delete(t.nodes, p)
+		}
+	}
+}
+
+// Get returns the Json fragment stored at xpath
+// and whether xpath exists in the tree.
+// xpath must match the path of a received notification exactly.
+//
+// Example: Get("/greeter/list-node[name=entry1]")
+func (t *ConfigTree) Get(xpath string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	js, ok := t.nodes[xpath]
+	return js, ok
+}
+
+// Paths returns the sorted paths of xpath and all paths below it.
+// An empty xpath returns all paths in the tree.
+//
+// Example: Paths("/greeter") returns /greeter and
+// all of its list entries, e.g. /greeter/list-node[name=entry1].
+func (t *ConfigTree) Paths(xpath string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	paths := []string{}
+	for p := range t.nodes {
+		if xpath == "" || isSubPath(p, xpath) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// isSubPath returns true if path is xpath or a path below it.
+func isSubPath(path, xpath string) bool {
+	return path == xpath ||
+		strings.HasPrefix(path, xpath+"/") ||
+		strings.HasPrefix(path, xpath+"[")
+}
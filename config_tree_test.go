@@ -0,0 +1,128 @@
+package bond
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigTree(t *testing.T) {
+	create := func(path, js string) *ConfigNotification {
+		return &ConfigNotification{Op: "Create", Path: path, Json: js}
+	}
+	update := func(path, js string) *ConfigNotification {
+		return &ConfigNotification{Op: "Update", Path: path, Json: js}
+	}
+	del := func(path string) *ConfigNotification {
+		return &ConfigNotification{Op: "Delete", Path: path}
+	}
+	commitEnd := &ConfigNotification{Op: "Create", Path: commitEndKeyPath, Json: `{"commit_seq":1}`}
+
+	tests := map[string]struct {
+		notifications []*ConfigNotification
+		query         string
+		wantPaths     []string
+		wantJson      map[string]string // path to expected Json
+		wantMissing   []string
+	}{
+		"Create": {
+			notifications: []*ConfigNotification{
+				create("/greeter", `{"name":"bond"}`),
+				create("/greeter/list-node[name=entry1]", `{"value":1}`),
+				commitEnd,
+			},
+			wantPaths: []string{"/greeter", "/greeter/list-node[name=entry1]"},
+			wantJson: map[string]string{
+				"/greeter":                        `{"name":"bond"}`,
+				"/greeter/list-node[name=entry1]": `{"value":1}`,
+			},
+			wantMissing: []string{commitEndKeyPath},
+		},
+		"Update": {
+			notifications: []*ConfigNotification{
+				create("/greeter", `{"name":"bond"}`),
+				commitEnd,
+				update("/greeter", `{"name":"james"}`),
+				commitEnd,
+			},
+			wantPaths: []string{"/greeter"},
+			wantJson:  map[string]string{"/greeter": `{"name":"james"}`},
+		},
+		"Delete list entry": {
+			notifications: []*ConfigNotification{
+				create("/greeter", `{"name":"bond"}`),
+				create("/greeter/list-node[name=entry1]", `{"value":1}`),
+				create("/greeter/list-node[name=entry1]/sub[id=1]", `{}`),
+				create("/greeter/list-node[name=entry10]", `{"value":10}`),
+				commitEnd,
+				del("/greeter/list-node[name=entry1]"),
+				commitEnd,
+			},
+			wantPaths: []string{"/greeter", "/greeter/list-node[name=entry10]"},
+			wantJson: map[string]string{
+				"/greeter/list-node[name=entry10]": `{"value":10}`,
+			},
+			wantMissing: []string{
+				"/greeter/list-node[name=entry1]",
+				"/greeter/list-node[name=entry1]/sub[id=1]",
+			},
+		},
+		"Delete root": {
+			notifications: []*ConfigNotification{
+				create("/greeter", `{"name":"bond"}`),
+				create("/greeter/list-node[name=entry1]", `{"value":1}`),
+				create("/greeterx", `{}`),
+				commitEnd,
+				del("/greeter"),
+				commitEnd,
+			},
+			wantPaths:   []string{"/greeterx"},
+			wantMissing: []string{"/greeter", "/greeter/list-node[name=entry1]"},
+		},
+		"Query subtree": {
+			notifications: []*ConfigNotification{
+				create("/greeter", `{"name":"bond"}`),
+				create("/greeter/intf[name=ethernet-1/1]", `{}`),
+				create("/greeter/intf[name=ethernet-1/1]/sub[id=1]", `{}`),
+				create("/greeter/intf[name=ethernet-1/2]", `{}`),
+				commitEnd,
+			},
+			query: "/greeter/intf[name=ethernet-1/1]",
+			wantPaths: []string{
+				"/greeter/intf[name=ethernet-1/1]",
+				"/greeter/intf[name=ethernet-1/1]/sub[id=1]",
+			},
+		},
+		"Empty": {
+			notifications: []*ConfigNotification{nil, commitEnd},
+			wantPaths:     []string{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tree := NewConfigTree()
+			for _, n := range tc.notifications {
+				tree.Apply(n)
+			}
+
+			if got := tree.Paths(tc.query); !reflect.DeepEqual(got, tc.wantPaths) {
+				t.Errorf("Paths(%q) = %v, want %v", tc.query, got, tc.wantPaths)
+			}
+			for p, want := range tc.wantJson {
+				got, ok := tree.Get(p)
+				if !ok {
+					t.Errorf("Get(%q) not found", p)
+					continue
+				}
+				if got != want {
+					t.Errorf("Get(%q) = %s, want %s", p, got, want)
+				}
+			}
+			for _, p := range tc.wantMissing {
+				if _, ok := tree.Get(p); ok {
+					t.Errorf("Get(%q) found, want missing", p)
+				}
+			}
+		})
+	}
+}
@@ -1,47 +1,255 @@
 package bond
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"time"
+	"fmt"
+	"io"
+	"strings"
 
 	"github.com/openconfig/gnmi/proto/gnmi"
 	"github.com/openconfig/gnmic/pkg/api"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
 	defaultGrpcServerName      = "insecure-mgmt"                               // grpc-server insecure-mgmt
 	grpcServerUnixSocketPrefix = "unix:///opt/srlinux/var/run/sr_grpc_server_" // append with grpc-server name
+	grpcServerPath             = "/system/grpc-server"                         // grpc-server instances
 )
 
 var ErrorEmptyValue = errors.New("value to set request cannot be empty")
 
+// An error is returned if a subscribe request is created without paths.
+var ErrorEmptyPaths = errors.New("paths of subscribe request cannot be empty")
+
+// An error is returned if no insecure grpc-server
+// with an admin-enabled unix socket is configured in SR Linux.
+var ErrGrpcServerNotFound = errors.New("insecure grpc-server with enabled unix socket not found")
+
+// An error is returned if a ConfigNotification
+// cannot be converted to a gNMI SetRequest.
+var ErrConfigNotSettable = errors.New("config notification cannot be converted to a set request")
+
+// An error is returned if a gNMI Set is attempted
+// while Agent has option WithReadOnlyGNMI set.
+var ErrReadOnlyGNMI = errors.New("gnmi set is not allowed in read-only mode")
+
+// An error is returned if a gNMI Subscribe stream cannot be started.
+var ErrGNMISubscribeFailed = errors.New("gnmi subscribe failed")
+
+// An error is returned by Start if the gNMI target
+// or its gNMI client cannot be created.
+var ErrGNMITargetFailed = errors.New("gnmi target creation failed")
+
+// gnmiTLSConfig holds the TLS files of the gNMI target set with WithGNMITLS.
+type gnmiTLSConfig struct {
+	caFile     string
+	certFile   string
+	keyFile    string
+	skipVerify bool
+}
+
+// startGNMI creates the gNMI target used for gNMI operations,
+// connecting to the discovered grpc-server if Agent
+// has option WithGrpcServerDiscovery set.
+// The target set with WithGNMITarget is used as is.
+// An error wrapping ErrGNMITargetFailed is returned
+// if the gNMI target cannot be created.
+func (a *Agent) startGNMI() error {
+	if a.customGNMITarget {
+		a.logger.Debug().Msg("using provided gNMI target")
+		return nil
+	}
+
+	if err := a.newGNMITarget(); err != nil {
+		return err
+	}
+
+	if a.discoverGrpcServer && a.gnmiAddress == "" {
+		return a.useDiscoveredGrpcServer()
+	}
+	return nil
+}
+
+// newGNMITarget creates the gNMI target connected to the grpc-server
+// unix socket and its gNMI client.
+// An error wrapping ErrGNMITargetFailed is returned
+// if the target or client cannot be created.
 func (a *Agent) newGNMITarget() error {
 	a.logger.Debug().Msg("creating gNMI Client")
-	grpcServerUnixSocket := grpcServerUnixSocketPrefix + a.grpcServerName
 	// create a target
-	target, err := api.NewTarget(
-		api.Name("ndk"),
-		api.Address(grpcServerUnixSocket),
-		api.Username(defaultUsername),
-		api.Password(defaultPassword),
-		api.Insecure(true),
-		api.Timeout(10*time.Second),
-	)
+	target, err := api.NewTarget(a.gnmiTargetOptions()...)
 	if err != nil {
-		a.logger.Fatal().Err(err).Msg("gNMI target creation failed")
-		return err
+		a.logger.Error().Err(err).Msg("gNMI target creation failed")
+		return fmt.Errorf("%w: %w", ErrGNMITargetFailed, err)
 	}
 
 	a.GnmiTarget = target
 
 	err = a.GnmiTarget.CreateGNMIClient(a.ctx)
 	if err != nil {
-		a.logger.Fatal().Err(err).Msg("gNMI Client creation failed")
+		a.logger.Error().Err(err).Msg("gNMI Client creation failed")
+		return fmt.Errorf("%w: %w", ErrGNMITargetFailed, err)
 	}
 
 	a.logger.Debug().Msg("gNMI Client created")
 
-	return err
+	return nil
+}
+
+// gnmiTargetOptions returns the options of the gNMI target
+// connected to the grpc-server unix socket,
+// or to the address set with WithGNMIAddress.
+// The target uses TLS if Agent has option WithGNMITLS set,
+// otherwise the connection is insecure.
+func (a *Agent) gnmiTargetOptions() []api.TargetOption {
+	address := grpcServerUnixSocketPrefix + a.grpcServerName
+	if a.gnmiAddress != "" {
+		address = a.gnmiAddress
+	}
+	opts := []api.TargetOption{
+		api.Name("ndk"),
+		api.Address(address),
+		api.Username(a.gnmiUsername),
+		api.Password(a.gnmiPassword),
+		api.Timeout(a.gnmiTimeout),
+	}
+	if a.gnmiTLS == nil {
+		return append(opts, api.Insecure(true))
+	}
+	return append(opts,
+		api.TLSCA(a.gnmiTLS.caFile),
+		api.TLSCert(a.gnmiTLS.certFile),
+		api.TLSKey(a.gnmiTLS.keyFile),
+		api.SkipVerify(a.gnmiTLS.skipVerify),
+	)
+}
+
+// useDiscoveredGrpcServer discovers the grpc-server name with discoverGrpcServerName
+// and recreates the gNMI target if the discovered name differs from the current one.
+// The current grpc-server name is kept if discovery fails.
+// An error is returned if the gNMI target of the discovered grpc-server
+// cannot be created.
+func (a *Agent) useDiscoveredGrpcServer() error {
+	name, err := a.discoverGrpcServerName()
+	if err != nil {
+		a.logger.Warn().Err(err).
+			Str("grpc-server", a.grpcServerName).
+			Msg("grpc-server discovery failed, using configured grpc-server")
+		return nil
+	}
+	if name == a.grpcServerName {
+		return nil
+	}
+
+	a.logger.Info().
+		Str("grpc-server", name).
+		Msg("Discovered grpc-server")
+
+	if err := a.GnmiTarget.Close(); err != nil {
+		a.logger.Warn().Err(err).
+			Str("grpc-server", a.grpcServerName).
+			Msg("Failed closing gNMI target")
+	}
+	a.grpcServerName = name
+	return a.newGNMITarget()
+}
+
+// discoverGrpcServerName retrieves the grpc-server instances configured in SR Linux
+// with a gNMI Get and returns the name of the first insecure grpc-server
+// (i.e. without a tls-profile) that has an admin-enabled unix socket.
+// An error is returned if the Get fails or no such grpc-server is configured.
+func (a *Agent) discoverGrpcServerName() (string, error) {
+	req, err := api.NewGetRequest(
+		api.Path(grpcServerPath),
+		api.EncodingJSON_IETF(),
+		api.DataTypeCONFIG(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := a.GetWithGNMI(req)
+	if err != nil {
+		return "", err
+	}
+
+	for _, n := range resp.GetNotification() {
+		for _, u := range n.GetUpdate() {
+			var v any
+			if err := json.Unmarshal(u.GetVal().GetJsonIetfVal(), &v); err != nil {
+				return "", err
+			}
+
+			// update value is a single list entry if the path has the list key
+			elems := u.GetPath().GetElem()
+			if len(elems) != 0 {
+				if name, ok := elems[len(elems)-1].GetKey()["name"]; ok {
+					if entry, ok := v.(map[string]any); ok && isInsecureGrpcServer(entry) {
+						return name, nil
+					}
+					continue
+				}
+			}
+
+			// otherwise it contains the grpc-server list
+			if m, ok := v.(map[string]any); ok {
+				v = jsonField(m, "grpc-server")
+			}
+			entries, _ := v.([]any)
+			for _, e := range entries {
+				entry, ok := e.(map[string]any)
+				if !ok || !isInsecureGrpcServer(entry) {
+					continue
+				}
+				if name, ok := jsonField(entry, "name").(string); ok {
+					return name, nil
+				}
+			}
+		}
+	}
+
+	return "", ErrGrpcServerNotFound
+}
+
+// isInsecureGrpcServer returns true if grpc-server list entry
+// has no tls-profile and its unix socket is admin-enabled.
+func isInsecureGrpcServer(entry map[string]any) bool {
+	if jsonField(entry, "tls-profile") != nil {
+		return false
+	}
+	unixSocket, _ := jsonField(entry, "unix-socket").(map[string]any)
+	return jsonField(unixSocket, "admin-state") == "enable"
+}
+
+// jsonField returns the value of JSON IETF object field name.
+// Field name may be prefixed by its YANG module name, e.g. srl_nokia-system:name.
+// nil is returned if the field is not found.
+func jsonField(m map[string]any, name string) any {
+	for k, v := range m {
+		if k == name || strings.HasSuffix(k, ":"+name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// acquireGNMI blocks until a gNMI operation is allowed to run
+// within the concurrency limit set with WithGNMIConcurrency
+// and returns a function releasing it.
+// An error is returned if the Agent context is done while waiting.
+func (a *Agent) acquireGNMI() (release func(), err error) {
+	if a.gnmiSem == nil {
+		return func() {}, nil
+	}
+	select {
+	case a.gnmiSem <- struct{}{}:
+		return func() { <-a.gnmiSem }, nil
+	case <-a.ctx.Done():
+		return nil, a.ctx.Err()
+	}
 }
 
 // NewGetRequest creates a new *gnmi.GetRequest
@@ -78,6 +286,28 @@ func NewSetUpdateRequest(path string, value api.GNMIOption, opts ...api.GNMIOpti
 	return req, err
 }
 
+// NewSetUpdateRequestJSON creates a new *gnmi.SetRequest
+// that updates the provided gNMI path with v encoded as a json_ietf value.
+// v is marshaled with encoding/json, so struct fields
+// should be tagged with their YANG names.
+// A GNMIOption list opts can be as set as well.
+// An error is returned if v is nil or cannot be marshaled.
+//
+// For example: To update /greeter with the name leaf set to "bond",
+// NewSetUpdateRequestJSON("/greeter", struct {
+// Name string `json:"name"`
+// }{Name: "bond"})
+func NewSetUpdateRequestJSON(path string, v any, opts ...api.GNMIOption) (*gnmi.SetRequest, error) {
+	if v == nil {
+		return nil, ErrorEmptyValue
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal value for path %s: %w", path, err)
+	}
+	return NewSetUpdateRequest(path, api.Value(string(b), "json_ietf"), opts...)
+}
+
 // NewSetReplaceRequest creates a new *gnmi.SetRequest
 // that replaces the provided gNMI path with the provided value.
 // A replace value must be provided and can be
@@ -115,12 +345,56 @@ func NewSetDeleteRequest(path string, opts ...api.GNMIOption) (*gnmi.SetRequest,
 	return req, err
 }
 
+// NewSetRequestFromConfig creates a new *gnmi.SetRequest
+// from a streamed ConfigNotification n.
+// The notification Path is passed to transform,
+// which returns the gNMI path targeted by the SetRequest.
+// If transform is nil, the notification Path is used as is.
+// Create and Update notifications result in an update of the target path
+// with the notification Json as a json_ietf encoded value.
+// Delete notifications result in a delete of the target path.
+// A GNMIOption list opts can be as set as well.
+// An error is returned for .commit.end notifications,
+// unknown operations or Create/Update notifications without Json.
+//
+// For example: To mirror config of /greeter into /mirror,
+// NewSetRequestFromConfig(n, func(p string) string { return strings.Replace(p, "/greeter", "/mirror", 1) })
+func NewSetRequestFromConfig(n *ConfigNotification, transform func(path string) string, opts ...api.GNMIOption) (*gnmi.SetRequest, error) {
+	if n == nil || n.Path == commitEndKeyPath {
+		return nil, fmt.Errorf("%w: no config path", ErrConfigNotSettable)
+	}
+	path := n.Path
+	if transform != nil {
+		path = transform(path)
+	}
+	switch n.Op {
+	case "Create", "Update", "CreateOrUpdate":
+		if n.Json == "" {
+			return nil, ErrorEmptyValue
+		}
+		return NewSetUpdateRequest(path, api.Value(n.Json, "json_ietf"), opts...)
+	case "Delete":
+		return NewSetDeleteRequest(path, opts...)
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrConfigNotSettable, n.Op)
+	}
+}
+
 // GetWithGNMI sends a gnmi.GetRequest and returns a gnmi.GetResponse and an error.
 // To create a gNMI GetRequest, please use NewGetRequest method.
+// The request is cancelled after the timeout set with WithGNMITimeout.
 func (a *Agent) GetWithGNMI(req *gnmi.GetRequest) (*gnmi.GetResponse, error) {
-	resp, err := a.GnmiTarget.Get(a.ctx, req)
+	release, err := a.acquireGNMI()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(a.ctx, a.gnmiTimeout)
+	defer cancel()
+	resp, err := a.GnmiTarget.Get(ctx, req)
 	if err != nil {
-		a.logger.Fatal().Err(err).Msg("failed executing GetRequest")
+		a.logger.Error().Err(err).Msg("failed executing GetRequest")
 	}
 
 	a.logger.Debug().Msgf("gNMI Get response: %+v", resp)
@@ -129,16 +403,108 @@ func (a *Agent) GetWithGNMI(req *gnmi.GetRequest) (*gnmi.GetResponse, error) {
 
 // SetWithGNMI sends a gnmi.SetRequest and returns a gnmi.SetResponse and an error.
 // To create a gNMI SetRequest, consider using NewSet<Update,Replace,Delete>Request methods.
+// The request is cancelled after the timeout set with WithGNMITimeout.
+// An error is returned without sending the request
+// if Agent has option WithReadOnlyGNMI set.
 func (a *Agent) SetWithGNMI(req *gnmi.SetRequest) (*gnmi.SetResponse, error) {
-	resp, err := a.GnmiTarget.Set(a.ctx, req)
+	if a.readOnlyGNMI {
+		return nil, ErrReadOnlyGNMI
+	}
+
+	release, err := a.acquireGNMI()
 	if err != nil {
-		a.logger.Fatal().Err(err).Msg("failed executing SetRequest")
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(a.ctx, a.gnmiTimeout)
+	defer cancel()
+	resp, err := a.GnmiTarget.Set(ctx, req)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("failed executing SetRequest")
 	}
 
 	a.logger.Debug().Msgf("gNMI Set response: %+v", resp)
 	return resp, err
 }
 
+// NewSubscribeRequest creates a new *gnmi.SubscribeRequest
+// subscribing to the provided gNMI paths with subscription list mode,
+// e.g. gnmi.SubscriptionList_ONCE or gnmi.SubscriptionList_STREAM.
+// A GNMIOption list opts can be as set as well,
+// e.g. api.EncodingJSON_IETF().
+// The list of possible GNMIOption(s) can be imported
+// from gnmic api package github.com/openconfig/gnmic/pkg/api.
+// An error is returned if paths is empty or one of the options is invalid.
+//
+// For example: To stream the statistics of interface ethernet-1/1,
+// NewSubscribeRequest([]string{"/interface[name=ethernet-1/1]/statistics"},
+// gnmi.SubscriptionList_STREAM)
+func NewSubscribeRequest(paths []string, mode gnmi.SubscriptionList_Mode, opts ...api.GNMIOption) (*gnmi.SubscribeRequest, error) {
+	if len(paths) == 0 {
+		return nil, ErrorEmptyPaths
+	}
+	opts = append(opts, api.SubscriptionListMode(mode.String()))
+	for _, p := range paths {
+		opts = append(opts, api.Subscription(api.Path(p)))
+	}
+	return api.NewSubscribeRequest(opts...)
+}
+
+// SubscribeWithGNMI starts a gNMI Subscribe stream for req
+// on the Agent gNMI target and returns a channel receiving the stream's responses
+// and a cancel func tearing down the subscription.
+// Requests can be created with NewSubscribeRequest.
+// The channel is closed when cancel is called, when ctx or the Agent context is done,
+// or when the stream ends, e.g. after the responses
+// of a ONCE subscription were received, or fails.
+// Calling cancel tears down only this subscription,
+// other subscriptions started with SubscribeWithGNMI are not affected.
+// An error wrapping ErrGNMISubscribeFailed is returned
+// if the stream cannot be started.
+//
+// Example:
+// updates, cancel, err := SubscribeWithGNMI(ctx, req)
+func (a *Agent) SubscribeWithGNMI(ctx context.Context, req *gnmi.SubscribeRequest) (chan *gnmi.SubscribeResponse, func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopAgentCancel := context.AfterFunc(a.ctx, cancel)
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		"username", a.gnmiUsername, "password", a.gnmiPassword)
+
+	stream, err := a.GnmiTarget.Client.Subscribe(ctx)
+	if err == nil {
+		err = stream.Send(req)
+	}
+	if err != nil {
+		stopAgentCancel()
+		cancel()
+		return nil, nil, fmt.Errorf("%w: %w", ErrGNMISubscribeFailed, err)
+	}
+
+	responses := make(chan *gnmi.SubscribeResponse)
+	go func() {
+		defer close(responses)
+		defer stopAgentCancel()
+		defer cancel()
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil && err != io.EOF {
+					a.logger.Error().Err(err).Msg("gNMI Subscribe stream ended")
+				}
+				return
+			}
+			select {
+			case responses <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return responses, cancel, nil
+}
+
 // getConfigWithGNMI gets the config from the gNMI server for the appRootPath
 // and stores it in the agent struct.
 // gNMI Get Request returns the config in the json_ietf encoding.
@@ -152,6 +518,7 @@ func (a *Agent) getConfigWithGNMI() {
 	// and in case we receive an empty config (when config was deleted),
 	// we want our FullConfig to be nil
 	a.Notifications.FullConfig = nil
+	a.Notifications.FullConfigTruncated = false
 
 	// create a GetRequest
 	getReq, err := api.NewGetRequest(
@@ -160,21 +527,96 @@ func (a *Agent) getConfigWithGNMI() {
 		api.DataTypeCONFIG(),
 	)
 	if err != nil {
-		a.logger.Fatal().Err(err).Msg("failed to create GetRequest")
+		a.logger.Error().Err(err).Msg("failed to create GetRequest")
+		return
 	}
 
 	getResp, err := a.GetWithGNMI(getReq)
 	if err != nil {
+		a.logger.Warn().
+			Err(err).
+			Str("path", a.appRootPath).
+			Dur("timeout", a.gnmiTimeout).
+			Msg("Failed to get config with gNMI, FullConfig is not populated")
 		return
 	}
 
+	// only the first update is used as full config,
+	// flag the config as truncated if the server returned more
+	updates := 0
+	for _, n := range getResp.GetNotification() {
+		updates += len(n.GetUpdate())
+	}
+	if updates > 1 {
+		a.logger.Warn().
+			Int("notifications", len(getResp.GetNotification())).
+			Int("updates", updates).
+			Msg("gNMI returned multiple updates for app config, using the first one only")
+		a.Notifications.FullConfigTruncated = true
+	}
+
 	// log the received full config if it is not empty
 	if len(getResp.GetNotification()) != 0 && len(getResp.GetNotification()[0].GetUpdate()) != 0 {
-		a.Notifications.FullConfig = getResp.GetNotification()[0].
+		cfg := getResp.GetNotification()[0].
 			GetUpdate()[0].
 			GetVal().
 			GetJsonIetfVal()
 
+		// deleted config can be returned as an empty object
+		if len(cfg) == 0 || a.isEmptyObject(string(cfg)) {
+			a.logger.Info().Msg("Empty config received via gNMI")
+			return
+		}
+
+		a.Notifications.FullConfig = cfg
+
 		a.logger.Info().Msgf("Full config received via gNMI:\n%s", a.Notifications.FullConfig)
 	}
 }
+
+// FetchConfig retrieves the running config at path xpath with a gNMI Get
+// and returns it as json_ietf encoded bytes.
+// xpath can be any path, e.g. /network-instance[name=default],
+// apps can use it to read config outside of the app's root path.
+// nil is returned if no config exists at xpath.
+// An error is returned if the path is invalid or the Get fails.
+func (a *Agent) FetchConfig(xpath string) ([]byte, error) {
+	return a.getJSONIetf(xpath, api.DataTypeCONFIG())
+}
+
+// GetState retrieves the state at path xpath with a gNMI Get
+// and returns it as json_ietf encoded bytes.
+// Apps can use it to verify the state they published with UpdateState,
+// e.g. GetState("/greeter/list-node[name=entry1]").
+// nil is returned if no state exists at xpath.
+// An error is returned if the path is invalid or the Get fails.
+func (a *Agent) GetState(xpath string) ([]byte, error) {
+	return a.getJSONIetf(xpath, api.DataTypeSTATE())
+}
+
+// getJSONIetf retrieves data of type dataType at path xpath with a gNMI Get
+// and returns the value of the first update as json_ietf encoded bytes.
+// nil is returned if the response has no update.
+func (a *Agent) getJSONIetf(xpath string, dataType api.GNMIOption) ([]byte, error) {
+	req, err := api.NewGetRequest(
+		api.Path(xpath),
+		api.EncodingJSON_IETF(),
+		dataType,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.GetWithGNMI(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range resp.GetNotification() {
+		for _, u := range n.GetUpdate() {
+			return u.GetVal().GetJsonIetfVal(), nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,1058 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/openconfig/gnmic/pkg/api"
+	"github.com/openconfig/gnmic/pkg/api/path"
+	"github.com/openconfig/gnmic/pkg/api/target"
+	"github.com/openconfig/gnmic/pkg/api/types"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+)
+
+// fakeGNMIClient is a fake gNMI client which records requests.
+// Calling a method that is not overridden panics.
+type fakeGNMIClient struct {
+	gnmi.GNMIClient
+
+	mu      sync.Mutex
+	getReqs []*gnmi.GetRequest
+	getResp *gnmi.GetResponse
+	getErr  error
+
+	// getDelay is the duration each Get call takes.
+	getDelay time.Duration
+	// getBlock blocks Get calls until it is closed if set.
+	getBlock chan struct{}
+	// inFlight and maxInFlight track concurrent Get calls.
+	inFlight    int
+	maxInFlight int
+
+	// subscribeStreams are the started Subscribe streams in order.
+	subscribeStreams []*fakeSubscribeClient
+}
+
+func (f *fakeGNMIClient) Subscribe(ctx context.Context, _ ...grpc.CallOption) (gnmi.GNMI_SubscribeClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := &fakeSubscribeClient{ctx: ctx, responses: make(chan *gnmi.SubscribeResponse)}
+	f.subscribeStreams = append(f.subscribeStreams, s)
+	return s, nil
+}
+
+// subscribeStream returns the i-th started Subscribe stream.
+func (f *fakeGNMIClient) subscribeStream(i int) *fakeSubscribeClient {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subscribeStreams[i]
+}
+
+// fakeSubscribeClient is a fake gNMI Subscribe stream
+// which returns the responses sent to chan responses
+// until its context is cancelled or responses is closed.
+type fakeSubscribeClient struct {
+	grpc.ClientStream
+
+	ctx       context.Context
+	req       *gnmi.SubscribeRequest
+	responses chan *gnmi.SubscribeResponse
+}
+
+func (f *fakeSubscribeClient) Send(req *gnmi.SubscribeRequest) error {
+	f.req = req
+	return nil
+}
+
+func (f *fakeSubscribeClient) Recv() (*gnmi.SubscribeResponse, error) {
+	select {
+	case <-f.ctx.Done():
+		return nil, f.ctx.Err()
+	case resp, ok := <-f.responses:
+		if !ok {
+			return nil, io.EOF
+		}
+		return resp, nil
+	}
+}
+
+// getDone returns a channel which is ready once a Get call is done.
+func (f *fakeGNMIClient) getDone() <-chan struct{} {
+	if f.getBlock != nil {
+		return f.getBlock
+	}
+	done := make(chan struct{})
+	time.AfterFunc(f.getDelay, func() { close(done) })
+	return done
+}
+
+// getsInFlight returns the number of Get calls in flight.
+func (f *fakeGNMIClient) getsInFlight() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inFlight
+}
+
+func (f *fakeGNMIClient) Get(ctx context.Context, req *gnmi.GetRequest, _ ...grpc.CallOption) (*gnmi.GetResponse, error) {
+	f.mu.Lock()
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	f.mu.Unlock()
+
+	var ctxErr error
+	select {
+	case <-f.getDone():
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+	f.getReqs = append(f.getReqs, req)
+	if ctxErr != nil {
+		return nil, ctxErr
+	}
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	if f.getResp == nil {
+		return &gnmi.GetResponse{}, nil
+	}
+	return f.getResp, nil
+}
+
+// getRequests returns the recorded Get requests.
+func (f *fakeGNMIClient) getRequests() []*gnmi.GetRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*gnmi.GetRequest{}, f.getReqs...)
+}
+
+// withFakeGNMI sets the Agent gNMI target to one using a fake gNMI client.
+func withFakeGNMI(a *Agent) *fakeGNMIClient {
+	c := &fakeGNMIClient{}
+	a.GnmiTarget = &target.Target{Config: &types.TargetConfig{}, Client: c}
+	return c
+}
+
+func TestNewSetRequestFromConfig(t *testing.T) {
+	mirror := func(p string) string { return strings.Replace(p, "/greeter", "/mirror", 1) }
+
+	tests := map[string]struct {
+		input      *ConfigNotification
+		transform  func(string) string
+		wantUpdate string
+		wantDelete string
+		wantVal    string
+		wantErr    error
+	}{
+		"Create": {
+			input:      &ConfigNotification{Op: "Create", Path: "/greeter", Json: `{"name":"bond"}`},
+			transform:  mirror,
+			wantUpdate: "/mirror",
+			wantVal:    `{"name":"bond"}`,
+		},
+		"Update list entry": {
+			input:      &ConfigNotification{Op: "Update", Path: "/greeter/list-node[name=entry1]", Json: `{"value":1}`},
+			transform:  mirror,
+			wantUpdate: "/mirror/list-node[name=entry1]",
+			wantVal:    `{"value":1}`,
+		},
+		"Delete": {
+			input:      &ConfigNotification{Op: "Delete", Path: "/greeter/list-node[name=entry1]"},
+			transform:  mirror,
+			wantDelete: "/mirror/list-node[name=entry1]",
+		},
+		"Nil transform": {
+			input:      &ConfigNotification{Op: "Delete", Path: "/greeter"},
+			wantDelete: "/greeter",
+		},
+		"Commit end": {
+			input:   &ConfigNotification{Op: "Create", Path: commitEndKeyPath, Json: `{"commit_seq":1}`},
+			wantErr: ErrConfigNotSettable,
+		},
+		"Update without json": {
+			input:   &ConfigNotification{Op: "Update", Path: "/greeter"},
+			wantErr: ErrorEmptyValue,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := NewSetRequestFromConfig(tt.input, tt.transform)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NewSetRequestFromConfig() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSetRequestFromConfig() returned error: %v", err)
+			}
+
+			if tt.wantUpdate != "" {
+				if len(req.GetUpdate()) != 1 || len(req.GetDelete()) != 0 {
+					t.Fatalf("SetRequest = %v, want a single update", req)
+				}
+				if got := "/" + path.GnmiPathToXPath(req.GetUpdate()[0].GetPath(), false); got != tt.wantUpdate {
+					t.Errorf("update path = %s, want %s", got, tt.wantUpdate)
+				}
+				if got := string(req.GetUpdate()[0].GetVal().GetJsonIetfVal()); got != tt.wantVal {
+					t.Errorf("update value = %s, want %s", got, tt.wantVal)
+				}
+			}
+			if tt.wantDelete != "" {
+				if len(req.GetDelete()) != 1 || len(req.GetUpdate()) != 0 {
+					t.Fatalf("SetRequest = %v, want a single delete", req)
+				}
+				if got := "/" + path.GnmiPathToXPath(req.GetDelete()[0], false); got != tt.wantDelete {
+					t.Errorf("delete path = %s, want %s", got, tt.wantDelete)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSetUpdateRequestJSON(t *testing.T) {
+	type greeter struct {
+		Name  string `json:"name"`
+		Count int    `json:"count,omitempty"`
+	}
+
+	tests := map[string]struct {
+		v       any
+		wantVal string
+		wantErr bool
+	}{
+		"Struct": {
+			v:       greeter{Name: "bond", Count: 2},
+			wantVal: `{"name":"bond","count":2}`,
+		},
+		"Omitted field": {
+			v:       &greeter{Name: "bond"},
+			wantVal: `{"name":"bond"}`,
+		},
+		"Map": {
+			v:       map[string]string{"name": "bond"},
+			wantVal: `{"name":"bond"}`,
+		},
+		"Nil value": {
+			wantErr: true,
+		},
+		"Unsupported value": {
+			v:       make(chan int),
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := NewSetUpdateRequestJSON("/greeter", tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSetUpdateRequestJSON() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(req.GetUpdate()) != 1 {
+				t.Fatalf("SetRequest = %v, want a single update", req)
+			}
+			upd := req.GetUpdate()[0]
+			if got := "/" + path.GnmiPathToXPath(upd.GetPath(), false); got != "/greeter" {
+				t.Errorf("update path = %s, want /greeter", got)
+			}
+			if got := string(upd.GetVal().GetJsonIetfVal()); got != tt.wantVal {
+				t.Errorf("update value = %s, want %s", got, tt.wantVal)
+			}
+		})
+	}
+}
+
+// jsonIetfUpdate returns a gNMI update of path with a JSON IETF value.
+func jsonIetfUpdate(t *testing.T, p, val string) *gnmi.Update {
+	t.Helper()
+	gp, err := path.ParsePath(p)
+	if err != nil {
+		t.Fatalf("failed to parse path %s: %v", p, err)
+	}
+	return &gnmi.Update{
+		Path: gp,
+		Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: []byte(val)}},
+	}
+}
+
+func TestDiscoverGrpcServerName(t *testing.T) {
+	errRefused := errors.New("connection refused")
+
+	tests := map[string]struct {
+		updates  []string // pairs of path and value
+		getErr   error
+		wantName string
+		wantErr  error
+	}{
+		"List entries": {
+			updates: []string{
+				"/system/grpc-server[name=mgmt]", `{"tls-profile": "clab-profile", "unix-socket": {"admin-state": "enable"}}`,
+				"/system/grpc-server[name=ndk-gnmi]", `{"admin-state": "enable", "unix-socket": {"admin-state": "enable"}}`,
+			},
+			wantName: "ndk-gnmi",
+		},
+		"Container with module prefixes": {
+			updates: []string{
+				"/system", `{"srl_nokia-grpc:grpc-server": [
+					{"name": "mgmt", "tls-profile": "clab-profile", "unix-socket": {"admin-state": "enable"}},
+					{"name": "insecure-ndk", "unix-socket": {"admin-state": "disable"}},
+					{"name": "ndk-gnmi", "unix-socket": {"admin-state": "enable"}}
+				]}`,
+			},
+			wantName: "ndk-gnmi",
+		},
+		"No insecure unix socket": {
+			updates: []string{
+				"/system/grpc-server[name=mgmt]", `{"tls-profile": "clab-profile", "unix-socket": {"admin-state": "enable"}}`,
+				"/system/grpc-server[name=insecure-ndk]", `{"unix-socket": {"admin-state": "disable"}}`,
+			},
+			wantErr: ErrGrpcServerNotFound,
+		},
+		"Get failure": {
+			getErr:  errRefused,
+			wantErr: errRefused,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			gnmiClient := withFakeGNMI(a)
+			gnmiClient.getErr = tt.getErr
+			n := &gnmi.Notification{}
+			for i := 0; i < len(tt.updates); i += 2 {
+				n.Update = append(n.Update, jsonIetfUpdate(t, tt.updates[i], tt.updates[i+1]))
+			}
+			gnmiClient.getResp = &gnmi.GetResponse{Notification: []*gnmi.Notification{n}}
+
+			got, err := a.discoverGrpcServerName()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("discoverGrpcServerName() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("discoverGrpcServerName() returned error: %v", err)
+			}
+			if got != tt.wantName {
+				t.Errorf("discoverGrpcServerName() = %s, want %s", got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestUseDiscoveredGrpcServerFallback(t *testing.T) {
+	a := newTestAgent(t, WithGrpcServerName("ndk-gnmi"))
+	gnmiClient := withFakeGNMI(a)
+	gnmiClient.getErr = errors.New("connection refused")
+	gnmiTarget := a.GnmiTarget
+
+	if err := a.useDiscoveredGrpcServer(); err != nil {
+		t.Errorf("useDiscoveredGrpcServer() returned error: %v", err)
+	}
+
+	if a.grpcServerName != "ndk-gnmi" {
+		t.Errorf("grpc-server name = %s, want ndk-gnmi", a.grpcServerName)
+	}
+	if a.GnmiTarget != gnmiTarget {
+		t.Errorf("gNMI target was recreated after failed discovery")
+	}
+}
+
+func TestWithGNMIConcurrency(t *testing.T) {
+	const limit = 3
+	const calls = 20
+
+	a := newTestAgent(t, WithGNMIConcurrency(limit))
+	gnmiClient := withFakeGNMI(a)
+	gnmiClient.getBlock = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.GetWithGNMI(&gnmi.GetRequest{}); err != nil {
+				t.Errorf("GetWithGNMI() returned error: %v", err)
+			}
+		}()
+	}
+
+	// limit calls reach the gNMI server, the others wait for them
+	deadline := time.Now().Add(time.Second)
+	for gnmiClient.getsInFlight() < limit && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := gnmiClient.getsInFlight(); got != limit {
+		t.Errorf("%d Get calls in flight, want %d", got, limit)
+	}
+
+	close(gnmiClient.getBlock)
+	wg.Wait()
+
+	if got := len(gnmiClient.getRequests()); got != calls {
+		t.Errorf("Get called %d times, want %d", got, calls)
+	}
+	if gnmiClient.maxInFlight != limit {
+		t.Errorf("%d concurrent Get calls, want %d", gnmiClient.maxInFlight, limit)
+	}
+}
+
+func TestFetchConfig(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	const niPath = "/network-instance[name=default]"
+
+	tests := map[string]struct {
+		xpath   string
+		updates []string // pairs of path and value
+		getErr  error
+		want    string
+		wantErr error
+	}{
+		"Config found": {
+			xpath:   niPath,
+			updates: []string{niPath, `{"type": "srl_nokia-network-instance:default"}`},
+			want:    `{"type": "srl_nokia-network-instance:default"}`,
+		},
+		"No config": {
+			xpath: niPath,
+		},
+		"Get failure": {
+			xpath:   niPath,
+			getErr:  errRefused,
+			wantErr: errRefused,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			gnmiClient := withFakeGNMI(a)
+			gnmiClient.getErr = tc.getErr
+			n := &gnmi.Notification{}
+			for i := 0; i+1 < len(tc.updates); i += 2 {
+				n.Update = append(n.Update, jsonIetfUpdate(t, tc.updates[i], tc.updates[i+1]))
+			}
+			gnmiClient.getResp = &gnmi.GetResponse{Notification: []*gnmi.Notification{n}}
+
+			got, err := a.FetchConfig(tc.xpath)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("FetchConfig() error = %v, want %v", err, tc.wantErr)
+			}
+			if string(got) != tc.want {
+				t.Errorf("FetchConfig() = %s, want %s", got, tc.want)
+			}
+
+			reqs := gnmiClient.getRequests()
+			if len(reqs) != 1 {
+				t.Fatalf("got %d Get requests, want 1", len(reqs))
+			}
+			req := reqs[0]
+			if req.GetEncoding() != gnmi.Encoding_JSON_IETF {
+				t.Errorf("Get encoding = %v, want JSON_IETF", req.GetEncoding())
+			}
+			if req.GetType() != gnmi.GetRequest_CONFIG {
+				t.Errorf("Get type = %v, want CONFIG", req.GetType())
+			}
+			elems := req.GetPath()[0].GetElem()
+			if len(elems) != 1 || elems[0].GetName() != "network-instance" || elems[0].GetKey()["name"] != "default" {
+				t.Errorf("Get path = %v, want %s", req.GetPath()[0], tc.xpath)
+			}
+		})
+	}
+}
+
+func TestGetState(t *testing.T) {
+	const entryPath = "/greeter/list-node[name=entry1]"
+
+	tests := map[string]struct {
+		state   string // state value returned by gNMI, no update if empty
+		getErr  error
+		want    string
+		wantErr error
+	}{
+		"State found": {
+			state: `{"value": 1, "last-greeted": "now"}`,
+			want:  `{"value": 1, "last-greeted": "now"}`,
+		},
+		"No state": {},
+		"Get failure": {
+			getErr:  ErrNotConnected,
+			wantErr: ErrNotConnected,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			gnmiClient := withFakeGNMI(a)
+			gnmiClient.getErr = tc.getErr
+			n := &gnmi.Notification{}
+			if tc.state != "" {
+				n.Update = append(n.Update, jsonIetfUpdate(t, entryPath, tc.state))
+			}
+			gnmiClient.getResp = &gnmi.GetResponse{Notification: []*gnmi.Notification{n}}
+
+			got, err := a.GetState(entryPath)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("GetState() error = %v, want %v", err, tc.wantErr)
+			}
+			if string(got) != tc.want {
+				t.Errorf("GetState() = %s, want %s", got, tc.want)
+			}
+
+			reqs := gnmiClient.getRequests()
+			if len(reqs) != 1 {
+				t.Fatalf("got %d Get requests, want 1", len(reqs))
+			}
+			if reqs[0].GetType() != gnmi.GetRequest_STATE {
+				t.Errorf("Get type = %v, want STATE", reqs[0].GetType())
+			}
+			if reqs[0].GetEncoding() != gnmi.Encoding_JSON_IETF {
+				t.Errorf("Get encoding = %v, want JSON_IETF", reqs[0].GetEncoding())
+			}
+		})
+	}
+}
+
+func TestGetConfigWithGNMITruncated(t *testing.T) {
+	const appPath = "/greeter"
+
+	tests := map[string]struct {
+		notifications [][]string // pairs of path and value per notification
+		wantConfig    string
+		wantTruncated bool
+	}{
+		"Single update": {
+			notifications: [][]string{{appPath, `{"name": "me"}`}},
+			wantConfig:    `{"name": "me"}`,
+		},
+		"Multiple notifications": {
+			notifications: [][]string{
+				{appPath, `{"name": "me"}`},
+				{appPath, `{"name": "you"}`},
+			},
+			wantConfig:    `{"name": "me"}`,
+			wantTruncated: true,
+		},
+		"Multiple updates": {
+			notifications: [][]string{{appPath, `{"name": "me"}`, appPath, `{"name": "you"}`}},
+			wantConfig:    `{"name": "me"}`,
+			wantTruncated: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &syncBuffer{}
+			logger := zerolog.New(buf)
+			a := newTestAgent(t, WithLogger(&logger))
+			a.appRootPath = appPath
+			a.Notifications.FullConfigTruncated = true
+			gnmiClient := withFakeGNMI(a)
+			resp := &gnmi.GetResponse{}
+			for _, updates := range tc.notifications {
+				n := &gnmi.Notification{}
+				for i := 0; i+1 < len(updates); i += 2 {
+					n.Update = append(n.Update, jsonIetfUpdate(t, updates[i], updates[i+1]))
+				}
+				resp.Notification = append(resp.Notification, n)
+			}
+			gnmiClient.getResp = resp
+
+			a.getConfigWithGNMI()
+
+			if string(a.Notifications.FullConfig) != tc.wantConfig {
+				t.Errorf("FullConfig = %s, want %s", a.Notifications.FullConfig, tc.wantConfig)
+			}
+			if a.Notifications.FullConfigTruncated != tc.wantTruncated {
+				t.Errorf("FullConfigTruncated = %t, want %t", a.Notifications.FullConfigTruncated, tc.wantTruncated)
+			}
+			warned := strings.Contains(buf.String(), `"level":"warn"`)
+			if warned != tc.wantTruncated {
+				t.Errorf("warning logged = %t, want %t, log: %s", warned, tc.wantTruncated, buf.String())
+			}
+		})
+	}
+}
+
+func TestGetConfigWithGNMITimeout(t *testing.T) {
+	buf := &syncBuffer{}
+	logger := zerolog.New(buf)
+	a := newTestAgent(t, WithLogger(&logger), WithAppRootPath("/greeter"),
+		WithGNMITimeout(50*time.Millisecond))
+	a.Notifications.FullConfig = []byte(`{"name": "me"}`)
+	gnmiClient := withFakeGNMI(a)
+	gnmiClient.getDelay = 5 * time.Second
+
+	start := time.Now()
+	a.getConfigWithGNMI()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get took %s, want it cancelled after the gNMI timeout", elapsed)
+	}
+
+	if a.Notifications.FullConfig != nil {
+		t.Errorf("FullConfig = %s, want nil", a.Notifications.FullConfig)
+	}
+	log := buf.String()
+	if !strings.Contains(log, `"level":"warn"`) || !strings.Contains(log, context.DeadlineExceeded.Error()) {
+		t.Errorf("Get error not logged as warning, log: %s", log)
+	}
+}
+
+func TestWithGNMITarget(t *testing.T) {
+	const appPath = "/greeter"
+	gnmiClient := &fakeGNMIClient{getResp: &gnmi.GetResponse{Notification: []*gnmi.Notification{{
+		Update: []*gnmi.Update{jsonIetfUpdate(t, appPath, `{"name": "me"}`)},
+	}}}}
+	tg := &target.Target{Config: &types.TargetConfig{}, Client: gnmiClient}
+	a := newTestAgent(t, WithGNMITarget(tg), WithAppRootPath(appPath))
+
+	// Start keeps the provided target
+	a.startGNMI()
+	if a.GnmiTarget != tg {
+		t.Fatalf("GnmiTarget = %v, want provided target", a.GnmiTarget)
+	}
+
+	a.getConfigWithGNMI()
+
+	if string(a.Notifications.FullConfig) != `{"name": "me"}` {
+		t.Errorf("FullConfig = %s, want %s", a.Notifications.FullConfig, `{"name": "me"}`)
+	}
+	reqs := gnmiClient.getRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("gNMI Get called %d times, want 1", len(reqs))
+	}
+	if got := path.GnmiPathToXPath(reqs[0].GetPath()[0], false); got != "greeter" {
+		t.Errorf("Get request path = %s, want greeter", got)
+	}
+}
+
+func TestWithGNMITargetNil(t *testing.T) {
+	if err := WithGNMITarget(nil)(&Agent{}); err == nil {
+		t.Error("WithGNMITarget(nil) returned nil error")
+	}
+}
+
+func TestWithReadOnlyGNMI(t *testing.T) {
+	a := newTestAgent(t, WithReadOnlyGNMI())
+	// the fake client panics on Set, as Set is not overridden
+	gnmiClient := withFakeGNMI(a)
+
+	req, err := NewSetUpdateRequest("/greeter/name", api.Value("bond", "json_ietf"))
+	if err != nil {
+		t.Fatalf("NewSetUpdateRequest() returned error: %v", err)
+	}
+	if _, err := a.SetWithGNMI(req); !errors.Is(err, ErrReadOnlyGNMI) {
+		t.Errorf("SetWithGNMI() error = %v, want %v", err, ErrReadOnlyGNMI)
+	}
+
+	if _, err := a.GetWithGNMI(&gnmi.GetRequest{}); err != nil {
+		t.Errorf("GetWithGNMI() returned error: %v", err)
+	}
+	if got := len(gnmiClient.getRequests()); got != 1 {
+		t.Errorf("Get called %d times, want 1", got)
+	}
+}
+
+func TestSubscribeWithGNMICancel(t *testing.T) {
+	a := newTestAgent(t)
+	gnmiClient := withFakeGNMI(a)
+
+	req := &gnmi.SubscribeRequest{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, cancelFirst, err := a.SubscribeWithGNMI(ctx, req)
+	if err != nil {
+		t.Fatalf("SubscribeWithGNMI() returned error: %v", err)
+	}
+	defer cancelFirst()
+	second, cancelSecond, err := a.SubscribeWithGNMI(ctx, req)
+	if err != nil {
+		t.Fatalf("SubscribeWithGNMI() returned error: %v", err)
+	}
+	defer cancelSecond()
+
+	update := func(ts int64) *gnmi.SubscribeResponse {
+		return &gnmi.SubscribeResponse{
+			Response: &gnmi.SubscribeResponse_Update{Update: &gnmi.Notification{Timestamp: ts}},
+		}
+	}
+
+	gnmiClient.subscribeStream(0).responses <- update(1)
+	if resp := <-first; resp.GetUpdate().GetTimestamp() != 1 {
+		t.Errorf("first subscription received %v, want timestamp 1", resp)
+	}
+
+	cancelFirst()
+	select {
+	case resp, ok := <-first:
+		if ok {
+			t.Errorf("cancelled subscription received %v, want closed channel", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled subscription channel was not closed")
+	}
+	if gnmiClient.subscribeStream(0).ctx.Err() == nil {
+		t.Error("cancelled subscription stream was not torn down")
+	}
+	if gnmiClient.subscribeStream(1).ctx.Err() != nil {
+		t.Error("second subscription stream was torn down")
+	}
+
+	gnmiClient.subscribeStream(1).responses <- update(2)
+	if resp := <-second; resp.GetUpdate().GetTimestamp() != 2 {
+		t.Errorf("second subscription received %v, want timestamp 2", resp)
+	}
+}
+
+func TestNewSubscribeRequest(t *testing.T) {
+	tests := map[string]struct {
+		paths        []string
+		mode         gnmi.SubscriptionList_Mode
+		opts         []api.GNMIOption
+		wantPaths    []string
+		wantEncoding gnmi.Encoding
+		wantErr      error
+	}{
+		"ONCE subscription": {
+			paths:     []string{"/interface[name=ethernet-1/1]/statistics", "/system/name"},
+			mode:      gnmi.SubscriptionList_ONCE,
+			wantPaths: []string{"interface/statistics", "system/name"},
+		},
+		"STREAM subscription with encoding": {
+			paths:        []string{"/interface[name=ethernet-1/1]/statistics"},
+			mode:         gnmi.SubscriptionList_STREAM,
+			opts:         []api.GNMIOption{api.EncodingJSON_IETF()},
+			wantPaths:    []string{"interface/statistics"},
+			wantEncoding: gnmi.Encoding_JSON_IETF,
+		},
+		"No paths": {
+			mode:    gnmi.SubscriptionList_STREAM,
+			wantErr: ErrorEmptyPaths,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := NewSubscribeRequest(tt.paths, tt.mode, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewSubscribeRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			list := req.GetSubscribe()
+			if list.GetMode() != tt.mode {
+				t.Errorf("mode = %s, want %s", list.GetMode(), tt.mode)
+			}
+			if list.GetEncoding() != tt.wantEncoding {
+				t.Errorf("encoding = %s, want %s", list.GetEncoding(), tt.wantEncoding)
+			}
+			var got []string
+			for _, s := range list.GetSubscription() {
+				var elems []string
+				for _, e := range s.GetPath().GetElem() {
+					elems = append(elems, e.GetName())
+				}
+				got = append(got, strings.Join(elems, "/"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantPaths, ",") {
+				t.Errorf("subscription paths = %v, want %v", got, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestSubscribeWithGNMI(t *testing.T) {
+	update := &gnmi.SubscribeResponse{
+		Response: &gnmi.SubscribeResponse_Update{Update: &gnmi.Notification{Timestamp: 1}},
+	}
+	syncResponse := &gnmi.SubscribeResponse{
+		Response: &gnmi.SubscribeResponse_SyncResponse{SyncResponse: true},
+	}
+
+	tests := map[string]struct {
+		mode gnmi.SubscriptionList_Mode
+		// end ends the subscription after the responses were received.
+		end func(s *fakeSubscribeClient, cancel context.CancelFunc)
+	}{
+		// the server ends ONCE subscriptions after the sync response
+		"ONCE subscription": {
+			mode: gnmi.SubscriptionList_ONCE,
+			end:  func(s *fakeSubscribeClient, _ context.CancelFunc) { close(s.responses) },
+		},
+		"STREAM subscription": {
+			mode: gnmi.SubscriptionList_STREAM,
+			end:  func(_ *fakeSubscribeClient, cancel context.CancelFunc) { cancel() },
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			gnmiClient := withFakeGNMI(a)
+
+			req, err := NewSubscribeRequest([]string{"/interface/statistics"}, tt.mode)
+			if err != nil {
+				t.Fatalf("NewSubscribeRequest() returned error: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			responses, stop, err := a.SubscribeWithGNMI(ctx, req)
+			if err != nil {
+				t.Fatalf("SubscribeWithGNMI() returned error: %v", err)
+			}
+			defer stop()
+
+			stream := gnmiClient.subscribeStream(0)
+			if stream.req != req {
+				t.Errorf("sent request %v, want %v", stream.req, req)
+			}
+			for _, want := range []*gnmi.SubscribeResponse{update, syncResponse} {
+				stream.responses <- want
+				if got := <-responses; got != want {
+					t.Errorf("received %v, want %v", got, want)
+				}
+			}
+
+			tt.end(stream, cancel)
+			select {
+			case resp, ok := <-responses:
+				if ok {
+					t.Errorf("ended subscription received %v, want closed channel", resp)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("ended subscription channel was not closed")
+			}
+		})
+	}
+}
+
+func TestWithGNMITLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, cert, key := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for _, f := range []string{ca, cert, key} {
+		if err := os.WriteFile(f, nil, 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", f, err)
+		}
+	}
+
+	tests := map[string]struct {
+		opts         []Option
+		wantInsecure bool
+		wantCA       string
+		wantCert     string
+		wantKey      string
+		wantSkip     bool
+		wantUser     string
+	}{
+		"Insecure by default": {
+			wantInsecure: true,
+			wantUser:     defaultUsername,
+		},
+		"CA only": {
+			opts:     []Option{WithGNMITLS(ca, "", "", false)},
+			wantCA:   ca,
+			wantUser: defaultUsername,
+		},
+		"Mutual TLS with credentials": {
+			opts:     []Option{WithGNMITLS(ca, cert, key, true), WithGNMICredentials("bond", "secret")},
+			wantCA:   ca,
+			wantCert: cert,
+			wantKey:  key,
+			wantSkip: true,
+			wantUser: "bond",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tt.opts...)
+			tg, err := api.NewTarget(a.gnmiTargetOptions()...)
+			if err != nil {
+				t.Fatalf("NewTarget() returned error: %v", err)
+			}
+
+			c := tg.Config
+			if got := c.Insecure != nil && *c.Insecure; got != tt.wantInsecure {
+				t.Errorf("insecure = %t, want %t", got, tt.wantInsecure)
+			}
+			if got := c.SkipVerify != nil && *c.SkipVerify; got != tt.wantSkip {
+				t.Errorf("skip verify = %t, want %t", got, tt.wantSkip)
+			}
+			for field, f := range map[string]struct {
+				got  *string
+				want string
+			}{
+				"CA":       {c.TLSCA, tt.wantCA},
+				"cert":     {c.TLSCert, tt.wantCert},
+				"key":      {c.TLSKey, tt.wantKey},
+				"username": {c.Username, tt.wantUser},
+			} {
+				got := ""
+				if f.got != nil {
+					got = *f.got
+				}
+				if got != f.want {
+					t.Errorf("%s = %q, want %q", field, got, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewGNMITargetTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(ca, nil, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", ca, err)
+	}
+	// the gNMI client dial fails or blocks until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	a := newTestAgent(t, WithContext(ctx, cancel),
+		WithGNMIAddress("127.0.0.1:57400"), WithGNMITLS(ca, "", "", true))
+
+	if err := a.newGNMITarget(); !errors.Is(err, ErrGNMITargetFailed) {
+		t.Fatalf("newGNMITarget() error = %v, want %v", err, ErrGNMITargetFailed)
+	}
+
+	c := a.GnmiTarget.Config
+	if c.Address != "127.0.0.1:57400" {
+		t.Errorf("target address = %s, want 127.0.0.1:57400", c.Address)
+	}
+	if c.Insecure != nil && *c.Insecure {
+		t.Errorf("target is insecure, want TLS")
+	}
+	if c.TLSCA == nil || *c.TLSCA != ca {
+		t.Errorf("target TLS CA = %v, want %s", c.TLSCA, ca)
+	}
+	if c.SkipVerify == nil || !*c.SkipVerify {
+		t.Errorf("target skip verify = %v, want true", c.SkipVerify)
+	}
+}
+
+func TestWithGNMIAddress(t *testing.T) {
+	tests := map[string]struct {
+		opts []Option
+		want string
+	}{
+		"grpc-server unix socket by default": {
+			opts: []Option{WithGrpcServerName("mgmt")},
+			want: grpcServerUnixSocketPrefix + "mgmt",
+		},
+		"Address": {
+			opts: []Option{WithGrpcServerName("mgmt"), WithGNMIAddress("127.0.0.1:57400")},
+			want: "127.0.0.1:57400",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tt.opts...)
+			tg, err := api.NewTarget(a.gnmiTargetOptions()...)
+			if err != nil {
+				t.Fatalf("NewTarget() returned error: %v", err)
+			}
+			if tg.Config.Address != tt.want {
+				t.Errorf("target address = %s, want %s", tg.Config.Address, tt.want)
+			}
+		})
+	}
+
+	if err := WithGNMIAddress("")(&Agent{}); err == nil {
+		t.Error("WithGNMIAddress(\"\") returned nil error")
+	}
+}
+
+func TestWithGNMICredentials(t *testing.T) {
+	a := newTestAgent(t, WithGNMICredentials("bond", ""))
+	if a.gnmiUsername != "bond" || a.gnmiPassword != "" {
+		t.Errorf("gNMI credentials = %s/%s, want bond/", a.gnmiUsername, a.gnmiPassword)
+	}
+	if err := WithGNMICredentials("", "secret")(&Agent{}); err == nil {
+		t.Error("WithGNMICredentials() with empty username returned nil error")
+	}
+}
+
+func TestWithGNMITLSInvalid(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(cert, nil, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", cert, err)
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	for name, tt := range map[string]struct {
+		opt     Option
+		wantMsg string
+	}{
+		"Missing CA file":  {opt: WithGNMITLS(missing, "", "", false), wantMsg: "CA file"},
+		"Missing key file": {opt: WithGNMITLS("", cert, missing, false), wantMsg: "key file"},
+		"Cert without key": {opt: WithGNMITLS("", cert, "", false), wantMsg: "must be set together"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tt.opt(&Agent{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("WithGNMITLS() error = %v, want error containing %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestWithGNMITimeout(t *testing.T) {
+	tests := map[string]struct {
+		opts []Option
+		want time.Duration
+	}{
+		"Default timeout": {
+			want: defaultGNMITimeout,
+		},
+		"Custom timeout": {
+			opts: []Option{WithGNMITimeout(30 * time.Second)},
+			want: 30 * time.Second,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tt.opts...)
+			tg, err := api.NewTarget(a.gnmiTargetOptions()...)
+			if err != nil {
+				t.Fatalf("NewTarget() returned error: %v", err)
+			}
+			if tg.Config.Timeout != tt.want {
+				t.Errorf("target timeout = %s, want %s", tg.Config.Timeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithGNMITimeoutInvalid(t *testing.T) {
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if err := WithGNMITimeout(timeout)(&Agent{}); err == nil {
+			t.Errorf("WithGNMITimeout(%s) returned no error", timeout)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
 // ReceiveInterfaceNotifications starts an interface notification stream
@@ -12,66 +11,54 @@ import (
 // If the main execution intends to continue running after calling this method,
 // it should be called as a goroutine.
 // `Interface` chan carries values of type ndk.InterfaceNotification.
+// Received notifications are also stored in the interface cache,
+// which can be queried with Interface.
+// NDK interface notifications carry no subinterface data,
+// apps tracking subinterfaces can read them with gNMI, e.g.
+// GetState("/interface[name=ethernet-1/1]/subinterface[index=0]").
 func (a *Agent) ReceiveInterfaceNotifications(ctx context.Context) {
+	if !a.startReceiving(NotificationTypeInterface) {
+		return
+	}
 	defer close(a.Notifications.Interface)
-	intfStream := a.startInterfaceNotificationStream(ctx)
-
-	for intfStreamResp := range intfStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(intfStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("Interface notification Marshal failed: %+v", err)
-			continue
-		}
 
-		a.logger.Info().
-			Msgf("Received Interface notifications:\n%s", b)
-
-		for _, n := range intfStreamResp.GetNotification() {
-			intfNotif := n.GetIntf()
-			if intfNotif == nil {
-				a.logger.Info().
-					Msgf("Empty interface notification:%+v", n)
-				continue
+	subscribe(ctx, a, NotificationTypeInterface,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_Intf{
+				Intf: &ndk.InterfaceSubscriptionRequest{},
 			}
-			a.Notifications.Interface <- intfNotif
-		}
-	}
-}
-
-// startInterfaceNotificationStream starts a notification stream for Intf service notifications.
-func (a *Agent) startInterfaceNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
-
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("Interface notification stream created")
-
-	a.addIntfSubscription(ctx, streamID)
-
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"interface", streamChan)
-
-	return streamChan
+		},
+		(*ndk.Notification).GetIntf,
+		func(n *ndk.InterfaceNotification) {
+			a.cacheInterface(n)
+			sendNotification(ctx, a, NotificationTypeInterface, a.Notifications.Interface, n)
+		})
 }
 
-// addIntfSubscription adds a subscription for Interface service notifications
-// to the allocated notification stream.
-func (a *Agent) addIntfSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for Intf service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
-		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_Intf{ // intf service
-			Intf: &ndk.InterfaceSubscriptionRequest{},
-		},
+// cacheInterface stores the interface notification n in the interface cache
+// keyed by interface name.
+// Delete notifications evict the cached entry of the interface.
+func (a *Agent) cacheInterface(n *ndk.InterfaceNotification) {
+	name := n.GetKey().GetIfName()
+	if name == "" {
+		return
+	}
+	if n.GetOp() == ndk.SdkMgrOperation_Delete {
+		a.interfaces.delete(name)
+		return
 	}
+	a.interfaces.set(name, n)
+}
 
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
+// Interface returns the last interface notification of interface name,
+// e.g. ethernet-1/1, from the interface cache.
+// The cache is populated by ReceiveInterfaceNotifications.
+// false is returned if no notification was received for the interface
+// or the interface was deleted.
+func (a *Agent) Interface(name string) (*ndk.InterfaceNotification, bool) {
+	n, ok := a.interfaces.get(name)
+	if !ok {
+		return nil, false
 	}
+	return cloneProto(n), true
 }
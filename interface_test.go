@@ -0,0 +1,93 @@
+package bond
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func interfaceNotification(op ndk.SdkMgrOperation, name string, mtu uint32) *ndk.Notification {
+	n := &ndk.InterfaceNotification{
+		Op:  op,
+		Key: &ndk.InterfaceKey{IfName: name},
+	}
+	if op != ndk.SdkMgrOperation_Delete {
+		n.Data = &ndk.InterfaceData{Mtu: mtu}
+	}
+	return &ndk.Notification{SubscriptionTypes: &ndk.Notification_Intf{Intf: n}}
+}
+
+func TestInterfaceCache(t *testing.T) {
+	tests := map[string]struct {
+		notifications []*ndk.Notification
+		lookup        string
+		wantFound     bool
+		wantMtu       uint32
+	}{
+		"Added interface": {
+			notifications: []*ndk.Notification{
+				interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500),
+				interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/2", 9000),
+			},
+			lookup:    "ethernet-1/1",
+			wantFound: true,
+			wantMtu:   1500,
+		},
+		"Updated interface": {
+			notifications: []*ndk.Notification{
+				interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500),
+				interfaceNotification(ndk.SdkMgrOperation_Update, "ethernet-1/1", 9000),
+			},
+			lookup:    "ethernet-1/1",
+			wantFound: true,
+			wantMtu:   9000,
+		},
+		"Deleted interface": {
+			notifications: []*ndk.Notification{
+				interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500),
+				interfaceNotification(ndk.SdkMgrOperation_Delete, "ethernet-1/1", 0),
+			},
+			lookup: "ethernet-1/1",
+		},
+		"Other interface deleted": {
+			notifications: []*ndk.Notification{
+				interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500),
+				interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/2", 1500),
+				interfaceNotification(ndk.SdkMgrOperation_Delete, "ethernet-1/2", 0),
+			},
+			lookup:    "ethernet-1/1",
+			wantFound: true,
+			wantMtu:   1500,
+		},
+		"Unknown interface": {
+			notifications: []*ndk.Notification{
+				interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500),
+			},
+			lookup: "ethernet-1/3",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			withFakeStream(a, tt.notifications...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.ReceiveInterfaceNotifications(ctx)
+
+			for range tt.notifications {
+				<-a.Notifications.Interface
+			}
+
+			n, ok := a.Interface(tt.lookup)
+			if ok != tt.wantFound {
+				t.Fatalf("Interface(%s) found = %t, want %t", tt.lookup, ok, tt.wantFound)
+			}
+			if ok && n.GetData().GetMtu() != tt.wantMtu {
+				t.Errorf("Interface(%s) mtu = %d, want %d", tt.lookup, n.GetData().GetMtu(), tt.wantMtu)
+			}
+		})
+	}
+}
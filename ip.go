@@ -0,0 +1,32 @@
+package bond
+
+import (
+	"net/netip"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+// AddrFromNDK converts an NDK IP address to a netip.Addr.
+// 4-byte addresses are converted to IPv4 addresses
+// and 16-byte addresses to IPv6 addresses,
+// so IPv4-mapped IPv6 addresses (e.g. ::ffff:192.0.2.1) stay mapped,
+// use netip.Addr.Unmap to convert them to IPv4.
+// false is returned if addr is nil or not 4 or 16 bytes long.
+func AddrFromNDK(addr *ndk.IpAddressPb) (netip.Addr, bool) {
+	return netip.AddrFromSlice(addr.GetAddr())
+}
+
+// NDKFromAddr converts a netip.Addr to an NDK IP address.
+// Like WithIpPrefix, IPv4 and IPv4-mapped IPv6 addresses
+// are encoded in the 4-byte form and IPv6 addresses in the 16-byte form.
+// The IPv6 zone is dropped as NDK addresses have no zone.
+// nil is returned if addr is the zero Addr.
+func NDKFromAddr(addr netip.Addr) *ndk.IpAddressPb {
+	if !addr.IsValid() {
+		return nil
+	}
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+	}
+	return &ndk.IpAddressPb{Addr: addr.AsSlice()}
+}
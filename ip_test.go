@@ -0,0 +1,108 @@
+package bond
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func TestAddrFromNDK(t *testing.T) {
+	tests := map[string]struct {
+		input    *ndk.IpAddressPb
+		want     netip.Addr
+		wantOk   bool
+		wantIPv4 bool
+	}{
+		"IPv4": {
+			input:    &ndk.IpAddressPb{Addr: []byte{192, 0, 2, 1}},
+			want:     netip.MustParseAddr("192.0.2.1"),
+			wantOk:   true,
+			wantIPv4: true,
+		},
+		"IPv6": {
+			input:  &ndk.IpAddressPb{Addr: netip.MustParseAddr("2001:db8::1").AsSlice()},
+			want:   netip.MustParseAddr("2001:db8::1"),
+			wantOk: true,
+		},
+		"IPv4-mapped IPv6": {
+			input:  &ndk.IpAddressPb{Addr: netip.MustParseAddr("::ffff:192.0.2.1").AsSlice()},
+			want:   netip.MustParseAddr("::ffff:192.0.2.1"),
+			wantOk: true,
+		},
+		"IPv4 unspecified": {
+			input:    &ndk.IpAddressPb{Addr: make([]byte, 4)},
+			want:     netip.IPv4Unspecified(),
+			wantOk:   true,
+			wantIPv4: true,
+		},
+		"Nil address": {},
+		"Empty address": {
+			input: &ndk.IpAddressPb{},
+		},
+		"Invalid length": {
+			input: &ndk.IpAddressPb{Addr: []byte{192, 0, 2}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := AddrFromNDK(tc.input)
+			if ok != tc.wantOk {
+				t.Fatalf("AddrFromNDK() ok = %t, want %t", ok, tc.wantOk)
+			}
+			if got != tc.want {
+				t.Errorf("AddrFromNDK() = %s, want %s", got, tc.want)
+			}
+			if ok && got.Is4() != tc.wantIPv4 {
+				t.Errorf("AddrFromNDK() Is4() = %t, want %t", got.Is4(), tc.wantIPv4)
+			}
+		})
+	}
+}
+
+func TestNDKFromAddr(t *testing.T) {
+	tests := map[string]struct {
+		input netip.Addr
+		want  []byte
+	}{
+		"IPv4": {
+			input: netip.MustParseAddr("192.0.2.1"),
+			want:  []byte{192, 0, 2, 1},
+		},
+		"IPv6": {
+			input: netip.MustParseAddr("2001:db8::1"),
+			want:  netip.MustParseAddr("2001:db8::1").AsSlice(),
+		},
+		"IPv4-mapped IPv6": {
+			input: netip.MustParseAddr("::ffff:192.0.2.1"),
+			want:  []byte{192, 0, 2, 1},
+		},
+		"IPv6 with zone": {
+			input: netip.MustParseAddr("fe80::1%ethernet-1/1"),
+			want:  netip.MustParseAddr("fe80::1").AsSlice(),
+		},
+		"IPv6 unspecified": {
+			input: netip.IPv6Unspecified(),
+			want:  make([]byte, 16),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := NDKFromAddr(tc.input)
+			if !bytes.Equal(got.GetAddr(), tc.want) {
+				t.Errorf("NDKFromAddr() = %v, want %v", got.GetAddr(), tc.want)
+			}
+			// NDK addresses match those created from prefixes
+			if addr, _ := parseIP(tc.input.WithZone("").String()); !bytes.Equal(got.GetAddr(), addr.GetAddr()) {
+				t.Errorf("NDKFromAddr() = %v, parseIP() = %v", got.GetAddr(), addr.GetAddr())
+			}
+		})
+	}
+
+	if got := NDKFromAddr(netip.Addr{}); got != nil {
+		t.Errorf("NDKFromAddr(zero Addr) = %v, want nil", got)
+	}
+}
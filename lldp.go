@@ -2,76 +2,102 @@ package bond
 
 import (
 	"context"
+	"net"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
-// ReceiveLLDPNotifications starts an LLDP neighbor notification
+// ReceiveLldpNotifications starts an LLDP neighbor notification
 // stream and sends notifications to channel `Lldp`.
 // If the main execution intends to continue running after calling this method,
 // it should be called as a goroutine.
 // `Lldp` chan carries values of type ndk.LldpNeighborNotification
-func (a *Agent) ReceiveLLDPNotifications(ctx context.Context) {
+// If Agent is created with option WithTypedNotifications,
+// every notification is also sent to channel `LldpNeighbor`
+// after it was sent to `Lldp`, so both chans must be read.
+// `LldpNeighbor` carries values of type LldpNeighborNotification.
+func (a *Agent) ReceiveLldpNotifications(ctx context.Context) {
+	if !a.startReceiving(NotificationTypeLldpNeighbor) {
+		return
+	}
 	defer close(a.Notifications.Lldp)
-	LldpStream := a.startLldpNotificationStream(ctx)
-
-	for LldpStreamResp := range LldpStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(LldpStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("Lldp Neighbor notification Marshal failed: %+v", err)
-			continue
-		}
-
-		a.logger.Info().
-			Msgf("Received Lldp Neighbor notifications:\n%s", b)
+	defer close(a.Notifications.LldpNeighbor)
 
-		for _, n := range LldpStreamResp.GetNotification() {
-			LldpNotif := n.GetLldpNeighbor()
-			if LldpNotif == nil {
-				a.logger.Info().
-					Msgf("Empty Lldp Neighbor notification:%+v", n)
-				continue
+	subscribe(ctx, a, NotificationTypeLldpNeighbor,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_LldpNeighbor{
+				LldpNeighbor: &ndk.LldpNeighborSubscriptionRequest{},
 			}
-			a.Notifications.Lldp <- LldpNotif
-		}
-	}
+		},
+		(*ndk.Notification).GetLldpNeighbor,
+		func(n *ndk.LldpNeighborNotification) {
+			if !sendNotification(ctx, a, NotificationTypeLldpNeighbor, a.Notifications.Lldp, n) {
+				return
+			}
+			if a.typedNotifications {
+				deliverNotification(ctx, a, NotificationTypeLldpNeighbor, a.Notifications.LldpNeighbor, ParseLldpNeighborNotification(n))
+			}
+		})
 }
 
-// startLldpNotificationStream starts a notification stream for Lldp Neighbor service notifications.
-func (a *Agent) startLldpNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
-
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("Lldp Neighbor notification stream created")
-
-	a.addLldpSubscription(ctx, streamID)
-
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"Lldp neighbor", streamChan)
+// ReceiveLLDPNotifications starts an LLDP neighbor notification
+// stream and sends notifications to channel `Lldp`.
+//
+// Deprecated: use ReceiveLldpNotifications.
+func (a *Agent) ReceiveLLDPNotifications(ctx context.Context) {
+	a.ReceiveLldpNotifications(ctx)
+}
 
-	return streamChan
+// LldpNeighborNotification type defines the contents of a streamed LLDP neighbor notification.
+// Possible Op values are Create, Update, Delete or CreateOrUpdate
+// depending on whether caching is enabled with WithCaching.
+// Interface is the local interface the neighbor was discovered on.
+// ChassisType and PortType are the LLDP subtypes of ChassisId and PortId,
+// e.g. MAC_ADDRESS or INTERFACE_NAME.
+// NDK does not expose the neighbor's system capabilities,
+// so they are not part of the notification.
+// Raw is the NDK notification the LldpNeighborNotification was parsed from.
+type LldpNeighborNotification struct {
+	Op                string   // NDK operation
+	Interface         string   // Local interface name
+	ChassisId         string   // Chassis identifier
+	ChassisType       string   // Chassis identifier subtype
+	PortId            string   // Port identifier
+	PortType          string   // Port identifier subtype
+	SourceMac         string   // Port MAC address
+	SystemName        string   // System name
+	SystemDescription string   // System description
+	BgpPeerAddrs      []string // BGP autodiscovered peer addresses
+	BgpGroupId        uint32   // BGP group identifier
+	Raw               *ndk.LldpNeighborNotification
 }
 
-// addLldpSubscription adds a subscription for Lldp Neighbor service notifications
-// to the allocated notification stream.
-func (a *Agent) addLldpSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for Lldp service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
-		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_LldpNeighbor{ // Lldp service
-			LldpNeighbor: &ndk.LldpNeighborSubscriptionRequest{},
-		},
+// ParseLldpNeighborNotification parses an NDK LLDP neighbor notification
+// and returns its contents as LldpNeighborNotification.
+// nil is returned if n is nil.
+func ParseLldpNeighborNotification(n *ndk.LldpNeighborNotification) *LldpNeighborNotification {
+	if n == nil {
+		return nil
 	}
-
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
+	l := &LldpNeighborNotification{
+		Op:                n.GetOp().String(),
+		Interface:         n.GetKey().GetInterfaceName(),
+		ChassisId:         n.GetKey().GetChassisId(),
+		ChassisType:       n.GetKey().GetChassisType().String(),
+		PortId:            n.GetData().GetPortId(),
+		PortType:          n.GetData().GetPortType().String(),
+		SystemName:        n.GetData().GetSystemName(),
+		SystemDescription: n.GetData().GetSystemDescription(),
+		BgpGroupId:        n.GetData().GetBgpGroupId(),
+		Raw:               n,
+	}
+	if mac := n.GetData().GetSourceMac().GetMacAddress(); len(mac) != 0 {
+		l.SourceMac = net.HardwareAddr(mac).String()
+	}
+	for _, addr := range n.GetData().GetBgpPeerAddress() {
+		if s := formatAddr(addr); s != "" {
+			l.BgpPeerAddrs = append(l.BgpPeerAddrs, s)
+		}
 	}
+	return l
 }
@@ -0,0 +1,116 @@
+package bond
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func lldpNeighbor() *ndk.LldpNeighborNotification {
+	mac, _ := net.ParseMAC("1a:2b:3c:ff:00:01")
+	return &ndk.LldpNeighborNotification{
+		Op: ndk.SdkMgrOperation_Create,
+		Key: &ndk.LldpNeighborKeyPb{
+			InterfaceName: "ethernet-1/1",
+			ChassisId:     "1A:2B:3C:FF:00:00",
+			ChassisType:   ndk.LldpNeighborKeyPb_MAC_ADDRESS,
+		},
+		Data: &ndk.LldpNeighborDataPb{
+			PortId:            "ethernet-1/49",
+			PortType:          ndk.LldpNeighborDataPb_INTERFACE_NAME,
+			SourceMac:         &ndk.MacAddressPb{MacAddress: mac},
+			SystemName:        "leaf1",
+			SystemDescription: "SRLinux-v24.3.1",
+			BgpPeerAddress: []*ndk.IpAddressPb{
+				{Addr: net.ParseIP("192.168.1.1").To4()},
+				{Addr: net.ParseIP("2001:db8::1")},
+			},
+			BgpGroupId: 2,
+		},
+	}
+}
+
+func TestParseLldpNeighborNotification(t *testing.T) {
+	tests := map[string]struct {
+		input    *ndk.LldpNeighborNotification
+		expected *LldpNeighborNotification
+	}{
+		"Neighbor": {
+			input: lldpNeighbor(),
+			expected: &LldpNeighborNotification{
+				Op:                "Create",
+				Interface:         "ethernet-1/1",
+				ChassisId:         "1A:2B:3C:FF:00:00",
+				ChassisType:       "MAC_ADDRESS",
+				PortId:            "ethernet-1/49",
+				PortType:          "INTERFACE_NAME",
+				SourceMac:         "1a:2b:3c:ff:00:01",
+				SystemName:        "leaf1",
+				SystemDescription: "SRLinux-v24.3.1",
+				BgpPeerAddrs:      []string{"192.168.1.1", "2001:db8::1"},
+				BgpGroupId:        2,
+			},
+		},
+		"Delete without data": {
+			input: &ndk.LldpNeighborNotification{
+				Op: ndk.SdkMgrOperation_Delete,
+				Key: &ndk.LldpNeighborKeyPb{
+					InterfaceName: "ethernet-1/2",
+					ChassisId:     "leaf2",
+					ChassisType:   ndk.LldpNeighborKeyPb_LOCALLY_ASSIGNED,
+				},
+			},
+			expected: &LldpNeighborNotification{
+				Op:          "Delete",
+				Interface:   "ethernet-1/2",
+				ChassisId:   "leaf2",
+				ChassisType: "LOCALLY_ASSIGNED",
+				PortType:    "RESERVED",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := ParseLldpNeighborNotification(tt.input)
+			if result.Raw != tt.input {
+				t.Errorf("ParseLldpNeighborNotification() Raw is not the parsed notification")
+			}
+			result.Raw = nil
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ParseLldpNeighborNotification() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+
+	if ParseLldpNeighborNotification(nil) != nil {
+		t.Errorf("ParseLldpNeighborNotification(nil) is not nil")
+	}
+}
+
+func TestReceiveTypedLldpNotifications(t *testing.T) {
+	a := newTestAgent(t, WithTypedNotifications())
+	neighbor := lldpNeighbor()
+	withFakeStream(a, &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_LldpNeighbor{LldpNeighbor: neighbor},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveLldpNotifications(ctx)
+
+	// notifications are sent to the raw chan first
+	if raw := <-a.Notifications.Lldp; raw != neighbor {
+		t.Errorf("raw notification is not the streamed notification")
+	}
+	n := <-a.Notifications.LldpNeighbor
+	if n.SystemName != "leaf1" {
+		t.Errorf("SystemName = %s, want leaf1", n.SystemName)
+	}
+	if n.Raw != neighbor {
+		t.Errorf("Raw is not the streamed notification")
+	}
+}
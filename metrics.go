@@ -0,0 +1,125 @@
+package bond
+
+import (
+	"context"
+	"time"
+)
+
+// MetricsHook contains callbacks the Agent calls to report metrics.
+// All callbacks are optional, nil callbacks are not called.
+// Callbacks are called from Agent goroutines and should not block.
+type MetricsHook struct {
+	// NotificationSendBlocked is called when a stream goroutine is blocked
+	// sending a notification of notifType (e.g. NotificationTypeInterface)
+	// on a notification channel because the reader is slow.
+	// d is the time the goroutine was blocked.
+	NotificationSendBlocked func(notifType NotificationType, d time.Duration)
+
+	// NotificationDropped is called when a notification of notifType
+	// is dropped because its channel is full,
+	// e.g. with option WithRouteNotificationBuffer.
+	NotificationDropped func(notifType NotificationType)
+
+	// EmptyNotification is called when a streamed notification
+	// does not carry a notification of the subscribed notifType
+	// and is skipped, which indicates unexpected NDK server behavior.
+	EmptyNotification func(notifType NotificationType)
+}
+
+// sendNotification records notification n of notifType for replay
+// and sends it on chan ch with deliverNotification.
+// false is returned if n was not sent.
+func sendNotification[T any](ctx context.Context, a *Agent, notifType NotificationType, ch chan<- T, n T) bool {
+	recordNotification(a, notifType, n)
+	return deliverNotification(ctx, a, notifType, ch, n)
+}
+
+// deliverNotification sends notification n of notifType on chan ch
+// without recording it for replay, e.g. the typed notification of an already
+// recorded NDK notification.
+// If the send blocks, the blocking time is logged and reported
+// to the NotificationSendBlocked metrics hook.
+// A blocked send is abandoned when ctx is done, false is returned
+// if n was not sent.
+func deliverNotification[T any](ctx context.Context, a *Agent, notifType NotificationType, ch chan<- T, n T) bool {
+	select {
+	case ch <- n:
+		return true
+	default:
+	}
+
+	start := a.clock.Now()
+	select {
+	case ch <- n:
+	case <-ctx.Done():
+		a.logger.Info().
+			Msgf("%s notification dropped after blocking for %s: %v",
+				notifType, a.clock.Now().Sub(start), ctx.Err())
+		return false
+	}
+
+	d := a.clock.Now().Sub(start)
+	a.logger.Debug().
+		Msgf("%s notification send blocked for %s", notifType, d)
+	if a.metrics.NotificationSendBlocked != nil {
+		a.metrics.NotificationSendBlocked(notifType, d)
+	}
+	return true
+}
+
+// sendNotificationPolicy sends notification n of notifType on chan ch
+// following overflow policy p when ch is full.
+// With OverflowBlock, n is sent like with sendNotification.
+// With OverflowDropNewest, n is dropped, with OverflowDropOldest,
+// the oldest notification in ch is dropped to make room for n.
+// Dropped notifications are reported to the NotificationDropped metrics hook.
+// false is returned if n was not sent.
+func sendNotificationPolicy[T any](ctx context.Context, a *Agent, notifType NotificationType, ch chan T, n T, p OverflowPolicy) bool {
+	recordNotification(a, notifType, n)
+	return deliverNotificationPolicy(ctx, a, notifType, ch, n, p)
+}
+
+// deliverNotificationPolicy sends notification n of notifType on chan ch
+// following overflow policy p like sendNotificationPolicy,
+// without recording it for replay.
+func deliverNotificationPolicy[T any](ctx context.Context, a *Agent, notifType NotificationType, ch chan T, n T, p OverflowPolicy) bool {
+	if p == OverflowBlock {
+		return deliverNotification(ctx, a, notifType, ch, n)
+	}
+
+	for {
+		select {
+		case ch <- n:
+			return true
+		default:
+		}
+
+		if p == OverflowDropNewest {
+			a.notificationDropped(notifType)
+			return false
+		}
+
+		// drop the oldest notification, unless a reader took it meanwhile
+		select {
+		case <-ch:
+			a.notificationDropped(notifType)
+		default:
+		}
+	}
+}
+
+// emptyNotification reports a skipped empty notification of notifType.
+func (a *Agent) emptyNotification(notifType NotificationType) {
+	if a.metrics.EmptyNotification != nil {
+		a.metrics.EmptyNotification(notifType)
+	}
+}
+
+// notificationDropped logs and reports a dropped notification of notifType.
+func (a *Agent) notificationDropped(notifType NotificationType) {
+	a.logger.Debug().
+		Msgf("%s notification dropped, channel is full", notifType)
+	if a.metrics.NotificationDropped != nil {
+		a.metrics.NotificationDropped(notifType)
+	}
+}
@@ -0,0 +1,105 @@
+package bond
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func TestNotificationSendBlockedMetric(t *testing.T) {
+	const readDelay = 50 * time.Millisecond
+
+	type sample struct {
+		notifType NotificationType
+		d         time.Duration
+	}
+	blocked := make(chan sample, 1)
+	a := newTestAgent(t, WithMetricsHook(MetricsHook{
+		NotificationSendBlocked: func(notifType NotificationType, d time.Duration) {
+			blocked <- sample{notifType, d}
+		},
+	}))
+	withFakeStream(a, &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_Intf{
+			Intf: &ndk.InterfaceNotification{Key: &ndk.InterfaceKey{IfName: "ethernet-1/1"}},
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveInterfaceNotifications(ctx)
+
+	// slow reader
+	time.Sleep(readDelay)
+	<-a.Notifications.Interface
+
+	select {
+	case s := <-blocked:
+		if s.notifType != NotificationTypeInterface {
+			t.Errorf("NotificationSendBlocked() notifType = %s, want Interface", s.notifType)
+		}
+		if s.d < readDelay/2 {
+			t.Errorf("NotificationSendBlocked() d = %s, want at least %s", s.d, readDelay/2)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("NotificationSendBlocked() was not called")
+	}
+}
+
+func TestSendNotificationNotBlocked(t *testing.T) {
+	called := false
+	a := newTestAgent(t, WithMetricsHook(MetricsHook{
+		NotificationSendBlocked: func(NotificationType, time.Duration) { called = true },
+	}))
+
+	ch := make(chan int, 1)
+	sendNotification(context.Background(), a, "test", ch, 1)
+
+	if called {
+		t.Errorf("NotificationSendBlocked() called for non-blocking send")
+	}
+	if got := <-ch; got != 1 {
+		t.Errorf("received %d, want 1", got)
+	}
+}
+
+func TestEmptyNotificationMetric(t *testing.T) {
+	var mu sync.Mutex
+	empty := map[NotificationType]int{}
+	a := newTestAgent(t, WithStreamConfig(), WithMetricsHook(MetricsHook{
+		EmptyNotification: func(notifType NotificationType) {
+			mu.Lock()
+			defer mu.Unlock()
+			empty[notifType]++
+		},
+	}))
+	intf := &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_Intf{
+			Intf: &ndk.InterfaceNotification{Key: &ndk.InterfaceKey{IfName: "ethernet-1/1"}},
+		},
+	}
+	// notifications without data and of another type are empty for both streams
+	withFakeStream(a, &ndk.Notification{}, intf, &ndk.Notification{}, commitEndNotification(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveInterfaceNotifications(ctx)
+	go a.receiveConfigNotifications(ctx)
+
+	// notifications are handled in order, so empty notifications
+	// before the last delivered one have been reported
+	<-a.Notifications.Interface
+	<-a.Notifications.Config
+
+	mu.Lock()
+	defer mu.Unlock()
+	if empty[NotificationTypeInterface] != 3 {
+		t.Errorf("EmptyNotification(Interface) called %d times, want 3", empty[NotificationTypeInterface])
+	}
+	if empty[NotificationTypeConfig] != 3 {
+		t.Errorf("EmptyNotification(Config) called %d times, want 3", empty[NotificationTypeConfig])
+	}
+}
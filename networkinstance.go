@@ -2,76 +2,96 @@ package bond
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
+// ErrUnknownNetworkInstance is returned when routes or nexthop groups
+// target a network instance that is not in the network instance cache
+// and Agent has option WithStrictNetworkInstanceCheck set.
+var ErrUnknownNetworkInstance = errors.New("network instance does not exist")
+
 // ReceiveNetworkInstanceNotifications starts an network instance notification
 // stream and sends notifications to channel `NwInst`.
 // If the main execution intends to continue running after calling this method,
 // it should be called as a goroutine.
 // `NwInst` chan carries values of type ndk.NetworkInstanceNotification
+// Received notifications are also stored in the network instance cache,
+// which can be queried with NetworkInstance.
 func (a *Agent) ReceiveNetworkInstanceNotifications(ctx context.Context) {
+	if !a.startReceiving(NotificationTypeNetworkInstance) {
+		return
+	}
 	defer close(a.Notifications.NwInst)
-	nwInstStream := a.startNwInstNotificationStream(ctx)
-
-	for nwInstStreamResp := range nwInstStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(nwInstStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("Network instance notification Marshal failed: %+v", err)
-			continue
-		}
 
-		a.logger.Info().
-			Msgf("Received network instance notifications:\n%s", b)
-
-		for _, n := range nwInstStreamResp.GetNotification() {
-			nwInstNotif := n.GetNwInst()
-			if nwInstNotif == nil {
-				a.logger.Info().
-					Msgf("Empty network instance notification:%+v", n)
-				continue
+	subscribe(ctx, a, NotificationTypeNetworkInstance,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_NwInst{
+				NwInst: &ndk.NetworkInstanceSubscriptionRequest{},
 			}
-			a.Notifications.NwInst <- nwInstNotif
-		}
-	}
+		},
+		(*ndk.Notification).GetNwInst,
+		func(n *ndk.NetworkInstanceNotification) {
+			a.cacheNetworkInstance(n)
+			sendNotification(ctx, a, NotificationTypeNetworkInstance, a.Notifications.NwInst, n)
+		})
 }
 
-// startNwInstNotificationStream starts a notification stream for Network Instance service notifications.
-func (a *Agent) startNwInstNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
-
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("Network Instance notification stream created")
-
-	a.addNwInstSubscription(ctx, streamID)
-
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"nwinst", streamChan)
-
-	return streamChan
+// cacheNetworkInstance stores the network instance notification n
+// in the network instance cache keyed by network instance name.
+// Delete notifications evict the cached entry of the network instance.
+func (a *Agent) cacheNetworkInstance(n *ndk.NetworkInstanceNotification) {
+	name := n.GetKey().GetInstName()
+	if name == "" {
+		return
+	}
+	if n.GetOp() == ndk.SdkMgrOperation_Delete {
+		a.networkInstances.delete(name)
+	} else {
+		a.networkInstances.set(name, n)
+	}
+	a.networkInstancesCached.Store(true)
 }
 
-// addNwInstSubscription adds a subscription for Network Instance service notifications
-// to the allocated notification stream.
-func (a *Agent) addNwInstSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for nwinst service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
-		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_NwInst{ // nwinst service
-			NwInst: &ndk.NetworkInstanceSubscriptionRequest{},
-		},
+// NetworkInstance returns the last network instance notification
+// of network instance name, e.g. default, from the network instance cache.
+// The cache is populated by ReceiveNetworkInstanceNotifications.
+// false is returned if no notification was received for the network instance
+// or the network instance was deleted.
+func (a *Agent) NetworkInstance(name string) (*ndk.NetworkInstanceNotification, bool) {
+	n, ok := a.networkInstances.get(name)
+	if !ok {
+		return nil, false
 	}
+	return cloneProto(n), true
+}
 
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
+// checkNetworkInstance checks that network instance name
+// is in the network instance cache.
+// The check is only done while ReceiveNetworkInstanceNotifications runs
+// and once the cache received its first notification,
+// as the cache is not populated otherwise.
+// Unknown network instances are logged, an error wrapping
+// ErrUnknownNetworkInstance is returned instead if Agent
+// has option WithStrictNetworkInstanceCheck set.
+func (a *Agent) checkNetworkInstance(name string) error {
+	if _, ok := a.subscriptions.get(string(NotificationTypeNetworkInstance)); !ok {
+		return nil
+	}
+	if !a.networkInstancesCached.Load() {
+		a.logger.Debug().
+			Msgf("Network instance cache is empty, not checking network instance %s", name)
+		return nil
+	}
+	if _, ok := a.networkInstances.get(name); ok {
+		return nil
+	}
+	if a.strictNetInstCheck {
+		return fmt.Errorf("%w: %s", ErrUnknownNetworkInstance, name)
 	}
+	a.logger.Warn().
+		Msgf("Network instance %s does not exist", name)
+	return nil
 }
@@ -0,0 +1,172 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"github.com/rs/zerolog"
+)
+
+func networkInstanceNotification(op ndk.SdkMgrOperation, name string) *ndk.Notification {
+	return &ndk.Notification{SubscriptionTypes: &ndk.Notification_NwInst{NwInst: &ndk.NetworkInstanceNotification{
+		Op:  op,
+		Key: &ndk.NetworkInstanceKey{InstName: name},
+	}}}
+}
+
+// receiveNetworkInstances starts streaming the network instance notifications ns
+// and waits until all of them are received.
+func receiveNetworkInstances(t *testing.T, a *Agent, ns ...*ndk.Notification) {
+	t.Helper()
+	withFakeStream(a, ns...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go a.ReceiveNetworkInstanceNotifications(ctx)
+
+	for range ns {
+		<-a.Notifications.NwInst
+	}
+}
+
+func TestNetworkInstanceCache(t *testing.T) {
+	a := newTestAgent(t)
+	receiveNetworkInstances(t, a,
+		networkInstanceNotification(ndk.SdkMgrOperation_Create, "default"),
+		networkInstanceNotification(ndk.SdkMgrOperation_Create, "mgmt"),
+		networkInstanceNotification(ndk.SdkMgrOperation_Delete, "mgmt"),
+	)
+
+	if n, ok := a.NetworkInstance("default"); !ok || n.GetKey().GetInstName() != "default" {
+		t.Errorf("NetworkInstance(default) = %v, %t, want cached network instance", n, ok)
+	}
+	if _, ok := a.NetworkInstance("mgmt"); ok {
+		t.Error("NetworkInstance(mgmt) found deleted network instance")
+	}
+}
+
+func TestNetworkInstanceCheck(t *testing.T) {
+	tests := map[string]struct {
+		strict  bool
+		netInst string
+		wantErr error
+		wantLog bool
+	}{
+		"Known network instance": {
+			netInst: "default",
+		},
+		"Unknown network instance warns": {
+			netInst: "defualt",
+			wantLog: true,
+		},
+		"Unknown network instance strict": {
+			strict:  true,
+			netInst: "defualt",
+			wantErr: ErrUnknownNetworkInstance,
+		},
+		"Known network instance strict": {
+			strict:  true,
+			netInst: "default",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &syncBuffer{}
+			logger := zerolog.New(buf)
+			opts := []Option{WithLogger(&logger)}
+			if tt.strict {
+				opts = append(opts, WithStrictNetworkInstanceCheck())
+			}
+			a := newTestAgent(t, opts...)
+			receiveNetworkInstances(t, a,
+				networkInstanceNotification(ndk.SdkMgrOperation_Create, "default"))
+
+			routeService, nhgService := &fakeRouteService{}, &fakeNhgService{}
+			a.stubs.routeService = routeService
+			a.stubs.nextHopGroupService = nhgService
+
+			nhgErr := a.NextHopGroupAdd(NewNextHopGroup(WithNetworkInstanceName(tt.netInst), WithName("nhg_sdk"),
+				WithIpNextHop("192.168.1.1", ndk.NextHop_LOCAL, ndk.NextHop_REGULAR)))
+			routeErr := a.RouteAdd(NewRoute(WithNetInstName(tt.netInst), WithIpPrefix("10.0.0.0/24"),
+				WithNextHopGroupName("nhg_sdk")))
+
+			for method, err := range map[string]error{"NextHopGroupAdd": nhgErr, "RouteAdd": routeErr} {
+				if tt.wantErr == nil && err != nil {
+					t.Errorf("%s() returned error: %v", method, err)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("%s() error = %v, want %v", method, err, tt.wantErr)
+				}
+			}
+
+			wantReqs := 1
+			if tt.wantErr != nil {
+				wantReqs = 0
+			}
+			if len(nhgService.addReqs) != wantReqs || len(routeService.addReqs) != wantReqs {
+				t.Errorf("got %d nexthop group and %d route requests, want %d",
+					len(nhgService.addReqs), len(routeService.addReqs), wantReqs)
+			}
+			if got := strings.Contains(buf.String(), "Network instance defualt does not exist"); got != tt.wantLog {
+				t.Errorf("warning logged = %t, want %t", got, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestNetworkInstanceCheckWithoutStream(t *testing.T) {
+	a := newTestAgent(t, WithStrictNetworkInstanceCheck())
+	a.stubs = &stubs{routeService: &fakeRouteService{}}
+
+	// the cache is not populated, so network instances are not checked
+	if err := a.RouteAdd(NewRoute(WithNetInstName("blue"), WithIpPrefix("10.0.0.0/24"),
+		WithNextHopGroupName("nhg_sdk"))); err != nil {
+		t.Errorf("RouteAdd() returned error: %v", err)
+	}
+}
+
+func TestNetworkInstanceCheckBeforeCacheFill(t *testing.T) {
+	a := newTestAgent(t, WithStrictNetworkInstanceCheck())
+	withFakeStream(a)
+	a.stubs.routeService = &fakeRouteService{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveNetworkInstanceNotifications(ctx)
+	waitForSubscription(t, a, NotificationTypeNetworkInstance)
+
+	// no network instance notification was received yet
+	if err := a.RouteAdd(NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.0.0/24"),
+		WithNextHopGroupName("nhg_sdk"))); err != nil {
+		t.Errorf("RouteAdd() returned error: %v", err)
+	}
+}
+
+func TestNetworkInstanceCheckAfterStreamEnds(t *testing.T) {
+	a := newTestAgent(t, WithStrictNetworkInstanceCheck())
+	withFakeStream(a, networkInstanceNotification(ndk.SdkMgrOperation_Create, "default"))
+	a.stubs.routeService = &fakeRouteService{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.ReceiveNetworkInstanceNotifications(ctx)
+		close(done)
+	}()
+	<-a.Notifications.NwInst
+	cancel()
+	<-done
+
+	if _, ok := a.subscriptions.get(string(NotificationTypeNetworkInstance)); ok {
+		t.Error("network instance subscription kept after the stream ended")
+	}
+	// the cache is no longer updated, so network instances are not checked
+	if err := a.RouteAdd(NewRoute(WithNetInstName("blue"), WithIpPrefix("10.0.0.0/24"),
+		WithNextHopGroupName("nhg_sdk"))); err != nil {
+		t.Errorf("RouteAdd() returned error: %v", err)
+	}
+}
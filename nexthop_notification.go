@@ -2,76 +2,122 @@ package bond
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
-// ReceiveNexthopGroupNotifications starts a next hop group notification stream
+// ReceiveNextHopGroupNotifications starts a next hop group notification stream
 // and sends notifications to channel `NextHopGroup`.
 // If the main execution intends to continue running after calling this method,
 // it should be called as a goroutine.
 // `NextHopGroup` chan carries values of type ndk.NextHopGroupNotification
-func (a *Agent) ReceiveNexthopGroupNotifications(ctx context.Context) {
+func (a *Agent) ReceiveNextHopGroupNotifications(ctx context.Context) {
+	if !a.startReceiving(NotificationTypeNextHopGroup) {
+		return
+	}
 	defer close(a.Notifications.NextHopGroup)
-	nhgStream := a.startNhgNotificationStream(ctx)
 
-	for nhgStreamResp := range nhgStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(nhgStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("Nexthop group notification Marshal failed: %+v", err)
-			continue
-		}
-
-		a.logger.Info().
-			Msgf("Received Nexthop group notifications:\n%s", b)
-
-		for _, n := range nhgStreamResp.GetNotification() {
-			nhgNotif := n.GetNhg()
-			if nhgNotif == nil {
-				a.logger.Info().
-					Msgf("Empty Nexthop group notification:%+v", n)
-				continue
+	subscribe(ctx, a, NotificationTypeNextHopGroup,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_Nhg{
+				Nhg: &ndk.NextHopGroupSubscriptionRequest{},
 			}
-			a.Notifications.NextHopGroup <- nhgNotif
-		}
-	}
+		},
+		(*ndk.Notification).GetNhg,
+		func(n *ndk.NextHopGroupNotification) {
+			sendNotification(ctx, a, NotificationTypeNextHopGroup, a.Notifications.NextHopGroup, n)
+		})
+}
+
+// ReceiveNexthopGroupNotifications starts a next hop group notification stream
+// and sends notifications to channel `NextHopGroup`.
+//
+// Deprecated: use ReceiveNextHopGroupNotifications.
+func (a *Agent) ReceiveNexthopGroupNotifications(ctx context.Context) {
+	a.ReceiveNextHopGroupNotifications(ctx)
 }
 
-// startNhgNotificationStream starts a notification stream for Nexthop Group service notifications.
-func (a *Agent) startNhgNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
+// WaitForNextHopGroupResolved blocks until nexthop group name
+// in network instance networkInstance is resolved or ctx is done.
+// It can be used after NextHopGroupAdd to add routes using the group
+// only once the group is resolved.
+// NDK nexthops carry no resolution state, instead NDK streams
+// notifications for a nexthop group with the nexthop group id (Key)
+// it assigned to the group.
+// The group is considered resolved when a Create or Update notification
+// with a non-zero nexthop group id is streamed for it.
+// A separate notification stream filtered on the group is used,
+// so notifications sent to chan NextHopGroup are not affected.
+// Only notifications streamed after the call are considered.
+// An error is returned if ctx is done before the group is resolved,
+// if the Agent is not connected to NDK,
+// or an error wrapping ErrNhgSubscriptionFailed if the subscription
+// to the group notifications could not be added.
+//
+// Example:
+//
+//	err := a.WaitForNextHopGroupResolved(ctx, "default", "ndk_sdk")
+func (a *Agent) WaitForNextHopGroupResolved(ctx context.Context, networkInstance, name string) error {
+	if a.stubs == nil {
+		return ErrNotConnected
+	}
 
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("Nhg Notification stream created")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	a.addNhgSubscription(ctx, streamID)
+	streamID, err := a.createNotificationStream(ctx)
+	if err != nil {
+		return fmt.Errorf("nexthop group %s/%s not resolved: %w", networkInstance, name, err)
+	}
+	defer a.deleteNotificationStream(context.WithoutCancel(ctx), streamID)
 
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"nhg", streamChan)
+	subID := a.addSubscription(ctx, streamID, func(req *ndk.NotificationRegisterRequest) {
+		req.SubscriptionTypes = &ndk.NotificationRegisterRequest_Nhg{
+			Nhg: &ndk.NextHopGroupSubscriptionRequest{
+				Key: &ndk.NextHopGroupKey{Name: name, NetworkInstanceName: networkInstance},
+			},
+		}
+	})
+	if subID == 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("nexthop group %s/%s not resolved: %w", networkInstance, name, err)
+		}
+		return fmt.Errorf("%w: %s/%s", ErrNhgSubscriptionFailed, networkInstance, name)
+	}
 
-	return streamChan
-}
+	stream := make(chan *ndk.NotificationStreamResponse)
+	go a.startNotificationStream(ctx, streamID, streamLogLabels[NotificationTypeNextHopGroup].subscType, stream)
+	// drain the stream until it is closed on return,
+	// so startNotificationStream does not block on send.
+	defer func() {
+		cancel()
+		for range stream {
+		}
+	}()
 
-// addNhgSubscription adds a subscription for Nexthop Group service notifications
-// to the allocated notification stream.
-func (a *Agent) addNhgSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for nhg service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
-		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_Nhg{ // nhg service
-			Nhg: &ndk.NextHopGroupSubscriptionRequest{},
-		},
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("nexthop group %s/%s not resolved: %w", networkInstance, name, ctx.Err())
+		case resp, ok := <-stream:
+			if !ok {
+				return fmt.Errorf("nexthop group %s/%s not resolved: %w", networkInstance, name, ctx.Err())
+			}
+			for _, n := range resp.GetNotification() {
+				if nhgResolved(n.GetNhg()) {
+					return nil
+				}
+			}
+		}
 	}
+}
 
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
+// nhgResolved returns true if nexthop group notification n
+// creates or updates a group NDK assigned a nexthop group id to.
+func nhgResolved(n *ndk.NextHopGroupNotification) bool {
+	if n == nil || n.GetOp() == ndk.SdkMgrOperation_Delete {
+		return false
 	}
+	return n.GetKey() != 0
 }
@@ -0,0 +1,110 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+// nhgNotification returns a nexthop group notification with op,
+// nexthop group id id and nexthops IP nexthops.
+func nhgNotification(op ndk.SdkMgrOperation, id uint64, nexthops ...string) *ndk.Notification {
+	data := &ndk.NextHopGroup{}
+	for _, nh := range nexthops {
+		addr, _ := parseIP(nh)
+		data.NextHop = append(data.NextHop, &ndk.NextHop{
+			Nexthop: &ndk.NextHop_IpNexthop{IpNexthop: addr},
+		})
+	}
+	return &ndk.Notification{SubscriptionTypes: &ndk.Notification_Nhg{
+		Nhg: &ndk.NextHopGroupNotification{Op: op, Key: id, Data: data},
+	}}
+}
+
+func TestWaitForNextHopGroupResolved(t *testing.T) {
+	tests := map[string]struct {
+		notifications []*ndk.Notification
+		wantErr       error
+	}{
+		"Resolved": {
+			notifications: []*ndk.Notification{
+				nhgNotification(ndk.SdkMgrOperation_Delete, 7, "192.168.1.1"),
+				nhgNotification(ndk.SdkMgrOperation_Create, 7),
+			},
+		},
+		"Not resolved": {
+			notifications: []*ndk.Notification{
+				nhgNotification(ndk.SdkMgrOperation_Create, 0, "192.168.1.1"),
+				nhgNotification(ndk.SdkMgrOperation_Delete, 7, "192.168.1.1"),
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			mgr := withFakeStream(a, tt.notifications...)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := a.WaitForNextHopGroupResolved(ctx, "default", "ndk_sdk")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WaitForNextHopGroupResolved() = %v, want %v", err, tt.wantErr)
+			}
+
+			reqs := mgr.registerRequests()
+			if len(reqs) != 3 {
+				t.Fatalf("got %d NotificationRegister requests, want 3", len(reqs))
+			}
+			key := reqs[1].GetNhg().GetKey()
+			if key.GetNetworkInstanceName() != "default" || key.GetName() != "ndk_sdk" {
+				t.Errorf("subscription key = %v, want default/ndk_sdk", key)
+			}
+			if reqs[2].GetOp() != ndk.NotificationRegisterRequest_Delete {
+				t.Errorf("last NotificationRegister op = %s, want %s",
+					reqs[2].GetOp(), ndk.NotificationRegisterRequest_Delete)
+			}
+		})
+	}
+}
+
+func TestWaitForNextHopGroupResolvedStreamFailure(t *testing.T) {
+	tests := map[string]struct {
+		mgr     *fakeSdkMgrService
+		service *fakeNotificationService
+	}{
+		"Stream creation keeps failing": {
+			mgr:     &fakeSdkMgrService{registerFailures: math.MaxInt},
+			service: &fakeNotificationService{},
+		},
+		"Stream client creation keeps failing": {
+			mgr:     &fakeSdkMgrService{},
+			service: &fakeNotificationService{streamErr: errors.New("unavailable")},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			a.stubs = &stubs{sdkMgrService: tt.mgr, notificationService: tt.service}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if err := a.WaitForNextHopGroupResolved(ctx, "default", "ndk_sdk"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("WaitForNextHopGroupResolved() = %v, want %v", err, context.DeadlineExceeded)
+			}
+		})
+	}
+}
+
+func TestWaitForNextHopGroupResolvedNotConnected(t *testing.T) {
+	a := newTestAgent(t)
+	if err := a.WaitForNextHopGroupResolved(context.Background(), "default", "ndk_sdk"); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("WaitForNextHopGroupResolved() = %v, want %v", err, ErrNotConnected)
+	}
+}
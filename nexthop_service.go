@@ -3,14 +3,36 @@ package bond
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/protobuf/proto"
 )
 
 var ErrNhgAddOrUpdateFailed = errors.New("nexthop group add or update failed")
 var ErrNhgDeleteFailed = errors.New("nexthop group delete failed")
 var ErrNhgSyncStart = errors.New("nexthop group start failed")
 var ErrNhgSyncEnd = errors.New("nexthop group sync end failed")
+var ErrInvalidNhgName = errors.New("invalid nexthop group name")
+var ErrNoNextHops = errors.New("nexthop group has no nexthops")
+var ErrInvalidMplsLabel = errors.New("invalid mpls label")
+var ErrNhgSubscriptionFailed = errors.New("nexthop group subscription failed")
+
+// maxNhgNameLen is the maximum length of a nexthop group name in SR Linux.
+const maxNhgNameLen = 255
+
+// MPLS labels are 20-bit values. Label 3, implicit null (RFC 3032),
+// is only signaled and never appears in a pushed label stack.
+const (
+	maxMplsLabel          = 1<<20 - 1
+	implicitNullMplsLabel = 3
+)
+
+// nhgNameRe matches characters allowed by SR Linux in nexthop group names.
+// Names cannot start with a space.
+var nhgNameRe = regexp.MustCompile("^[A-Za-z0-9!@#$%^&()|+=`~.,'/_:;?-][A-Za-z0-9 !@#$%^&()|+=`~.,'/_:;?-]*$")
 
 // Options when adding/updating nexthop groups.
 type NextHopGroupOption func(n *ndk.NextHopGroupInfo)
@@ -20,6 +42,8 @@ type NextHopGroupOption func(n *ndk.NextHopGroupInfo)
 // A valid nexthop group requires the following options:
 // WithNetworkInstanceName, WithName, WithIpNextHop or WithMplsNextHop
 // Multiple nexthop(s) can be associated with a nexthop group.
+// All nexthops of a group are used equally, NDK nexthops
+// have no weight field, so weighted ECMP cannot be programmed through NDK.
 func NewNextHopGroup(options ...NextHopGroupOption) *ndk.NextHopGroupInfo {
 	n := new(ndk.NextHopGroupInfo)
 	n.Key = new(ndk.NextHopGroupKey)
@@ -43,6 +67,9 @@ func WithNetworkInstanceName(name string) NextHopGroupOption {
 
 // WithName sets the nexthop group name.
 // NDK expects the input name to end in the format "_sdk" or "_SDK".
+// Name must be at most 255 characters long and can contain
+// letters, digits, spaces (except as the first character)
+// and the characters !@#$%^&()|+=`~.,'/_:;?-
 // If the input string does not match the expected format,
 // NextHopGroupAdd returns an error.
 // Specified nhg must be a valid NDK nexthop group that will be programmed
@@ -60,7 +87,10 @@ func WithName(name string) NextHopGroupOption {
 // An IP nexthop is defined by it's IPv4/IPv6 address,
 // the resolution type, and type of routes it resolves to.
 // address string is in the format of  "ip"
-// where ip is the IP address without the prefix length.
+// where ip is the IPv4/IPv6 address without the prefix length.
+// If address is not a valid IP address or has a prefix length,
+// the nexthop is added without an address and NextHopGroupAdd
+// returns an error wrapping ErrInvalidIpAddr.
 // rt is of type ndk.NextHop_ResolveToType.
 // rType is of type ndk.NextHop_ResolutionType.
 // Both of these params are defined in the NDK Go Bindings.
@@ -69,7 +99,8 @@ func WithName(name string) NextHopGroupOption {
 // WithIpNextHop(1.1.1.1, ndk.NextHop_DIRECT, ndk.NextHop_REGULAR)
 func WithIpNextHop(address string, rt ndk.NextHop_ResolveToType, rType ndk.NextHop_ResolutionType) NextHopGroupOption {
 	return func(n *ndk.NextHopGroupInfo) {
-		nhParse, _ := parseIP(address)
+		// an invalid address leaves the nexthop without an address
+		nhParse, _ := parseNextHopIP(address)
 		nh := &ndk.NextHop{
 			Nexthop: &ndk.NextHop_IpNexthop{
 				IpNexthop: nhParse,
@@ -86,7 +117,13 @@ func WithIpNextHop(address string, rt ndk.NextHop_ResolveToType, rType ndk.NextH
 // a slice of uint32 MPLS labels, the resolution type,
 // and type of routes it resolves to.
 // address string is in the format of  "ip"
-// where ip is the IP address without the prefix length.
+// where ip is the IPv4/IPv6 address without the prefix length.
+// If address is not a valid IP address or has a prefix length,
+// the nexthop is added without an address and NextHopGroupAdd
+// returns an error wrapping ErrInvalidIpAddr.
+// Labels must be within the 20-bit MPLS label range, 0-1048575.
+// For implicit null label 3 and out of range labels
+// NextHopGroupAdd returns an error wrapping ErrInvalidMplsLabel.
 // rt is of type ndk.NextHop_ResolveToType.
 // rType is of type ndk.NextHop_ResolutionType.
 // Both of these params are defined in the NDK Go Bindings.
@@ -96,7 +133,8 @@ func WithIpNextHop(address string, rt ndk.NextHop_ResolveToType, rType ndk.NextH
 func WithMplsNextHop(address string, labels []uint32, rt ndk.NextHop_ResolveToType,
 	rType ndk.NextHop_ResolutionType) NextHopGroupOption {
 	return func(n *ndk.NextHopGroupInfo) {
-		nhParse, _ := parseIP(address)
+		// an invalid address leaves the nexthop without an address
+		nhParse, _ := parseNextHopIP(address)
 		lStack := []*ndk.MplsLabel{}
 		for _, l := range labels {
 			lStack = append(lStack, &ndk.MplsLabel{
@@ -117,6 +155,67 @@ func WithMplsNextHop(address string, labels []uint32, rt ndk.NextHop_ResolveToTy
 	}
 }
 
+// validateNextHops checks that every nexthop of nhg has a valid address,
+// i.e. it was not added with an invalid address by WithIpNextHop
+// or WithMplsNextHop, and that MPLS nexthops have valid labels.
+// The returned error joins the errors of all invalid nexthops.
+func validateNextHops(nhg *ndk.NextHopGroupInfo) error {
+	var errs []error
+	for i, nh := range nhg.GetData().GetNextHop() {
+		addr := nh.GetIpNexthop()
+		if mpls := nh.GetMplsNexthop(); mpls != nil {
+			addr = mpls.GetIpNexthop()
+		}
+		address := formatAddr(addr)
+		if address == "" {
+			errs = append(errs, fmt.Errorf("%w: nexthop %d of nexthop group %s",
+				ErrInvalidIpAddr, i, nhg.GetKey().GetName()))
+			continue
+		}
+		var labels []uint32
+		for _, l := range nh.GetMplsNexthop().GetLabelStack() {
+			labels = append(labels, l.GetMplsLabel())
+		}
+		if err := validateMplsLabels(address, labels); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateMplsLabels checks that labels of the MPLS nexthop address
+// are within the MPLS label range and can be pushed,
+// i.e. are not implicit null. Other reserved labels, e.g. explicit null, are allowed.
+// The returned error joins errors wrapping ErrInvalidMplsLabel for every invalid label.
+func validateMplsLabels(address string, labels []uint32) error {
+	var errs []error
+	for _, l := range labels {
+		switch {
+		case l > maxMplsLabel:
+			errs = append(errs, fmt.Errorf("%w: label %d of nexthop %q exceeds maximum %d",
+				ErrInvalidMplsLabel, l, address, maxMplsLabel))
+		case l == implicitNullMplsLabel:
+			errs = append(errs, fmt.Errorf("%w: label %d of nexthop %q is implicit null",
+				ErrInvalidMplsLabel, l, address))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseNextHopIP parses a nexthop IPv4/IPv6 address.
+// An error is returned if address is not a bare IP address,
+// e.g. it is malformed or includes a prefix length.
+func parseNextHopIP(address string) (*ndk.IpAddressPb, error) {
+	if strings.Contains(address, "/") {
+		return nil, fmt.Errorf("%w: nexthop %q must not include a prefix length", ErrInvalidIpAddr, address)
+	}
+	addr, _ := parseIP(address)
+	if addr == nil {
+		return nil, fmt.Errorf("%w: nexthop %q", ErrInvalidIpAddr, address)
+	}
+	return addr, nil
+}
+
 // NextHopGroupAdd adds nexthop group(s) in SRL.
 // This method takes nexthop group(s) of type NextHopGroupInfo,
 // which is defined in the NDK Go Bindings.
@@ -127,12 +226,20 @@ func WithMplsNextHop(address string, labels []uint32, rt ndk.NextHop_ResolveToTy
 // If errors are encountered during the parsing of addresses or
 // adding of nexthop groups, an error is returned.
 func (a *Agent) NextHopGroupAdd(nhgs ...*ndk.NextHopGroupInfo) error {
+	if err := a.validateNextHopGroups(nhgs); err != nil {
+		return err
+	}
 	infos := []*ndk.NextHopGroupInfo{}
 	infos = append(infos, nhgs...)
 	req := &ndk.NextHopGroupRequest{
 		GroupInfo: infos,
 	}
 	// Call NDK RPC
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	a.logger.Info().Msg("Add/update nexthop(s) group")
 	resp, err := a.stubs.nextHopGroupService.NextHopGroupAddOrUpdate(a.ctx, req)
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
@@ -142,9 +249,41 @@ func (a *Agent) NextHopGroupAdd(nhgs ...*ndk.NextHopGroupInfo) error {
 	}
 	a.logger.Debug().
 		Msgf("Agent was able to add or update nexthop group, response: %v", resp)
+	for _, nhg := range nhgs {
+		a.nhgs.set(nhgKey(nhg.GetKey().GetNetworkInstanceName(), nhg.GetKey().GetName()), cloneProto(nhg))
+	}
+	return nil
+}
+
+// validateNextHopGroups validates nexthop groups before they are programmed.
+// A nexthop group is invalid if a nexthop fails validateNextHops,
+// if its name is invalid or if its network instance fails checkNetworkInstance.
+// The error of the first invalid nexthop group is returned.
+func (a *Agent) validateNextHopGroups(nhgs []*ndk.NextHopGroupInfo) error {
+	for _, nhg := range nhgs {
+		if err := validateNextHops(nhg); err != nil {
+			a.logger.Error().Err(err).Msg("Invalid nexthop group")
+			return err
+		}
+		if err := validateNhgName(nhg.GetKey().GetName()); err != nil {
+			a.logger.Error().Err(err).Msg("Invalid nexthop group")
+			return err
+		}
+		if err := a.checkNetworkInstance(nhg.GetKey().GetNetworkInstanceName()); err != nil {
+			a.logger.Error().Err(err).Msg("Invalid nexthop group")
+			return err
+		}
+	}
 	return nil
 }
 
+// NextHopGroupSnapshot returns a copy of all nexthop groups
+// programmed by the Agent, keyed by "<network instance>/<nexthop group name>".
+// It is safe to call while nexthop groups are being added or deleted.
+func (a *Agent) NextHopGroupSnapshot() map[string]*ndk.NextHopGroupInfo {
+	return a.nhgs.snapshot(cloneProto[*ndk.NextHopGroupInfo])
+}
+
 // NextHopGroupUpdate updates and performs resynchronization
 // on programmed NDK nexthop group(s).
 // Nexthop groups not added as part of this update
@@ -167,6 +306,10 @@ func (a *Agent) NextHopGroupAdd(nhgs ...*ndk.NextHopGroupInfo) error {
 // will result in the final configuration being 1.1.1.2, 1.1.1.3.
 // Nexthop group with address 1.1.1.1, which was previously added, is deleted due to the update.
 func (a *Agent) NextHopGroupUpdate(nhgs ...*ndk.NextHopGroupInfo) error {
+	// invalid nexthop groups are reported before the sync is started
+	if err := a.validateNextHopGroups(nhgs); err != nil {
+		return err
+	}
 	err := a.nhgSyncStart()
 	if err != nil {
 		return err
@@ -179,9 +322,40 @@ func (a *Agent) NextHopGroupUpdate(nhgs ...*ndk.NextHopGroupInfo) error {
 	if err != nil {
 		return err
 	}
+	// nexthop groups not part of this update were removed
+	programmed := make(map[string]*ndk.NextHopGroupInfo, len(nhgs))
+	for _, nhg := range nhgs {
+		programmed[nhgKey(nhg.GetKey().GetNetworkInstanceName(), nhg.GetKey().GetName())] = cloneProto(nhg)
+	}
+	a.nhgs.replace(programmed)
 	return nil
 }
 
+// NextHopGroupReplaceNextHops replaces all nexthops of nexthop group name
+// in network instance networkInstance with nexthops.
+// The nexthop group is rebuilt and re-added with a single RPC,
+// so routes using the group never see an empty or partial nexthop set.
+// Nexthops of the group that are not in nexthops are removed.
+// An error wrapping ErrNoNextHops is returned if nexthops is empty,
+// use NextHopGroupDelete to remove a nexthop group.
+//
+// Example:
+// NextHopGroupReplaceNextHops("default", "ndk_sdk",
+// NextHopSpec{Address: "192.168.1.2", ResolveTo: ndk.NextHop_DIRECT, Type: ndk.NextHop_REGULAR})
+func (a *Agent) NextHopGroupReplaceNextHops(networkInstance, name string, nexthops ...NextHopSpec) error {
+	if len(nexthops) == 0 {
+		a.logger.Error().
+			Msgf("Nexthop group %s has no nexthops.", name)
+		return fmt.Errorf("%w: %s", ErrNoNextHops, name)
+	}
+
+	opts := []NextHopGroupOption{
+		WithNetworkInstanceName(networkInstance),
+		WithName(name),
+	}
+	return a.NextHopGroupAdd(NewNextHopGroup(append(opts, nextHopOptions(nexthops)...)...))
+}
+
 // NextHopGroupDelete deletes a programmed nexthop group
 // that has been added/updated by the NDK.
 // The method takes as inputs the network instance name and the nexthop group name.
@@ -191,17 +365,38 @@ func (a *Agent) NextHopGroupUpdate(nhgs ...*ndk.NextHopGroupInfo) error {
 // Example: NextHopGroupDelete("default", "ndk_sdk") deletes from programmed config
 // ndk_sdk nexthop group in network instance default.
 func (a *Agent) NextHopGroupDelete(networkInstance string, name string) error {
-	key := &ndk.NextHopGroupKey{
-		Name:                name,
-		NetworkInstanceName: networkInstance,
+	return a.NextHopGroupDeleteMany(networkInstance, name)
+}
+
+// NextHopGroupDeleteMany deletes multiple programmed nexthop groups
+// under the same network instance with a single NDK request.
+// The method takes as inputs the network instance name and the nexthop group names.
+// If errors are encountered during the deletion
+// of nexthop groups, an error is returned.
+// No request is sent if no names are given.
+//
+// Example: NextHopGroupDeleteMany("default", "ndk1_sdk", "ndk2_sdk") deletes
+// from programmed config ndk1_sdk and ndk2_sdk nexthop groups in network instance default.
+func (a *Agent) NextHopGroupDeleteMany(networkInstance string, names ...string) error {
+	if len(names) == 0 {
+		return nil
 	}
-	keys := []*ndk.NextHopGroupKey{
-		key,
+	keys := []*ndk.NextHopGroupKey{}
+	for _, name := range names {
+		keys = append(keys, &ndk.NextHopGroupKey{
+			Name:                name,
+			NetworkInstanceName: networkInstance,
+		})
 	}
 	req := &ndk.NextHopGroupDeleteRequest{
 		GroupKey: keys,
 	}
 	// Call NDK RPC
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	a.logger.Info().Msg("Delete nexthop group")
 	resp, err := a.stubs.nextHopGroupService.NextHopGroupDelete(a.ctx, req)
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
@@ -211,11 +406,19 @@ func (a *Agent) NextHopGroupDelete(networkInstance string, name string) error {
 	}
 	a.logger.Debug().
 		Msgf("Agent was able to delete nexthop group, response: %v", resp)
+	for _, name := range names {
+		a.nhgs.delete(nhgKey(networkInstance, name))
+	}
 	return nil
 }
 
 // nhgSyncStart starts syncing agent nexthop groups in SRL.
 func (a *Agent) nhgSyncStart() error {
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	resp, err := a.stubs.nextHopGroupService.SyncStart(a.ctx, &ndk.SyncRequest{})
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
 		a.logger.Error().
@@ -229,6 +432,11 @@ func (a *Agent) nhgSyncStart() error {
 
 // nhgSyncEnd ends syncing agent nexthop groups in SRL.
 func (a *Agent) nhgSyncEnd() error {
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	resp, err := a.stubs.nextHopGroupService.SyncEnd(a.ctx, &ndk.SyncRequest{})
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
 		a.logger.Error().
@@ -239,3 +447,132 @@ func (a *Agent) nhgSyncEnd() error {
 		Msgf("Successfully stopped nexthop group sync, response: %v", resp)
 	return nil
 }
+
+// PruneOrphanNextHopGroups deletes nexthop groups programmed by the Agent
+// that are not referenced by any route programmed by the Agent.
+// Long-running apps can use this to avoid leaking nexthop groups
+// after deleting or updating routes.
+// Names of the pruned nexthop groups are returned sorted.
+// If deletion of nexthop groups fails, an error is returned
+// along with the names of groups pruned before the failure.
+func (a *Agent) PruneOrphanNextHopGroups() ([]string, error) {
+	referenced := make(map[string]struct{})
+	for _, r := range a.routes.snapshot(cloneProto[*ndk.RouteInfo]) {
+		referenced[nhgKey(r.GetKey().GetNetInstName(), r.GetData().GetNexthopGroupName())] = struct{}{}
+	}
+
+	// orphaned nexthop group names by network instance
+	orphans := make(map[string][]string)
+	for key, nhg := range a.nhgs.snapshot(cloneProto[*ndk.NextHopGroupInfo]) {
+		if _, ok := referenced[key]; ok {
+			continue
+		}
+		ni := nhg.GetKey().GetNetworkInstanceName()
+		orphans[ni] = append(orphans[ni], nhg.GetKey().GetName())
+	}
+
+	networkInstances := make([]string, 0, len(orphans))
+	for ni := range orphans {
+		networkInstances = append(networkInstances, ni)
+	}
+	sort.Strings(networkInstances)
+
+	pruned := []string{}
+	for _, ni := range networkInstances {
+		names := orphans[ni]
+		sort.Strings(names)
+		if err := a.NextHopGroupDeleteMany(ni, names...); err != nil {
+			sort.Strings(pruned)
+			return pruned, err
+		}
+		pruned = append(pruned, names...)
+	}
+	sort.Strings(pruned)
+
+	a.logger.Debug().
+		Strs("nexthop-groups", pruned).
+		Msg("Pruned orphan nexthop groups")
+
+	return pruned, nil
+}
+
+// DiffNextHopGroups compares desired nexthop groups with current nexthop groups
+// and returns the groups to add, update and delete to reconcile current with desired.
+// Groups are matched by network instance and name.
+// toAdd contains desired groups missing from current,
+// toUpdate contains desired groups whose nexthops differ from current,
+// toDelete contains current groups missing from desired.
+// Nexthops are compared as a set including their resolve-to and resolution types,
+// so reordering nexthops is not a change.
+// NDK nexthops have no weight, so weights cannot be compared.
+// Returned groups are the passed groups in input order.
+func DiffNextHopGroups(desired, current []*ndk.NextHopGroupInfo) (toAdd, toUpdate, toDelete []*ndk.NextHopGroupInfo) {
+	cur := make(map[string]*ndk.NextHopGroupInfo, len(current))
+	for _, nhg := range current {
+		cur[nhgKey(nhg.GetKey().GetNetworkInstanceName(), nhg.GetKey().GetName())] = nhg
+	}
+	want := make(map[string]bool, len(desired))
+	for _, nhg := range desired {
+		key := nhgKey(nhg.GetKey().GetNetworkInstanceName(), nhg.GetKey().GetName())
+		want[key] = true
+		c, ok := cur[key]
+		switch {
+		case !ok:
+			toAdd = append(toAdd, nhg)
+		case !sameNextHops(nhg.GetData().GetNextHop(), c.GetData().GetNextHop()):
+			toUpdate = append(toUpdate, nhg)
+		}
+	}
+	for _, nhg := range current {
+		if !want[nhgKey(nhg.GetKey().GetNetworkInstanceName(), nhg.GetKey().GetName())] {
+			toDelete = append(toDelete, nhg)
+		}
+	}
+	return toAdd, toUpdate, toDelete
+}
+
+// sameNextHops returns true if x and y contain the same nexthops in any order.
+func sameNextHops(x, y []*ndk.NextHop) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	matched := make([]bool, len(y))
+	for _, nh := range x {
+		found := false
+		for i, other := range y {
+			if !matched[i] && proto.Equal(nh, other) {
+				matched[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// nhgKey returns the nexthop group registry key
+// for a nexthop group name in a network instance.
+func nhgKey(networkInstance, name string) string {
+	return networkInstance + "/" + name
+}
+
+// validateNhgName checks that name is a valid NDK nexthop group name.
+// Name must be 1 to 255 characters long, contain only characters allowed by SR Linux
+// and end with "_sdk" or "_SDK".
+// An error wrapping ErrInvalidNhgName describes the violated constraint.
+func validateNhgName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidNhgName)
+	case len(name) > maxNhgNameLen:
+		return fmt.Errorf("%w: name %.32q... is %d characters long, maximum is %d",
+			ErrInvalidNhgName, name, len(name), maxNhgNameLen)
+	case !nhgNameRe.MatchString(name):
+		return fmt.Errorf("%w: name %q contains illegal characters", ErrInvalidNhgName, name)
+	case !strings.HasSuffix(name, "_sdk") && !strings.HasSuffix(name, "_SDK"):
+		return fmt.Errorf("%w: name %q must end with _sdk or _SDK", ErrInvalidNhgName, name)
+	}
+	return nil
+}
@@ -0,0 +1,533 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/grpc"
+)
+
+// fakeNhgService is a fake NDK SdkMgrNextHopGroupServiceClient
+// which records requests and responds with success.
+type fakeNhgService struct {
+	ndk.SdkMgrNextHopGroupServiceClient
+
+	addReqs    []*ndk.NextHopGroupRequest
+	deleteReqs []*ndk.NextHopGroupDeleteRequest
+	// addFailed makes NextHopGroupAddOrUpdate calls fail.
+	addFailed bool
+	// calls records RPC names in order if set.
+	calls      *[]string
+	syncStarts int
+	syncEnds   int
+}
+
+func (f *fakeNhgService) NextHopGroupAddOrUpdate(_ context.Context, req *ndk.NextHopGroupRequest, _ ...grpc.CallOption) (*ndk.NextHopGroupResponse, error) {
+	f.addReqs = append(f.addReqs, req)
+	if f.calls != nil {
+		*f.calls = append(*f.calls, "NextHopGroupAddOrUpdate")
+	}
+	if f.addFailed {
+		return &ndk.NextHopGroupResponse{Status: ndk.SdkMgrStatus_kSdkMgrFailed}, nil
+	}
+	return &ndk.NextHopGroupResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeNhgService) NextHopGroupDelete(_ context.Context, req *ndk.NextHopGroupDeleteRequest, _ ...grpc.CallOption) (*ndk.NextHopGroupDeleteResponse, error) {
+	f.deleteReqs = append(f.deleteReqs, req)
+	return &ndk.NextHopGroupDeleteResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeNhgService) SyncStart(_ context.Context, _ *ndk.SyncRequest, _ ...grpc.CallOption) (*ndk.SyncResponse, error) {
+	f.syncStarts++
+	return &ndk.SyncResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeNhgService) SyncEnd(_ context.Context, _ *ndk.SyncRequest, _ ...grpc.CallOption) (*ndk.SyncResponse, error) {
+	f.syncEnds++
+	return &ndk.SyncResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func TestNextHopGroupDeleteMany(t *testing.T) {
+	a := newTestAgent(t)
+	nhgService := &fakeNhgService{}
+	a.stubs = &stubs{nextHopGroupService: nhgService}
+
+	err := a.NextHopGroupAdd(
+		NewNextHopGroup(WithNetworkInstanceName("default"), WithName("nhg1_sdk")),
+		NewNextHopGroup(WithNetworkInstanceName("default"), WithName("nhg2_sdk")),
+		NewNextHopGroup(WithNetworkInstanceName("default"), WithName("nhg3_sdk")),
+	)
+	if err != nil {
+		t.Fatalf("NextHopGroupAdd() returned error: %v", err)
+	}
+
+	err = a.NextHopGroupDeleteMany("default", "nhg1_sdk", "nhg2_sdk")
+	if err != nil {
+		t.Fatalf("NextHopGroupDeleteMany() returned error: %v", err)
+	}
+
+	if len(nhgService.deleteReqs) != 1 {
+		t.Fatalf("NextHopGroupDelete RPC called %d times, want 1", len(nhgService.deleteReqs))
+	}
+	keys := nhgService.deleteReqs[0].GetGroupKey()
+	if len(keys) != 2 {
+		t.Fatalf("delete request has %d keys, want 2", len(keys))
+	}
+	for i, want := range []string{"nhg1_sdk", "nhg2_sdk"} {
+		if keys[i].GetName() != want || keys[i].GetNetworkInstanceName() != "default" {
+			t.Errorf("key[%d] = %v, want name %s in default", i, keys[i], want)
+		}
+	}
+
+	for name, want := range map[string]bool{"nhg1_sdk": false, "nhg2_sdk": false, "nhg3_sdk": true} {
+		if _, ok := a.nhgs.get(nhgKey("default", name)); ok != want {
+			t.Errorf("registry contains %s = %t, want %t", name, ok, want)
+		}
+	}
+}
+
+func TestNextHopGroupDeleteManyNoNames(t *testing.T) {
+	a := newTestAgent(t)
+	nhgService := &fakeNhgService{}
+	a.stubs = &stubs{nextHopGroupService: nhgService}
+
+	if err := a.NextHopGroupDeleteMany("default"); err != nil {
+		t.Fatalf("NextHopGroupDeleteMany() returned error: %v", err)
+	}
+	if len(nhgService.deleteReqs) != 0 {
+		t.Errorf("NextHopGroupDelete RPC called %d times, want 0", len(nhgService.deleteReqs))
+	}
+}
+
+func TestNextHopGroupReplaceNextHops(t *testing.T) {
+	a := newTestAgent(t)
+	nhgService := &fakeNhgService{}
+	a.stubs = &stubs{nextHopGroupService: nhgService}
+
+	err := a.NextHopGroupAdd(NewNextHopGroup(WithNetworkInstanceName("default"), WithName("ndk_sdk"),
+		WithIpNextHop("192.168.1.1", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+		WithIpNextHop("192.168.1.2", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR)))
+	if err != nil {
+		t.Fatalf("NextHopGroupAdd() returned error: %v", err)
+	}
+
+	err = a.NextHopGroupReplaceNextHops("default", "ndk_sdk",
+		NextHopSpec{Address: "192.168.2.1", ResolveTo: ndk.NextHop_DIRECT, Type: ndk.NextHop_REGULAR},
+		NextHopSpec{Address: "2001:db8::1", Labels: []uint32{100, 200}, ResolveTo: ndk.NextHop_INDIRECT, Type: ndk.NextHop_REGULAR},
+	)
+	if err != nil {
+		t.Fatalf("NextHopGroupReplaceNextHops() returned error: %v", err)
+	}
+
+	if len(nhgService.addReqs) != 2 {
+		t.Fatalf("NextHopGroupAddOrUpdate RPC called %d times, want 2", len(nhgService.addReqs))
+	}
+	groups := nhgService.addReqs[1].GetGroupInfo()
+	if len(groups) != 1 {
+		t.Fatalf("replace request has %d nexthop groups, want 1", len(groups))
+	}
+	if key := groups[0].GetKey(); key.GetName() != "ndk_sdk" || key.GetNetworkInstanceName() != "default" {
+		t.Errorf("replaced nexthop group key = %v, want ndk_sdk in default", key)
+	}
+
+	nhs := groups[0].GetData().GetNextHop()
+	if len(nhs) != 2 {
+		t.Fatalf("replaced nexthop group has %d nexthops, want 2", len(nhs))
+	}
+	if got := formatAddr(nhs[0].GetIpNexthop()); got != "192.168.2.1" {
+		t.Errorf("nexthop[0] = %s, want 192.168.2.1", got)
+	}
+	mpls := nhs[1].GetMplsNexthop()
+	if got := formatAddr(mpls.GetIpNexthop()); got != "2001:db8::1" || len(mpls.GetLabelStack()) != 2 ||
+		nhs[1].GetResolveTo() != ndk.NextHop_INDIRECT {
+		t.Errorf("nexthop[1] = %v, want MPLS nexthop 2001:db8::1 with 2 labels resolving to indirect", nhs[1])
+	}
+
+	nhg, ok := a.nhgs.get(nhgKey("default", "ndk_sdk"))
+	if !ok || len(nhg.GetData().GetNextHop()) != 2 ||
+		formatAddr(nhg.GetData().GetNextHop()[0].GetIpNexthop()) != "192.168.2.1" {
+		t.Errorf("registry nexthop group = %v, want replaced nexthops", nhg)
+	}
+}
+
+func TestNextHopGroupReplaceNextHopsEmpty(t *testing.T) {
+	a := newTestAgent(t)
+	nhgService := &fakeNhgService{}
+	a.stubs = &stubs{nextHopGroupService: nhgService}
+
+	err := a.NextHopGroupReplaceNextHops("default", "ndk_sdk")
+	if !errors.Is(err, ErrNoNextHops) {
+		t.Errorf("NextHopGroupReplaceNextHops() error = %v, want %v", err, ErrNoNextHops)
+	}
+	if len(nhgService.addReqs) != 0 {
+		t.Errorf("NextHopGroupAddOrUpdate RPC called %d times, want 0", len(nhgService.addReqs))
+	}
+}
+
+func TestNextHopGroupAddNameValidation(t *testing.T) {
+	tests := map[string]struct {
+		name    string
+		wantErr bool
+	}{
+		"Valid name": {
+			name: "ndk_sdk",
+		},
+		"Valid upper case suffix": {
+			name: "ndk.group-1_SDK",
+		},
+		"Maximum length": {
+			name: strings.Repeat("a", 251) + "_sdk",
+		},
+		"Over maximum length": {
+			name:    strings.Repeat("a", 252) + "_sdk",
+			wantErr: true,
+		},
+		"Empty": {
+			wantErr: true,
+		},
+		"Illegal character": {
+			name:    "ndk*group_sdk",
+			wantErr: true,
+		},
+		"Non-ASCII character": {
+			name:    "ndké_sdk",
+			wantErr: true,
+		},
+		"Leading space": {
+			name:    " ndk_sdk",
+			wantErr: true,
+		},
+		"Missing suffix": {
+			name:    "ndk",
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			nhgService := &fakeNhgService{}
+			a.stubs = &stubs{nextHopGroupService: nhgService}
+
+			err := a.NextHopGroupAdd(NewNextHopGroup(WithNetworkInstanceName("default"), WithName(tt.name)))
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidNhgName) {
+					t.Errorf("NextHopGroupAdd() = %v, want %v", err, ErrInvalidNhgName)
+				}
+				if len(nhgService.addReqs) != 0 {
+					t.Errorf("NextHopGroupAddOrUpdate RPC called for invalid name")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("NextHopGroupAdd() returned unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNextHopGroupAddAddressValidation(t *testing.T) {
+	tests := map[string]struct {
+		opt     NextHopGroupOption
+		wantErr bool
+	}{
+		"IPv4 nexthop": {
+			opt: WithIpNextHop("192.168.1.1", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+		},
+		"IPv6 nexthop": {
+			opt: WithIpNextHop("2001:db8::1", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+		},
+		"IPv6 MPLS nexthop": {
+			opt: WithMplsNextHop("2001:db8::1", []uint32{100}, ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+		},
+		"Bad IPv6 nexthop": {
+			opt:     WithIpNextHop("2001:db8:::1", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+			wantErr: true,
+		},
+		"Bad IPv6 MPLS nexthop": {
+			opt:     WithMplsNextHop("2001:db8::g", []uint32{100}, ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+			wantErr: true,
+		},
+		"IPv4 nexthop with prefix": {
+			opt:     WithIpNextHop("192.168.1.1/24", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+			wantErr: true,
+		},
+		"IPv6 nexthop with prefix": {
+			opt:     WithIpNextHop("2001:db8::1/64", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+			wantErr: true,
+		},
+		"Empty nexthop": {
+			opt:     WithIpNextHop("", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			nhgService := &fakeNhgService{}
+			a.stubs = &stubs{nextHopGroupService: nhgService}
+
+			nhg := NewNextHopGroup(WithNetworkInstanceName("default"), WithName("ndk_sdk"), tt.opt)
+			err := a.NextHopGroupAdd(nhg)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIpAddr) {
+					t.Errorf("NextHopGroupAdd() = %v, want %v", err, ErrInvalidIpAddr)
+				}
+				if len(nhgService.addReqs) != 0 {
+					t.Errorf("NextHopGroupAddOrUpdate RPC called for invalid nexthop")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextHopGroupAdd() returned unexpected error: %v", err)
+			}
+			if got := len(nhg.GetData().GetNextHop()); got != 1 {
+				t.Errorf("nexthop group has %d nexthops, want 1", got)
+			}
+		})
+	}
+}
+
+func TestNextHopGroupAddInvalidRetry(t *testing.T) {
+	a := newTestAgent(t)
+	nhgService := &fakeNhgService{}
+	a.stubs = &stubs{nextHopGroupService: nhgService}
+
+	nhg := NewNextHopGroup(WithNetworkInstanceName("default"), WithName("ndk_sdk"),
+		WithIpNextHop("192.168.1.1", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR),
+		WithIpNextHop("192.168.1.x", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR))
+	for i := 0; i < 2; i++ {
+		if err := a.NextHopGroupAdd(nhg); !errors.Is(err, ErrInvalidIpAddr) {
+			t.Errorf("NextHopGroupAdd() call %d = %v, want %v", i, err, ErrInvalidIpAddr)
+		}
+	}
+	if err := a.NextHopGroupUpdate(nhg); !errors.Is(err, ErrInvalidIpAddr) {
+		t.Errorf("NextHopGroupUpdate() = %v, want %v", err, ErrInvalidIpAddr)
+	}
+	if len(nhgService.addReqs) != 0 {
+		t.Errorf("NextHopGroupAddOrUpdate RPC called for invalid nexthop group")
+	}
+	if nhgService.syncStarts != 0 {
+		t.Errorf("nexthop group sync started %d times for invalid nexthop group, want 0", nhgService.syncStarts)
+	}
+}
+
+func TestNextHopGroupOptionsOnSliceElement(t *testing.T) {
+	a := newTestAgent(t)
+	nhgService := &fakeNhgService{}
+	a.stubs = &stubs{nextHopGroupService: nhgService}
+
+	// options applied to groups not at the beginning of an allocation
+	nhgs := make([]ndk.NextHopGroupInfo, 3)
+	for i := range nhgs {
+		nhgs[i].Key = &ndk.NextHopGroupKey{NetworkInstanceName: "default", Name: "ndk_sdk"}
+		nhgs[i].Data = &ndk.NextHopGroup{}
+	}
+	WithIpNextHop("192.168.1.x", ndk.NextHop_DIRECT, ndk.NextHop_REGULAR)(&nhgs[1])
+	WithMplsNextHop("192.168.1.1", []uint32{3}, ndk.NextHop_DIRECT, ndk.NextHop_REGULAR)(&nhgs[2])
+
+	if err := a.NextHopGroupAdd(&nhgs[1]); !errors.Is(err, ErrInvalidIpAddr) {
+		t.Errorf("NextHopGroupAdd() = %v, want %v", err, ErrInvalidIpAddr)
+	}
+	if err := a.NextHopGroupAdd(&nhgs[2]); !errors.Is(err, ErrInvalidMplsLabel) {
+		t.Errorf("NextHopGroupAdd() = %v, want %v", err, ErrInvalidMplsLabel)
+	}
+	if len(nhgService.addReqs) != 0 {
+		t.Errorf("NextHopGroupAddOrUpdate RPC called for invalid nexthop groups")
+	}
+}
+
+func TestNextHopGroupAddMplsLabelValidation(t *testing.T) {
+	tests := map[string]struct {
+		labels  []uint32
+		wantErr bool
+	}{
+		"Valid labels": {
+			labels: []uint32{16, 100, 1048575},
+		},
+		"No labels": {},
+		"Explicit null labels": {
+			labels: []uint32{0, 2},
+		},
+		"Implicit null label": {
+			labels:  []uint32{100, 3},
+			wantErr: true,
+		},
+		"Over range label": {
+			labels:  []uint32{1048576},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			nhgService := &fakeNhgService{}
+			a.stubs = &stubs{nextHopGroupService: nhgService}
+
+			nhg := NewNextHopGroup(WithNetworkInstanceName("default"), WithName("ndk_sdk"),
+				WithMplsNextHop("192.168.1.1", tt.labels, ndk.NextHop_DIRECT, ndk.NextHop_REGULAR))
+			err := a.NextHopGroupAdd(nhg)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMplsLabel) {
+					t.Errorf("NextHopGroupAdd() = %v, want %v", err, ErrInvalidMplsLabel)
+				}
+				if len(nhgService.addReqs) != 0 {
+					t.Errorf("NextHopGroupAddOrUpdate RPC called for invalid label")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextHopGroupAdd() returned unexpected error: %v", err)
+			}
+			got := nhg.GetData().GetNextHop()[0].GetMplsNexthop().GetLabelStack()
+			if len(got) != len(tt.labels) {
+				t.Errorf("nexthop has %d labels, want %d", len(got), len(tt.labels))
+			}
+		})
+	}
+}
+
+func TestPruneOrphanNextHopGroups(t *testing.T) {
+	a := newTestAgent(t)
+	nhgService := &fakeNhgService{}
+	a.stubs = &stubs{nextHopGroupService: nhgService, routeService: &fakeRouteService{}}
+
+	err := a.NextHopGroupAdd(
+		NewNextHopGroup(WithNetworkInstanceName("default"), WithName("used_sdk")),
+		NewNextHopGroup(WithNetworkInstanceName("default"), WithName("orphan2_sdk")),
+		NewNextHopGroup(WithNetworkInstanceName("default"), WithName("orphan1_sdk")),
+		NewNextHopGroup(WithNetworkInstanceName("vrf1"), WithName("used_sdk")),
+		NewNextHopGroup(WithNetworkInstanceName("vrf1"), WithName("deleted_sdk")),
+	)
+	if err != nil {
+		t.Fatalf("NextHopGroupAdd() returned error: %v", err)
+	}
+	err = a.RouteAdd(
+		NewRoute(WithNetInstName("default"), WithIpPrefix("192.168.1.0/24"), WithNextHopGroupName("used_sdk")),
+		NewRoute(WithNetInstName("vrf1"), WithIpPrefix("192.168.1.0/24"), WithNextHopGroupName("used_sdk")),
+		NewRoute(WithNetInstName("vrf1"), WithIpPrefix("192.168.2.0/24"), WithNextHopGroupName("deleted_sdk")),
+	)
+	if err != nil {
+		t.Fatalf("RouteAdd() returned error: %v", err)
+	}
+	if err := a.RouteDelete("vrf1", "192.168.2.0/24"); err != nil {
+		t.Fatalf("RouteDelete() returned error: %v", err)
+	}
+
+	pruned, err := a.PruneOrphanNextHopGroups()
+	if err != nil {
+		t.Fatalf("PruneOrphanNextHopGroups() returned error: %v", err)
+	}
+	want := []string{"deleted_sdk", "orphan1_sdk", "orphan2_sdk"}
+	if !reflect.DeepEqual(pruned, want) {
+		t.Errorf("PruneOrphanNextHopGroups() = %v, want %v", pruned, want)
+	}
+
+	if len(nhgService.deleteReqs) != 2 {
+		t.Fatalf("NextHopGroupDelete RPC called %d times, want 2", len(nhgService.deleteReqs))
+	}
+	programmed := a.NextHopGroupSnapshot()
+	for key, want := range map[string]bool{
+		"default/used_sdk": true, "vrf1/used_sdk": true,
+		"default/orphan1_sdk": false, "default/orphan2_sdk": false, "vrf1/deleted_sdk": false,
+	} {
+		if _, ok := programmed[key]; ok != want {
+			t.Errorf("nexthop group %s programmed = %t, want %t", key, ok, want)
+		}
+	}
+
+	pruned, err = a.PruneOrphanNextHopGroups()
+	if err != nil || len(pruned) != 0 {
+		t.Errorf("second PruneOrphanNextHopGroups() = %v, %v, want no pruned groups", pruned, err)
+	}
+}
+
+func TestDiffNextHopGroups(t *testing.T) {
+	nhg := func(ni, name string, nexthops ...string) *ndk.NextHopGroupInfo {
+		opts := []NextHopGroupOption{WithNetworkInstanceName(ni), WithName(name)}
+		for _, nh := range nexthops {
+			opts = append(opts, WithIpNextHop(nh, ndk.NextHop_DIRECT, ndk.NextHop_REGULAR))
+		}
+		return NewNextHopGroup(opts...)
+	}
+	indirect := NewNextHopGroup(WithNetworkInstanceName("default"), WithName("a_sdk"),
+		WithIpNextHop("10.0.0.1", ndk.NextHop_INDIRECT, ndk.NextHop_REGULAR))
+
+	tests := map[string]struct {
+		desired    []*ndk.NextHopGroupInfo
+		current    []*ndk.NextHopGroupInfo
+		wantAdd    []string
+		wantUpdate []string
+		wantDelete []string
+	}{
+		"Unchanged": {
+			desired: []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.2")},
+			current: []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.2")},
+		},
+		"Reordered nexthops": {
+			desired: []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.2", "10.0.0.1")},
+			current: []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.2")},
+		},
+		"Added and deleted groups": {
+			desired:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1"), nhg("mgmt", "a_sdk", "10.0.0.1")},
+			current:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1"), nhg("default", "b_sdk", "10.0.0.1")},
+			wantAdd:    []string{"mgmt/a_sdk"},
+			wantDelete: []string{"default/b_sdk"},
+		},
+		"Added nexthop": {
+			desired:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.2")},
+			current:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1")},
+			wantUpdate: []string{"default/a_sdk"},
+		},
+		"Removed nexthop": {
+			desired:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1")},
+			current:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.2")},
+			wantUpdate: []string{"default/a_sdk"},
+		},
+		"Replaced nexthop": {
+			desired:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.3")},
+			current:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.2")},
+			wantUpdate: []string{"default/a_sdk"},
+		},
+		"Duplicate nexthop": {
+			desired:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.1")},
+			current:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1", "10.0.0.2")},
+			wantUpdate: []string{"default/a_sdk"},
+		},
+		"Changed resolve-to type": {
+			desired:    []*ndk.NextHopGroupInfo{indirect},
+			current:    []*ndk.NextHopGroupInfo{nhg("default", "a_sdk", "10.0.0.1")},
+			wantUpdate: []string{"default/a_sdk"},
+		},
+	}
+
+	keys := func(nhgs []*ndk.NextHopGroupInfo) []string {
+		var ks []string
+		for _, nhg := range nhgs {
+			ks = append(ks, nhgKey(nhg.GetKey().GetNetworkInstanceName(), nhg.GetKey().GetName()))
+		}
+		return ks
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			toAdd, toUpdate, toDelete := DiffNextHopGroups(tc.desired, tc.current)
+			if got := keys(toAdd); !reflect.DeepEqual(got, tc.wantAdd) {
+				t.Errorf("DiffNextHopGroups() toAdd = %v, want %v", got, tc.wantAdd)
+			}
+			if got := keys(toUpdate); !reflect.DeepEqual(got, tc.wantUpdate) {
+				t.Errorf("DiffNextHopGroups() toUpdate = %v, want %v", got, tc.wantUpdate)
+			}
+			if got := keys(toDelete); !reflect.DeepEqual(got, tc.wantDelete) {
+				t.Errorf("DiffNextHopGroups() toDelete = %v, want %v", got, tc.wantDelete)
+			}
+		})
+	}
+}
@@ -6,12 +6,34 @@ import (
 	"time"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/protobuf/encoding/prototext"
+)
+
+// NotificationType is the type of a notification stream.
+// It identifies notifications, e.g. in LastNotification,
+// metrics hooks and log messages.
+type NotificationType string
+
+// Notification stream types.
+const (
+	NotificationTypeConfig          NotificationType = "Config"
+	NotificationTypeInterface       NotificationType = "Interface"
+	NotificationTypeRoute           NotificationType = "Route"
+	NotificationTypeNextHopGroup    NotificationType = "Nexthop group"
+	NotificationTypeNetworkInstance NotificationType = "Network instance"
+	NotificationTypeLldpNeighbor    NotificationType = "Lldp Neighbor"
+	NotificationTypeBfdSession      NotificationType = "Bfd Session"
+	NotificationTypeAppId           NotificationType = "AppId"
 )
 
 // Notifications contains channels for various NDK notifications.
 // By default, the entire app's configs is stored in config buffer.
 // To populate channels for other notification types (e.g. interface),
 // explicit calls to `Receive<type>Notifications` methods are required.
+// NDK does not support sizing the server-side queue of notification streams,
+// neither the stream create request nor the subscription requests carry a queue size.
+// Notifications are buffered by gRPC flow control until the channels are read,
+// slow readers can be detected with the WithMetricsHook option.
 type Notifications struct {
 	// FullConfigReceived chan receives the value and stores in FullConfig
 	// when the entire application's config is received by the stream client.
@@ -24,11 +46,20 @@ type Notifications struct {
 	// that is retrieved from the gNMI server once the commit is done.
 	// Applications are expected to read from this buffer to populate
 	// their Config and State struct.
+	// FullConfig is nil if the app has no config, e.g. after it was deleted.
 	//
 	// This buffer will not be used if streaming of configs
 	// is enabled with WithStreamConfig option.
 	FullConfig []byte
 
+	// FullConfigTruncated is true if the gNMI server returned
+	// more than one update for the application's config
+	// and FullConfig holds only the first one.
+	//
+	// This flag will not be used if streaming of configs
+	// is enabled with WithStreamConfig option.
+	FullConfigTruncated bool
+
 	// Config chan receives streamed config notifications for each individual app path.
 	// The contents of each notification is defined by ConfigNotification type.
 	// To stream configs, application has to register
@@ -37,6 +68,8 @@ type Notifications struct {
 	// config will be populated to the FullConfig buffer.
 	// bond does not allow application to simultaneously
 	// stream individual configs while also receiving full config.
+	// ConfigTree can be used to reconstruct the whole config
+	// from the streamed notifications.
 	//
 	// This channel will not be used if Agent does not
 	// have WithStreamConfig option set.
@@ -50,10 +83,17 @@ type Notifications struct {
 	// Route chan receives streamed route notifications.
 	// Method ReceiveRouteNotifications starts stream
 	// and populates notifications in chan Route.
+	// Buffer size and overflow policy of chan Route
+	// can be set with WithRouteNotificationBuffer.
 	Route chan *ndk.IpRouteNotification
 
+	// RouteEvent chan receives typed route notifications.
+	// Method ReceiveRouteNotifications populates notifications in chan RouteEvent
+	// in addition to chan Route if Agent has option WithTypedNotifications set.
+	RouteEvent chan *RouteNotification
+
 	// NextHopGroup chan receives streamed next hop group notifications.
-	// Method ReceiveNexthopGroupNotifications starts stream
+	// Method ReceiveNextHopGroupNotifications starts stream
 	// and populates notifications in chan NextHopGroup.
 	NextHopGroup chan *ndk.NextHopGroupNotification
 
@@ -63,15 +103,25 @@ type Notifications struct {
 	NwInst chan *ndk.NetworkInstanceNotification
 
 	// Lldp chan receives streamed LLDP neighbor notifications.
-	// Method ReceiveLLDPNotifications starts stream
+	// Method ReceiveLldpNotifications starts stream
 	// and populates notifications in chan Lldp.
 	Lldp chan *ndk.LldpNeighborNotification
 
+	// LldpNeighbor chan receives typed LLDP neighbor notifications.
+	// Method ReceiveLldpNotifications populates notifications in chan LldpNeighbor
+	// in addition to chan Lldp if Agent has option WithTypedNotifications set.
+	LldpNeighbor chan *LldpNeighborNotification
+
 	// Bfd chan receives streamed Bfd Session notifications.
 	// Method ReceiveBfdNotifications starts stream
 	// and populates notifications in chan Bfd.
 	Bfd chan *ndk.BfdSessionNotification
 
+	// BfdSession chan receives typed Bfd Session notifications.
+	// Method ReceiveBfdNotifications populates notifications in chan BfdSession
+	// in addition to chan Bfd if Agent has option WithTypedNotifications set.
+	BfdSession chan *BfdSessionNotification
+
 	// AppId chan receives streamed App identifier notifications.
 	// Method ReceiveAppIdNotifications starts stream
 	// and populates notifications in chan AppId.
@@ -81,7 +131,10 @@ type Notifications struct {
 // createNotificationStream creates a notification stream and returns the Stream ID.
 // Stream ID is used to register notifications for other services.
 // It retries with retryTimeout until it succeeds.
-func (a *Agent) createNotificationStream(ctx context.Context) uint64 {
+// A successful response with stream ID 0 is treated as a failure,
+// since no notifications can be streamed without a valid stream ID.
+// ctx.Err() is returned if ctx is done before the stream is created.
+func (a *Agent) createNotificationStream(ctx context.Context) (uint64, error) {
 	for {
 		// get subscription and streamID
 		notificationResponse, err := a.stubs.sdkMgrService.NotificationRegister(ctx,
@@ -93,12 +146,53 @@ func (a *Agent) createNotificationStream(ctx context.Context) uint64 {
 				a.Name, err, notificationResponse.GetStatus().String())
 			a.logger.Printf("agent %q retrying in %s", a.Name, a.retryTimeout)
 
-			time.Sleep(a.retryTimeout)
+			if err := a.waitRetry(ctx); err != nil {
+				return 0, err
+			}
 
 			continue
 		}
 
-		return notificationResponse.GetStreamId()
+		streamID := notificationResponse.GetStreamId()
+		if streamID == 0 {
+			a.logger.Printf("agent %q received invalid stream ID 0 on notification register", a.Name)
+			a.logger.Printf("agent %q retrying in %s", a.Name, a.retryTimeout)
+
+			if err := a.waitRetry(ctx); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		return streamID, nil
+	}
+}
+
+// waitRetry waits retryTimeout before a failed NDK call is retried.
+// ctx.Err() is returned if ctx is done before retryTimeout passed.
+func (a *Agent) waitRetry(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.clock.After(a.retryTimeout):
+		return nil
+	}
+}
+
+// deleteNotificationStream deletes all subscriptions
+// of the notification stream streamID.
+// Failures are logged, since the stream is not used anymore.
+func (a *Agent) deleteNotificationStream(ctx context.Context, streamID uint64) {
+	resp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, &ndk.NotificationRegisterRequest{
+		Op:       ndk.NotificationRegisterRequest_Delete,
+		StreamId: streamID,
+	})
+	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
+		a.logger.Error().
+			Err(err).
+			Uint64("stream-id", streamID).
+			Msgf("Failed to delete notification stream, response: %v", resp)
 	}
 }
 
@@ -116,7 +210,14 @@ func (a *Agent) startNotificationStream(ctx context.Context,
 		Str("subscription-type", subscType).
 		Msg("Starting streaming notifications")
 
-	streamClient := a.getNotificationStreamClient(ctx, streamID)
+	streamClient, err := a.getNotificationStreamClient(ctx, streamID)
+	if err != nil {
+		a.logger.Info().
+			Uint64("stream-id", streamID).
+			Str("subscription-type", subscType).
+			Msg("agent context has cancelled, exiting notification stream")
+		return
+	}
 
 	for {
 		streamResp, err := streamClient.Recv()
@@ -135,7 +236,9 @@ func (a *Agent) startNotificationStream(ctx context.Context,
 					Str("subscription-type", subscType).
 					Msgf("received EOF, retrying in %s", a.retryTimeout)
 
-				time.Sleep(a.retryTimeout)
+				if a.waitRetry(ctx) != nil {
+					return
+				}
 
 				continue
 			}
@@ -143,12 +246,14 @@ func (a *Agent) startNotificationStream(ctx context.Context,
 			if err != nil {
 				a.logger.Error().
 					Err(err).
-					Str("timestamp", time.Now().String()).
+					Str("timestamp", a.clock.Now().String()).
 					Uint64("stream-id", streamID).
 					Str("subscription-type", subscType).
 					Msgf("failed to receive notification, retrying in %s", a.retryTimeout)
 
-				time.Sleep(a.retryTimeout)
+				if a.waitRetry(ctx) != nil {
+					return
+				}
 
 				continue
 			}
@@ -160,7 +265,8 @@ func (a *Agent) startNotificationStream(ctx context.Context,
 
 // getNotificationStreamClient acquires the notification stream client that is used to receive
 // streamed notifications.
-func (a *Agent) getNotificationStreamClient(ctx context.Context, streamID uint64) ndk.SdkNotificationService_NotificationStreamClient {
+// ctx.Err() is returned if ctx is done before the client is acquired.
+func (a *Agent) getNotificationStreamClient(ctx context.Context, streamID uint64) (ndk.SdkNotificationService_NotificationStreamClient, error) {
 	for {
 		streamClient, err := a.stubs.notificationService.NotificationStream(ctx,
 			&ndk.NotificationStreamRequest{
@@ -170,11 +276,188 @@ func (a *Agent) getNotificationStreamClient(ctx context.Context, streamID uint64
 			a.logger.Info().Msgf("agent %s failed creating stream client with stream ID=%d: %v", a.Name, streamID, err)
 			a.logger.Printf("agent %s retrying in %s", a.Name, a.retryTimeout)
 
-			time.Sleep(a.retryTimeout)
+			if err := a.waitRetry(ctx); err != nil {
+				return nil, err
+			}
 
 			continue
 		}
 
-		return streamClient
+		return streamClient, nil
+	}
+}
+
+// logNotificationResponse logs the full contents of a notification stream response
+// at debug level if verbose notification logging is enabled
+// with option WithVerboseNotificationLogging.
+// Responses are marshaled on a single line if Agent has
+// option WithCompactNotificationLogging set.
+// notifType is the notification type used in log messages.
+// Failure to marshal the response is logged and does not affect
+// processing of the response notifications.
+func (a *Agent) logNotificationResponse(notifType NotificationType, resp *ndk.NotificationStreamResponse) {
+	if !a.verboseNotifLogging {
+		return
+	}
+
+	opts := prototext.MarshalOptions{Multiline: true, Indent: "  "}
+	if a.compactNotifLogging {
+		opts = prototext.MarshalOptions{}
+	}
+	b, err := opts.Marshal(resp)
+	if err != nil {
+		a.logger.Info().
+			Msgf("%s notification Marshal failed: %+v", notifType, err)
+		return
+	}
+
+	if a.compactNotifLogging {
+		a.logger.Debug().
+			Msgf("Received %s notifications: %s", notifType, b)
+		return
+	}
+	a.logger.Debug().
+		Msgf("Received %s notifications:\n%s", notifType, b)
+}
+
+// startReceiving records that notifications of notifType are received.
+// false is returned if they are already received, in which case
+// the Receive<type>Notifications method must return without closing
+// its Notifications chans, which are closed by the first call.
+func (a *Agent) startReceiving(notifType NotificationType) bool {
+	if _, loaded := a.receiving.LoadOrStore(notifType, struct{}{}); loaded {
+		a.logger.Error().
+			Msgf("%s notifications are already received, Notifications chans can only be read once", notifType)
+		return false
+	}
+	return true
+}
+
+// subscribe creates a notification stream for notifications of notifType,
+// adds the subscription set by register to it and calls deliver
+// for every notification extracted by extract from the streamed responses.
+// Notifications for which extract returns nil are logged, skipped
+// and reported to the EmptyNotification metrics hook.
+// The receive time of every notification is recorded for LastNotification.
+// subscribe blocks until the notification stream ends
+// and removes the subscription of notifType afterwards.
+func subscribe[T comparable](ctx context.Context, a *Agent, notifType NotificationType,
+	register func(req *ndk.NotificationRegisterRequest),
+	extract func(n *ndk.Notification) T,
+	deliver func(n T),
+) {
+	var empty T
+	stream := a.startSubscriptionStream(ctx, notifType, register)
+
+	for streamResp := range stream {
+		a.logNotificationResponse(notifType, streamResp)
+
+		for _, n := range streamResp.GetNotification() {
+			a.notificationReceived(notifType)
+			notif := extract(n)
+			if notif == empty {
+				a.logger.Info().
+					Msgf("Empty %s notification:%+v", streamLogLabels[notifType].empty, n)
+				a.emptyNotification(notifType)
+				continue
+			}
+			deliver(notif)
+		}
+	}
+
+	a.subscriptions.delete(string(notifType))
+}
+
+// startSubscriptionStream creates a notification stream for notifications of notifType,
+// adds the subscription set by register to it and starts streaming notifications.
+// The returned channel is closed without streaming notifications
+// if ctx is done before the stream is created.
+func (a *Agent) startSubscriptionStream(ctx context.Context, notifType NotificationType,
+	register func(req *ndk.NotificationRegisterRequest),
+) chan *ndk.NotificationStreamResponse {
+	streamChan := make(chan *ndk.NotificationStreamResponse)
+	streamID, err := a.createNotificationStream(ctx)
+	if err != nil {
+		a.logger.Info().Err(err).
+			Msgf("%s notification stream not created", notifType)
+		close(streamChan)
+		return streamChan
+	}
+
+	a.logger.Info().
+		Uint64("stream-id", streamID).
+		Msg(streamLogLabels[notifType].created)
+
+	subID := a.addSubscription(ctx, streamID, register)
+	a.subscriptions.set(string(notifType), subscription{streamID: streamID, subID: subID})
+
+	go a.startNotificationStream(ctx, streamID,
+		streamLogLabels[notifType].subscType, streamChan)
+
+	return streamChan
+}
+
+// streamLogLabel holds the names of a notification type used in the log messages
+// of its notification stream.
+type streamLogLabel struct {
+	empty     string // notification name in empty notification messages
+	created   string // stream created message
+	subscType string // subscription-type field
+}
+
+// streamLogLabels contains the log labels keyed by notification type.
+var streamLogLabels = map[NotificationType]streamLogLabel{
+	NotificationTypeConfig:          {"configuration", "Config notification stream created", "config"},
+	NotificationTypeInterface:       {"interface", "Interface notification stream created", "interface"},
+	NotificationTypeRoute:           {"route", "Route notification stream created", "route"},
+	NotificationTypeNextHopGroup:    {"Nexthop group", "Nhg Notification stream created", "nhg"},
+	NotificationTypeNetworkInstance: {"network instance", "Network Instance notification stream created", "nwinst"},
+	NotificationTypeLldpNeighbor:    {"Lldp Neighbor", "Lldp Neighbor notification stream created", "Lldp neighbor"},
+	NotificationTypeBfdSession:      {"Bfd Session", "Bfd Session notification stream created", "bfdSession"},
+	NotificationTypeAppId:           {"AppId", "AppId Notification stream created", "AppId"},
+}
+
+// subscription identifies a subscription added to a notification stream.
+type subscription struct {
+	streamID uint64
+	subID    uint64
+}
+
+// addSubscription adds the subscription set by register
+// to the allocated notification stream and returns its subscription ID.
+// 0 is returned if the subscription could not be added.
+func (a *Agent) addSubscription(ctx context.Context, streamID uint64,
+	register func(req *ndk.NotificationRegisterRequest),
+) uint64 {
+	// create notification register request
+	// using acquired stream ID
+	notificationRegisterReq := &ndk.NotificationRegisterRequest{
+		Op:       ndk.NotificationRegisterRequest_AddSubscription,
+		StreamId: streamID,
 	}
+	register(notificationRegisterReq)
+
+	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
+	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
+		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
+			a.Name, notificationRegisterReq, err)
+		return 0
+	}
+
+	return registerResp.GetSubId()
+}
+
+// notificationReceived records the current time
+// as the last receive time of notifications of notifType.
+func (a *Agent) notificationReceived(notifType NotificationType) {
+	a.lastNotifs.set(string(notifType), a.clock.Now())
+}
+
+// LastNotification returns the time the last notification
+// of notifType was received, e.g. LastNotification(NotificationTypeRoute).
+// Monitoring can use it to detect normally active streams that went quiet.
+// The zero time is returned if no notification of notifType was received.
+func (a *Agent) LastNotification(notifType NotificationType) time.Time {
+	t, _ := a.lastNotifs.get(string(notifType))
+	return t
 }
@@ -0,0 +1,410 @@
+package bond
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use by loggers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestVerboseNotificationLogging(t *testing.T) {
+	tests := map[string]struct {
+		level    zerolog.Level
+		opts     []Option
+		wantDump bool
+	}{
+		"Default at info level": {
+			level: zerolog.InfoLevel,
+		},
+		"Default at debug level": {
+			level: zerolog.DebugLevel,
+		},
+		"Verbose at info level": {
+			level: zerolog.InfoLevel,
+			opts:  []Option{WithVerboseNotificationLogging()},
+		},
+		"Verbose at debug level": {
+			level:    zerolog.DebugLevel,
+			opts:     []Option{WithVerboseNotificationLogging()},
+			wantDump: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &syncBuffer{}
+			logger := zerolog.New(buf).Level(tt.level)
+			a := newTestAgent(t, append([]Option{WithLogger(&logger)}, tt.opts...)...)
+			withFakeStream(a, &ndk.Notification{
+				SubscriptionTypes: &ndk.Notification_Intf{
+					Intf: &ndk.InterfaceNotification{
+						Key: &ndk.InterfaceKey{IfName: "ethernet-1/1"},
+					},
+				},
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.ReceiveInterfaceNotifications(ctx)
+
+			<-a.Notifications.Interface
+
+			gotDump := strings.Contains(buf.String(), "Received Interface notifications")
+			if gotDump != tt.wantDump {
+				t.Errorf("notification dump logged = %t, want %t", gotDump, tt.wantDump)
+			}
+		})
+	}
+}
+
+func TestCompactNotificationLogging(t *testing.T) {
+	tests := map[string]struct {
+		opts        []Option
+		wantCompact bool
+	}{
+		"Multi-line dump": {
+			opts: []Option{WithVerboseNotificationLogging()},
+		},
+		"Compact dump": {
+			opts:        []Option{WithCompactNotificationLogging()},
+			wantCompact: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := &syncBuffer{}
+			logger := zerolog.New(buf).Level(zerolog.DebugLevel)
+			a := newTestAgent(t, append([]Option{WithLogger(&logger)}, tt.opts...)...)
+			withFakeStream(a, interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.ReceiveInterfaceNotifications(ctx)
+
+			<-a.Notifications.Interface
+
+			var dump string
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if strings.Contains(line, "Received Interface notifications") {
+					dump = line
+				}
+			}
+			if dump == "" {
+				t.Fatalf("notification dump not logged: %s", buf.String())
+			}
+			// zerolog escapes newlines of multi-line dumps in the JSON message
+			gotCompact := !strings.Contains(dump, `\n`)
+			if gotCompact != tt.wantCompact {
+				t.Errorf("compact dump = %t, want %t: %s", gotCompact, tt.wantCompact, dump)
+			}
+			if !strings.Contains(dump, `if_name:`) {
+				t.Errorf("dump = %s, want notification contents", dump)
+			}
+		})
+	}
+}
+
+func TestNotificationForwardedOnMarshalFailure(t *testing.T) {
+	buf := &syncBuffer{}
+	logger := zerolog.New(buf).Level(zerolog.DebugLevel)
+	a := newTestAgent(t, WithLogger(&logger), WithVerboseNotificationLogging())
+	// invalid UTF-8 in a string field fails prototext marshaling
+	withFakeStream(a, &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_Intf{
+			Intf: &ndk.InterfaceNotification{
+				Key: &ndk.InterfaceKey{IfName: "ethernet-1/1\xff"},
+			},
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveInterfaceNotifications(ctx)
+
+	select {
+	case n := <-a.Notifications.Interface:
+		if n.GetKey().GetIfName() != "ethernet-1/1\xff" {
+			t.Errorf("received notification for %q, want %q", n.GetKey().GetIfName(), "ethernet-1/1\xff")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not forwarded to Interface chan")
+	}
+
+	if !strings.Contains(buf.String(), "Interface notification Marshal failed") {
+		t.Errorf("marshal failure was not logged")
+	}
+}
+
+func TestDeprecatedReceiveAliases(t *testing.T) {
+	nhg := &ndk.NextHopGroupNotification{Key: 1}
+	lldp := &ndk.LldpNeighborNotification{Key: &ndk.LldpNeighborKeyPb{InterfaceName: "ethernet-1/1"}}
+
+	tests := map[string]struct {
+		receive func(a *Agent, ctx context.Context)
+		notif   *ndk.Notification
+		recv    func(a *Agent) proto.Message
+		want    proto.Message
+		subType any
+	}{
+		"ReceiveNexthopGroupNotifications": {
+			receive: (*Agent).ReceiveNexthopGroupNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_Nhg{Nhg: nhg}},
+			recv:    func(a *Agent) proto.Message { return <-a.Notifications.NextHopGroup },
+			want:    nhg,
+			subType: &ndk.NotificationRegisterRequest_Nhg{},
+		},
+		"ReceiveLLDPNotifications": {
+			receive: (*Agent).ReceiveLLDPNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_LldpNeighbor{LldpNeighbor: lldp}},
+			recv:    func(a *Agent) proto.Message { return <-a.Notifications.Lldp },
+			want:    lldp,
+			subType: &ndk.NotificationRegisterRequest_LldpNeighbor{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			mgr := withFakeStream(a, tc.notif)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go tc.receive(a, ctx)
+
+			if got := tc.recv(a); !proto.Equal(got, tc.want) {
+				t.Errorf("received %v, want %v", got, tc.want)
+			}
+
+			reqs := mgr.registerRequests()
+			got := reqs[len(reqs)-1].GetSubscriptionTypes()
+			if reflect.TypeOf(got) != reflect.TypeOf(tc.subType) {
+				t.Errorf("subscription type = %T, want %T", got, tc.subType)
+			}
+		})
+	}
+}
+
+// recvNotification receives a notification from ch
+// or fails the test if none is received in time.
+// nil is returned if ch is closed.
+func recvNotification[T proto.Message](t *testing.T, ch chan T) proto.Message {
+	t.Helper()
+	select {
+	case n, ok := <-ch:
+		if !ok {
+			return nil
+		}
+		return n
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for notification")
+		return nil
+	}
+}
+
+func TestReceiveNotifications(t *testing.T) {
+	intf := &ndk.InterfaceNotification{Key: &ndk.InterfaceKey{IfName: "ethernet-1/1"}}
+	route := &ndk.IpRouteNotification{Key: &ndk.RouteKeyPb{NetInstName: "default"}}
+	nhg := &ndk.NextHopGroupNotification{Key: 1}
+	nwInst := &ndk.NetworkInstanceNotification{Key: &ndk.NetworkInstanceKey{InstName: "default"}}
+	lldp := &ndk.LldpNeighborNotification{Key: &ndk.LldpNeighborKeyPb{InterfaceName: "ethernet-1/1"}}
+	bfd := p2pBfdSession(ndk.BfdmgrSessionStatus_UP)
+	appId := &ndk.AppIdentNotification{Key: &ndk.AppIdentKey{Id: 1}, Data: &ndk.AppIdentData{Name: "test"}}
+
+	tests := map[string]struct {
+		receive func(a *Agent, ctx context.Context)
+		notif   *ndk.Notification
+		recv    func(t *testing.T, a *Agent) proto.Message
+		want    proto.Message
+		subType any
+	}{
+		"interface": {
+			receive: (*Agent).ReceiveInterfaceNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_Intf{Intf: intf}},
+			recv:    func(t *testing.T, a *Agent) proto.Message { return recvNotification(t, a.Notifications.Interface) },
+			want:    intf,
+			subType: &ndk.NotificationRegisterRequest_Intf{},
+		},
+		"route": {
+			receive: func(a *Agent, ctx context.Context) { a.ReceiveRouteNotifications(ctx) },
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_Route{Route: route}},
+			recv:    func(t *testing.T, a *Agent) proto.Message { return recvNotification(t, a.Notifications.Route) },
+			want:    route,
+			subType: &ndk.NotificationRegisterRequest_Route{},
+		},
+		"nexthop group": {
+			receive: (*Agent).ReceiveNextHopGroupNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_Nhg{Nhg: nhg}},
+			recv:    func(t *testing.T, a *Agent) proto.Message { return recvNotification(t, a.Notifications.NextHopGroup) },
+			want:    nhg,
+			subType: &ndk.NotificationRegisterRequest_Nhg{},
+		},
+		"network instance": {
+			receive: (*Agent).ReceiveNetworkInstanceNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_NwInst{NwInst: nwInst}},
+			recv:    func(t *testing.T, a *Agent) proto.Message { return recvNotification(t, a.Notifications.NwInst) },
+			want:    nwInst,
+			subType: &ndk.NotificationRegisterRequest_NwInst{},
+		},
+		"lldp": {
+			receive: (*Agent).ReceiveLldpNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_LldpNeighbor{LldpNeighbor: lldp}},
+			recv:    func(t *testing.T, a *Agent) proto.Message { return recvNotification(t, a.Notifications.Lldp) },
+			want:    lldp,
+			subType: &ndk.NotificationRegisterRequest_LldpNeighbor{},
+		},
+		"bfd": {
+			receive: (*Agent).ReceiveBfdNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_BfdSession{BfdSession: bfd}},
+			recv:    func(t *testing.T, a *Agent) proto.Message { return recvNotification(t, a.Notifications.Bfd) },
+			want:    bfd,
+			subType: &ndk.NotificationRegisterRequest_BfdSession{},
+		},
+		"appid": {
+			receive: (*Agent).ReceiveAppIdNotifications,
+			notif:   &ndk.Notification{SubscriptionTypes: &ndk.Notification_Appid{Appid: appId}},
+			recv:    func(t *testing.T, a *Agent) proto.Message { return recvNotification(t, a.Notifications.AppId) },
+			want:    appId,
+			subType: &ndk.NotificationRegisterRequest_Appid{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			// notifications of another type are skipped
+			other := &ndk.Notification{SubscriptionTypes: &ndk.Notification_Config{Config: &ndk.ConfigNotification{}}}
+			mgr := withFakeStream(a, other, tc.notif)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				tc.receive(a, ctx)
+				close(done)
+			}()
+
+			if got := tc.recv(t, a); !proto.Equal(got, tc.want) {
+				t.Errorf("received %v, want %v", got, tc.want)
+			}
+
+			reqs := mgr.registerRequests()
+			got := reqs[len(reqs)-1]
+			if got.GetOp() != ndk.NotificationRegisterRequest_AddSubscription {
+				t.Errorf("register op = %v, want %v", got.GetOp(), ndk.NotificationRegisterRequest_AddSubscription)
+			}
+			if reflect.TypeOf(got.GetSubscriptionTypes()) != reflect.TypeOf(tc.subType) {
+				t.Errorf("subscription type = %T, want %T", got.GetSubscriptionTypes(), tc.subType)
+			}
+
+			cancel()
+			if n := tc.recv(t, a); n != nil {
+				t.Errorf("received %v after cancel, want closed chan", n)
+			}
+			<-done
+		})
+	}
+}
+
+// steppingClock is a fakeClock that advances by step on every Now call.
+type steppingClock struct {
+	*fakeClock
+	step time.Duration
+}
+
+func (c *steppingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func TestLastNotification(t *testing.T) {
+	intf := &ndk.Notification{
+		SubscriptionTypes: &ndk.Notification_Intf{
+			Intf: &ndk.InterfaceNotification{Key: &ndk.InterfaceKey{IfName: "ethernet-1/1"}},
+		},
+	}
+
+	tests := map[string]struct {
+		opts      []Option
+		notifType NotificationType
+		ns        []*ndk.Notification
+		receive   func(a *Agent, ctx context.Context)
+		recv      func(a *Agent)
+	}{
+		"Interface": {
+			notifType: NotificationTypeInterface,
+			ns:        []*ndk.Notification{intf, {}, intf},
+			receive:   (*Agent).ReceiveInterfaceNotifications,
+			recv:      func(a *Agent) { <-a.Notifications.Interface },
+		},
+		"Config": {
+			opts:      []Option{WithStreamConfig()},
+			notifType: NotificationTypeConfig,
+			ns: []*ndk.Notification{
+				configNotification(ndk.SdkMgrOperation_Create, ".greeter", ".greeter"),
+				{},
+				commitEndNotification(1),
+			},
+			receive: (*Agent).receiveConfigNotifications,
+			recv:    func(a *Agent) { <-a.Notifications.Config },
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tc.opts...)
+			clk := &steppingClock{fakeClock: newFakeClock(), step: time.Minute}
+			start := clk.fakeClock.Now()
+			a.clock = clk
+			withFakeStream(a, tc.ns...)
+
+			if got := a.LastNotification(tc.notifType); !got.IsZero() {
+				t.Errorf("LastNotification(%s) = %s before stream start, want zero time", tc.notifType, got)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go tc.receive(a, ctx)
+
+			// the first and last notification are delivered,
+			// the last is only delivered after all were received
+			tc.recv(a)
+			tc.recv(a)
+
+			// every received notification, including the empty one, advances the clock
+			want := start.Add(time.Duration(len(tc.ns)) * time.Minute)
+			if got := a.LastNotification(tc.notifType); !got.Equal(want) {
+				t.Errorf("LastNotification(%s) = %s, want %s", tc.notifType, got, want)
+			}
+			if got := a.LastNotification(NotificationTypeRoute); !got.IsZero() {
+				t.Errorf("LastNotification(Route) = %s, want zero time", got)
+			}
+		})
+	}
+}
@@ -3,9 +3,16 @@ package bond
 import (
 	"context"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"github.com/openconfig/gnmic/pkg/api/target"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 )
 
 var (
@@ -20,8 +27,11 @@ var (
 type Option func(*Agent) error
 
 // WithLogger sets the logger for the Agent.
+// The Agent adds fields `agent` with the agent name
+// and `app_id` with the app id to all its log messages.
 func WithLogger(logger *zerolog.Logger) Option {
 	return func(a *Agent) error {
+		a.baseLogger = logger
 		a.logger = logger
 
 		return nil
@@ -45,6 +55,9 @@ func WithContext(ctx context.Context, cancel context.CancelFunc) Option {
 }
 
 // WithAppRootPath sets the root XPATH path for the application configuration.
+// The root path cannot be derived from the NDK agent registration,
+// the registration response only carries the status and the app id,
+// so apps fetching their config or state by root path must set it.
 func WithAppRootPath(path string) Option {
 	return func(a *Agent) error {
 		a.appRootPath = path
@@ -52,11 +65,28 @@ func WithAppRootPath(path string) Option {
 	}
 }
 
+// WithStateNamespace sets an XPath prefix, e.g. /greeter/stats,
+// that is prepended to all UpdateState and DeleteState paths.
+// With namespace /greeter/stats, UpdateState("/counters", data)
+// updates state of /greeter/stats/counters
+// and an empty path targets the namespace itself.
+// Paths already within the namespace are used as is.
+// prefix must start with "/" and must not end with "/".
+func WithStateNamespace(prefix string) Option {
+	return func(a *Agent) error {
+		if !strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+			return errors.New("configuring state namespace failed. prefix must start with / and not end with /")
+		}
+		a.stateNamespace = prefix
+		return nil
+	}
+}
+
 // WithGrpcServerName sets the name of the grpc-server instance containing
 // the unix socket that is admin-enabled in SR Linux.
 // grpc-server name `insecure-mgmt` is used by default
 // if option is not set or if provided name is empty.
-// Currently, only insecure grpc-server is supported.
+// A TLS-secured grpc-server is used with WithGNMIAddress and WithGNMITLS.
 func WithGrpcServerName(name string) Option {
 	return func(a *Agent) error {
 		if name == "" {
@@ -67,6 +97,194 @@ func WithGrpcServerName(name string) Option {
 	}
 }
 
+// WithGNMITimeout sets the timeout of connecting the gNMI target
+// to the grpc-server and of every gNMI Get and Set request of the Agent,
+// e.g. the Get request fetching the full app config.
+// Subscriptions started with SubscribeWithGNMI are not limited.
+// A slow system under heavy commit load may need a longer timeout
+// to get a large config.
+// The default timeout is 10 seconds.
+//
+// Example: WithGNMITimeout(30 * time.Second)
+func WithGNMITimeout(timeout time.Duration) Option {
+	return func(a *Agent) error {
+		if timeout <= 0 {
+			return errors.New("configuring gNMI timeout failed. timeout must be positive")
+		}
+		a.gnmiTimeout = timeout
+		return nil
+	}
+}
+
+// WithGNMICredentials sets the username and password
+// the Agent authenticates gNMI requests with.
+// By default, the SR Linux default admin credentials are used.
+func WithGNMICredentials(username, password string) Option {
+	return func(a *Agent) error {
+		if username == "" {
+			return errors.New("configuring gNMI credentials failed. username cannot be empty")
+		}
+		a.gnmiUsername = username
+		a.gnmiPassword = password
+		return nil
+	}
+}
+
+// WithGNMIAddress sets the address the gNMI target connects to,
+// e.g. the network listener of a TLS-secured grpc-server set with WithGNMITLS.
+// By default, the unix socket of the grpc-server
+// set with WithGrpcServerName is used.
+// WithGrpcServerName and WithGrpcServerDiscovery do not apply
+// if the address is set.
+//
+// Example: WithGNMIAddress("127.0.0.1:57400")
+func WithGNMIAddress(address string) Option {
+	return func(a *Agent) error {
+		if address == "" {
+			return errors.New("configuring gNMI address failed. address cannot be empty")
+		}
+		a.gnmiAddress = address
+		return nil
+	}
+}
+
+// WithGNMITLS connects the gNMI target to a TLS-secured grpc-server.
+// caFile is the CA certificate file used to verify the grpc-server certificate,
+// certFile and keyFile are the client certificate and key files
+// for mutual TLS. Empty file names are not used, certFile and keyFile
+// must be set together.
+// If skipVerify is true, the grpc-server certificate is not verified.
+// SR Linux serves TLS on the network listener of the grpc-server,
+// its address is set with WithGNMIAddress.
+// Credentials are set with WithGNMICredentials.
+// By default, the insecure grpc-server is used without TLS.
+// An error is returned if a file does not exist.
+//
+// Example: WithGNMITLS("/etc/opt/srlinux/ca.pem", "", "", false)
+func WithGNMITLS(caFile, certFile, keyFile string, skipVerify bool) Option {
+	return func(a *Agent) error {
+		if (certFile == "") != (keyFile == "") {
+			return errors.New("configuring gNMI TLS failed. certificate and key files must be set together")
+		}
+		for _, f := range []struct{ name, path string }{
+			{"CA", caFile},
+			{"certificate", certFile},
+			{"key", keyFile},
+		} {
+			if f.path == "" {
+				continue
+			}
+			if _, err := os.Stat(f.path); err != nil {
+				return fmt.Errorf("configuring gNMI TLS failed. %s file: %w", f.name, err)
+			}
+		}
+		a.gnmiTLS = &gnmiTLSConfig{
+			caFile:     caFile,
+			certFile:   certFile,
+			keyFile:    keyFile,
+			skipVerify: skipVerify,
+		}
+		return nil
+	}
+}
+
+// WithGNMITarget sets the gNMI target used for gNMI operations,
+// e.g. GetWithGNMI, SetWithGNMI and retrieving the app config.
+// By default, Start creates a target connected to the grpc-server unix socket.
+// The provided target is used as is, it must have a gNMI client
+// and options WithGrpcServerName, WithGrpcServerDiscovery and
+// WithGNMICredentials do not apply to it.
+// Tests can use it to exercise gNMI operations with a fake gNMI client.
+//
+// Example: WithGNMITarget(&target.Target{Config: &types.TargetConfig{}, Client: client})
+func WithGNMITarget(t *target.Target) Option {
+	return func(a *Agent) error {
+		if t == nil {
+			return errors.New("configuring gNMI target failed. target cannot be nil")
+		}
+		a.GnmiTarget = t
+		a.customGNMITarget = true
+		return nil
+	}
+}
+
+// WithGNMIConcurrency limits the number of concurrent gNMI operations
+// (e.g. GetWithGNMI, SetWithGNMI) to n.
+// Further operations block until a running operation completes,
+// which prevents many parallel calls from overwhelming the grpc-server.
+// By default, gNMI operations are not limited.
+func WithGNMIConcurrency(n int) Option {
+	return func(a *Agent) error {
+		if n <= 0 {
+			return errors.New("configuring gNMI concurrency failed. limit must be positive")
+		}
+		a.gnmiSem = make(chan struct{}, n)
+		return nil
+	}
+}
+
+// WithReadOnlyGNMI prevents the Agent from changing SR Linux config with gNMI.
+// SetWithGNMI returns ErrReadOnlyGNMI without sending the request,
+// which protects monitoring-only apps from accidental config writes.
+// gNMI Get requests are not affected.
+func WithReadOnlyGNMI() Option {
+	return func(a *Agent) error {
+		a.readOnlyGNMI = true
+		return nil
+	}
+}
+
+// WithGrpcServerDiscovery enables discovery of the grpc-server instance name.
+// At startup, the Agent retrieves grpc-server instances from SR Linux config
+// with gNMI and uses the first insecure grpc-server with an admin-enabled unix socket.
+// Discovery is done using the grpc-server set with WithGrpcServerName
+// or the default `insecure-mgmt` grpc-server, which is kept if discovery fails.
+func WithGrpcServerDiscovery() Option {
+	return func(a *Agent) error {
+		a.discoverGrpcServer = true
+		return nil
+	}
+}
+
+// WithForceReregister enables replacing a stale registration on startup.
+// If a previous instance of the app exited without unregistering,
+// registering with the same name can fail.
+// NDK mgr does not report why a registration failed, so with this option
+// the Agent unregisters and registers once more whenever NDK mgr
+// rejects the registration.
+// Errors reaching NDK mgr are not retried.
+func WithForceReregister() Option {
+	return func(a *Agent) error {
+		a.forceReregister = true
+		return nil
+	}
+}
+
+// WithAgentMetadataKey sets the gRPC metadata key
+// used to send the agent name to the NDK server.
+// Key `agent_name` is used by default.
+func WithAgentMetadataKey(key string) Option {
+	return func(a *Agent) error {
+		if key == "" {
+			return errors.New("setting agent metadata key failed. key cannot be empty")
+		}
+		a.metadataKey = key
+		return nil
+	}
+}
+
+// WithAppID sets the expected app id of the Agent.
+// By default, the app id is only known after the Agent registers with NDK mgr.
+// Apps that know their app id (e.g. from a previous run) can use this option
+// to filter notifications by owner, e.g. with OwnsRoute, before registration completes.
+// The app id returned by NDK mgr on registration overrides this value.
+func WithAppID(id uint32) Option {
+	return func(a *Agent) error {
+		a.AppID = id
+		return nil
+	}
+}
+
 // WithStreamConfig enables streaming of application configs for each YANG path.
 // For example: the application will stream in separate configs
 // for the root container (e.g. /greeter) and any YANG
@@ -83,6 +301,36 @@ func WithStreamConfig() Option {
 	}
 }
 
+// WithCommitDebounce enables coalescing of rapid commits.
+// By default, the app's full config is fetched with gNMI
+// for every received commit.
+// With this option, the full config is fetched and FullConfigReceived
+// is signaled once no further commit is received within window,
+// so a burst of commits triggers a single config fetch.
+// This option has no effect if configs are streamed with WithStreamConfig.
+func WithCommitDebounce(window time.Duration) Option {
+	return func(a *Agent) error {
+		if window <= 0 {
+			return errors.New("configuring commit debounce failed. window must be positive")
+		}
+		a.commitDebounce = window
+		return nil
+	}
+}
+
+// WithEmptyConfigNotification enables signaling FullConfigReceived
+// for commits with zero commit sequence, which carry no app config.
+// By default, such commits are ignored and the app is not notified.
+// With this option, the full config is fetched for these commits as well,
+// so apps are notified with FullConfig set to nil and can clear their state.
+// This option has no effect if configs are streamed with WithStreamConfig.
+func WithEmptyConfigNotification() Option {
+	return func(a *Agent) error {
+		a.emptyConfigNotif = true
+		return nil
+	}
+}
+
 // WithKeepAlive enables keepalive messages for the application configuration.
 // Every interval seconds, app will send keepalive messages
 // until ndk mgr has failed threshold times.
@@ -99,6 +347,103 @@ func WithKeepAlive(interval time.Duration, threshold int) Option {
 	}
 }
 
+// WithNDKSocket sets the address of the NDK socket the Agent connects to,
+// in the gRPC target format, e.g. unix:///tmp/ndk.sock.
+// By default, the Agent connects to the SR Linux NDK socket
+// unix:///opt/srlinux/var/run/sr_sdk_service_manager:50053.
+// Tests can use it to connect the Agent to a fake NDK server.
+func WithNDKSocket(path string) Option {
+	return func(a *Agent) error {
+		if path == "" {
+			return errors.New("configuring NDK socket failed. path cannot be empty")
+		}
+		a.ndkSocket = path
+		return nil
+	}
+}
+
+// WithGRPCConn sets the gRPC connection to NDK used by the Agent.
+// Start uses conn instead of dialing the NDK socket
+// and creates all NDK service clients with it.
+// conn is owned by the caller, it is not closed when the Agent stops.
+// Dial options, e.g. set with WithGRPCKeepalive, do not apply to conn.
+// Tests can use it to connect the Agent to an in-process NDK server.
+//
+// Example:
+// conn, _ := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+// WithGRPCConn(conn)
+func WithGRPCConn(conn *grpc.ClientConn) Option {
+	return func(a *Agent) error {
+		if conn == nil {
+			return errors.New("configuring gRPC connection failed. connection cannot be nil")
+		}
+		a.gRPCConn = conn
+		a.externalConn = true
+		return nil
+	}
+}
+
+// WithGRPCKeepalive enables gRPC keepalives on the NDK connection.
+// Long-lived notification streams can be silently dropped
+// by intermediaries without keepalives.
+// A keepalive ping is sent after time of inactivity and the connection
+// is closed if the ping is not acknowledged within timeout.
+// gRPC enforces a minimum time of 10 seconds.
+func WithGRPCKeepalive(time, timeout time.Duration) Option {
+	return func(a *Agent) error {
+		if time <= 0 || timeout <= 0 {
+			return errors.New("configuring grpc keepalive failed. time and timeout must be positive")
+		}
+		a.grpcKeepalive = &keepalive.ClientParameters{
+			Time:                time,
+			Timeout:             timeout,
+			PermitWithoutStream: true,
+		}
+		return nil
+	}
+}
+
+// WithMaxRecvMsgSize sets the maximum size in bytes of gRPC messages
+// received from NDK, e.g. large notification stream responses.
+// By default, gRPC limits received messages to 4MB.
+func WithMaxRecvMsgSize(bytes int) Option {
+	return func(a *Agent) error {
+		if bytes <= 0 {
+			return errors.New("configuring max receive message size failed. size must be positive")
+		}
+		a.maxRecvMsgSize = bytes
+		return nil
+	}
+}
+
+// WithMaxSendMsgSize sets the maximum size in bytes of gRPC messages
+// sent to NDK, e.g. large RouteAdd batches.
+// By default, gRPC does not limit the size of sent messages,
+// but NDK limits the size of the messages it receives.
+func WithMaxSendMsgSize(bytes int) Option {
+	return func(a *Agent) error {
+		if bytes <= 0 {
+			return errors.New("configuring max send message size failed. size must be positive")
+		}
+		a.maxSendMsgSize = bytes
+		return nil
+	}
+}
+
+// WithShutdownTimeout sets the maximum time the Agent waits
+// on shutdown for in-flight RPCs, e.g. RouteAdd or UpdateState,
+// before the connection to NDK is closed.
+// The default timeout is 5 seconds.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(a *Agent) error {
+		if timeout <= 0 {
+			return errors.New("configuring shutdown timeout failed. timeout must be positive")
+		}
+		a.shutdownTimeout = timeout
+		return nil
+	}
+}
+
 // WithConfigAcknowledge enables SR Linux to wait for explicit
 // acknowledgement from app after delivering configuration.
 // After config notifications are streamed in, app will need
@@ -155,6 +500,9 @@ func WithAutoUpdateConfigState() Option {
 // - Note: Config, Network instance, and App id notifications will
 // always be cached in NDK server, regardless of WithCaching set.
 // All other notifications will not be cached by default.
+// - NDK does not mark the end of the cached notifications replayed
+// when a stream starts, apart from .commit.end for Config notifications,
+// so replayed entries cannot be told apart from live updates.
 func WithCaching() Option {
 	return func(a *Agent) error {
 		a.cacheNotifications = true
@@ -162,6 +510,154 @@ func WithCaching() Option {
 	}
 }
 
+// WithVerboseNotificationLogging enables logging of the full contents
+// of every received notification at debug level.
+// Notification dumps are very noisy on scaled systems
+// and are not logged by default.
+func WithVerboseNotificationLogging() Option {
+	return func(a *Agent) error {
+		a.verboseNotifLogging = true
+		return nil
+	}
+}
+
+// WithCompactNotificationLogging enables logging of the full contents
+// of every received notification at debug level, like WithVerboseNotificationLogging,
+// with each notification dump marshaled on a single line
+// instead of the default indented multi-line format.
+// Compact dumps reduce log volume and keep a dump in a single log line.
+func WithCompactNotificationLogging() Option {
+	return func(a *Agent) error {
+		a.verboseNotifLogging = true
+		a.compactNotifLogging = true
+		return nil
+	}
+}
+
+// WithTypedNotifications enables delivery of typed notifications.
+// Receive<type>Notifications methods of notification types
+// with a typed representation (e.g. BfdSessionNotification)
+// send notifications to the typed channel (e.g. BfdSession)
+// in addition to the raw NDK notification channel (e.g. Bfd).
+// Every notification is sent to the raw channel first,
+// so apps must read both channels.
+// Typed notifications carry the raw NDK notification in field Raw.
+func WithTypedNotifications() Option {
+	return func(a *Agent) error {
+		a.typedNotifications = true
+		return nil
+	}
+}
+
+// WithRouteNotificationBuffer sets the buffer size of chan Route and RouteEvent
+// and the policy applied when the buffer is full.
+// Route notifications are the highest-volume notifications on a full-table router,
+// this option allows buffering and dropping them independently of other notifications.
+// By default, chan Route is unbuffered and route notifications
+// are not dropped, i.e. policy OverflowBlock.
+// With OverflowDropNewest or OverflowDropOldest, dropped notifications
+// are reported to the NotificationDropped metrics hook.
+// The drop policies require a buffer, size must be positive.
+func WithRouteNotificationBuffer(size int, policy OverflowPolicy) Option {
+	return func(a *Agent) error {
+		if size < 0 {
+			return errors.New("configuring route notification buffer failed. size cannot be negative")
+		}
+		if policy < OverflowBlock || policy > OverflowDropOldest {
+			return errors.New("configuring route notification buffer failed. unknown overflow policy")
+		}
+		if size == 0 && policy != OverflowBlock {
+			return errors.New("configuring route notification buffer failed. drop policies require a positive size")
+		}
+		a.Notifications.Route = make(chan *ndk.IpRouteNotification, size)
+		a.Notifications.RouteEvent = make(chan *RouteNotification, size)
+		a.routeOverflow = policy
+		return nil
+	}
+}
+
+// WithRouteBatchSize sets the maximum number of routes
+// sent in a single RouteAddOrUpdate request by RouteAdd and RouteUpdate.
+// Larger route batches are split into chunks of n routes
+// sent with sequential requests, which keeps requests
+// below the gRPC maximum message size.
+// By default, routes are sent in chunks of 1000 routes.
+func WithRouteBatchSize(n int) Option {
+	return func(a *Agent) error {
+		if n <= 0 {
+			return errors.New("configuring route batch size failed. size must be positive")
+		}
+		a.routeBatchSize = n
+		return nil
+	}
+}
+
+// WithNotificationReplay keeps the size most recent notifications
+// of every notification stream in memory,
+// so that listeners started with e.g. ReplayInterfaceNotifications
+// after notifications have started flowing receive the notifications they missed.
+// By default, notifications are not kept for replay.
+func WithNotificationReplay(size int) Option {
+	return func(a *Agent) error {
+		if size <= 0 {
+			return errors.New("configuring notification replay failed. size must be positive")
+		}
+		a.replaySize = size
+		return nil
+	}
+}
+
+// WithStrictNetworkInstanceCheck rejects routes and nexthop groups
+// targeting a network instance that does not exist.
+// While ReceiveNetworkInstanceNotifications runs, RouteAdd and NextHopGroupAdd
+// check that the targeted network instance is in the network instance cache,
+// which catches typos in network instance names early.
+// Network instances are not checked until the cache
+// received its first network instance notification.
+// By default, unknown network instances are only logged as a warning,
+// with this option an error wrapping ErrUnknownNetworkInstance is returned.
+func WithStrictNetworkInstanceCheck() Option {
+	return func(a *Agent) error {
+		a.strictNetInstCheck = true
+		return nil
+	}
+}
+
+// WithUnresolvedRouteHandler sets a handler called by ReceiveRouteNotifications
+// for every route notification of a route that cannot be resolved,
+// i.e. NDK reports the route without any active nexthop.
+// Apps can use it to alert on route resolution failures.
+// The handler is called from the route notification goroutine
+// and should not block.
+func WithUnresolvedRouteHandler(h func(*RouteNotification)) Option {
+	return func(a *Agent) error {
+		if h == nil {
+			return errors.New("setting unresolved route handler failed. handler cannot be nil")
+		}
+		a.unresolvedRouteHandler = h
+		return nil
+	}
+}
+
+// WithMetricsHook sets callbacks the Agent calls to report metrics,
+// e.g. time stream goroutines are blocked sending notifications
+// to slow consumers.
+func WithMetricsHook(h MetricsHook) Option {
+	return func(a *Agent) error {
+		a.metrics = h
+		return nil
+	}
+}
+
+// withClock sets the clock used for keepalives, retries and backoff.
+// It is used by tests to control time.
+func withClock(c clock) Option {
+	return func(a *Agent) error {
+		a.clock = c
+		return nil
+	}
+}
+
 // validateOptions validates the Agent's final configuration.
 // A slice of errors is returned.
 func (a *Agent) validateOptions() []error {
@@ -0,0 +1,129 @@
+package bond
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWithAgentMetadataKey(t *testing.T) {
+	tests := map[string]struct {
+		opts    []Option
+		wantKey string
+	}{
+		"Default key": {
+			wantKey: "agent_name",
+		},
+		"Custom key": {
+			opts:    []Option{WithAgentMetadataKey("app_name")},
+			wantKey: "app_name",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tt.opts...)
+
+			md, ok := metadata.FromOutgoingContext(a.ctx)
+			if !ok {
+				t.Fatal("agent context has no outgoing metadata")
+			}
+			if got := md.Get(tt.wantKey); len(got) != 1 || got[0] != "test" {
+				t.Errorf("metadata[%q] = %v, want [test]", tt.wantKey, got)
+			}
+		})
+	}
+}
+
+func TestWithAgentMetadataKeyEmpty(t *testing.T) {
+	if err := WithAgentMetadataKey("")(&Agent{}); err == nil {
+		t.Error("WithAgentMetadataKey(\"\") returned nil error")
+	}
+}
+
+func TestWithGRPCKeepalive(t *testing.T) {
+	a := newTestAgent(t)
+	defaultOpts := len(a.dialOptions())
+	if a.grpcKeepalive != nil {
+		t.Errorf("grpc keepalive set without WithGRPCKeepalive option")
+	}
+
+	a = newTestAgent(t, WithGRPCKeepalive(30*time.Second, 5*time.Second))
+	if got := len(a.dialOptions()); got != defaultOpts+1 {
+		t.Errorf("dialOptions() has %d options, want %d", got, defaultOpts+1)
+	}
+	want := keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 5 * time.Second, PermitWithoutStream: true}
+	if a.grpcKeepalive == nil || *a.grpcKeepalive != want {
+		t.Errorf("grpc keepalive params = %+v, want %+v", a.grpcKeepalive, want)
+	}
+}
+
+func TestWithGRPCKeepaliveInvalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"Zero time":        WithGRPCKeepalive(0, 5*time.Second),
+		"Negative timeout": WithGRPCKeepalive(30*time.Second, -time.Second),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, errs := NewAgent("test", opt); len(errs) == 0 {
+				t.Errorf("NewAgent() returned no errors")
+			}
+		})
+	}
+}
+
+func TestWithMaxMsgSize(t *testing.T) {
+	a := newTestAgent(t)
+	defaultOpts := len(a.dialOptions())
+	if len(a.callOptions()) != 0 {
+		t.Errorf("call options set without WithMaxRecvMsgSize or WithMaxSendMsgSize options")
+	}
+
+	a = newTestAgent(t, WithMaxRecvMsgSize(16<<20), WithMaxSendMsgSize(8<<20))
+	if got := len(a.dialOptions()); got != defaultOpts+1 {
+		t.Errorf("dialOptions() has %d options, want %d", got, defaultOpts+1)
+	}
+	var recv, send int
+	for _, o := range a.callOptions() {
+		switch o := o.(type) {
+		case grpc.MaxRecvMsgSizeCallOption:
+			recv = o.MaxRecvMsgSize
+		case grpc.MaxSendMsgSizeCallOption:
+			send = o.MaxSendMsgSize
+		}
+	}
+	if recv != 16<<20 || send != 8<<20 {
+		t.Errorf("max message sizes = recv %d, send %d, want recv %d, send %d", recv, send, 16<<20, 8<<20)
+	}
+}
+
+func TestWithMaxMsgSizeInvalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"Zero receive size":     WithMaxRecvMsgSize(0),
+		"Negative receive size": WithMaxRecvMsgSize(-1),
+		"Zero send size":        WithMaxSendMsgSize(0),
+		"Negative send size":    WithMaxSendMsgSize(-1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, errs := NewAgent("test", opt); len(errs) == 0 {
+				t.Errorf("NewAgent() returned no errors")
+			}
+		})
+	}
+}
+
+func TestWithStateNamespaceInvalid(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"Empty":          WithStateNamespace(""),
+		"Relative":       WithStateNamespace("greeter/stats"),
+		"Trailing slash": WithStateNamespace("/greeter/stats/"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, errs := NewAgent("test", opt); len(errs) == 0 {
+				t.Errorf("NewAgent() returned no errors")
+			}
+		})
+	}
+}
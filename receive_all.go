@@ -0,0 +1,156 @@
+package bond
+
+import (
+	"context"
+	"sync"
+)
+
+// NotificationEvent is a notification received by ReceiveAll.
+type NotificationEvent struct {
+	// Type is the notification stream type,
+	// any NotificationType apart from NotificationTypeConfig.
+	Type NotificationType
+	// Notification is the received notification.
+	// Its type is the element type of the Notifications chan of the stream,
+	// e.g. *ndk.InterfaceNotification for Interface notifications.
+	// With WithTypedNotifications, Route, Lldp Neighbor and Bfd Session
+	// notifications are *RouteNotification, *LldpNeighborNotification
+	// and *BfdSessionNotification, their raw NDK notifications are not delivered.
+	Notification any
+}
+
+// ReceiveAll starts receiving notifications of all notification types,
+// apart from Config notifications, and delivers them on a single channel.
+// It is a shortcut for generic monitoring apps that would otherwise call
+// every Receive<type>Notifications method and read every Notifications chan.
+// Notifications are read from the Notifications chans,
+// which must not be read by the app while ReceiveAll is used.
+// Calling stop, or cancelling ctx, stops receiving notifications
+// and closes the returned channel.
+// The Notifications chans are closed for good once receiving stops,
+// so ReceiveAll can only be called once and not together with
+// Receive<type>Notifications methods. Later calls log an error
+// and return a closed channel, notification types already received
+// with a Receive<type>Notifications method are not delivered.
+//
+// Example:
+//
+//	events, stop := a.ReceiveAll(ctx)
+//	defer stop()
+//	for ev := range events {
+//		log.Printf("%s notification: %v", ev.Type, ev.Notification)
+//	}
+func (a *Agent) ReceiveAll(ctx context.Context) (<-chan NotificationEvent, func()) {
+	events := make(chan NotificationEvent)
+	if !a.receivingAll.CompareAndSwap(false, true) {
+		a.logger.Error().Msg("ReceiveAll was already called, Notifications chans can only be read once")
+		close(events)
+		return events, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	n := a.Notifications
+	// receive starts receiving notifications of notifType with start
+	// and forwards them with fwd, unless they are already received.
+	receive := func(notifType NotificationType, start func(ctx context.Context), fwd func()) {
+		if _, ok := a.receiving.Load(notifType); ok {
+			a.logger.Error().
+				Msgf("%s notifications are already received, not delivering them with ReceiveAll", notifType)
+			return
+		}
+		go start(ctx)
+		fwd()
+	}
+
+	receive(NotificationTypeInterface, a.ReceiveInterfaceNotifications, func() {
+		forward(ctx, &wg, events, NotificationTypeInterface, n.Interface)
+	})
+	receive(NotificationTypeRoute, func(ctx context.Context) { a.ReceiveRouteNotifications(ctx) }, func() {
+		if a.typedNotifications {
+			forward(ctx, &wg, events, NotificationTypeRoute, n.RouteEvent)
+			drain(ctx, &wg, n.Route)
+			return
+		}
+		forward(ctx, &wg, events, NotificationTypeRoute, n.Route)
+	})
+	receive(NotificationTypeNextHopGroup, a.ReceiveNextHopGroupNotifications, func() {
+		forward(ctx, &wg, events, NotificationTypeNextHopGroup, n.NextHopGroup)
+	})
+	receive(NotificationTypeNetworkInstance, a.ReceiveNetworkInstanceNotifications, func() {
+		forward(ctx, &wg, events, NotificationTypeNetworkInstance, n.NwInst)
+	})
+	receive(NotificationTypeLldpNeighbor, a.ReceiveLldpNotifications, func() {
+		if a.typedNotifications {
+			forward(ctx, &wg, events, NotificationTypeLldpNeighbor, n.LldpNeighbor)
+			drain(ctx, &wg, n.Lldp)
+			return
+		}
+		forward(ctx, &wg, events, NotificationTypeLldpNeighbor, n.Lldp)
+	})
+	receive(NotificationTypeBfdSession, a.ReceiveBfdNotifications, func() {
+		if a.typedNotifications {
+			forward(ctx, &wg, events, NotificationTypeBfdSession, n.BfdSession)
+			drain(ctx, &wg, n.Bfd)
+			return
+		}
+		forward(ctx, &wg, events, NotificationTypeBfdSession, n.Bfd)
+	})
+	receive(NotificationTypeAppId, a.ReceiveAppIdNotifications, func() {
+		forward(ctx, &wg, events, NotificationTypeAppId, n.AppId)
+	})
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, cancel
+}
+
+// forward starts a goroutine sending notifications received on ch
+// as events of notifType to events until ctx is done or ch is closed.
+func forward[T any](ctx context.Context, wg *sync.WaitGroup,
+	events chan<- NotificationEvent, notifType NotificationType, ch <-chan T,
+) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n, ok := <-ch:
+				// Receive methods close their chans when their stream ends.
+				if !ok || ctx.Err() != nil {
+					return
+				}
+				select {
+				case events <- NotificationEvent{Type: notifType, Notification: n}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+}
+
+// drain starts a goroutine discarding notifications received on ch
+// until ctx is done or ch is closed.
+func drain[T any](ctx context.Context, wg *sync.WaitGroup, ch <-chan T) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+}
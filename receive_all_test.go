@@ -0,0 +1,147 @@
+package bond
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func TestReceiveAll(t *testing.T) {
+	notifications := []*ndk.Notification{
+		interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500),
+		{SubscriptionTypes: &ndk.Notification_Route{Route: unresolvedRoute("10.0.0.0/24")}},
+		{SubscriptionTypes: &ndk.Notification_Nhg{Nhg: &ndk.NextHopGroupNotification{Key: 1}}},
+		networkInstanceNotification(ndk.SdkMgrOperation_Create, "default"),
+		{SubscriptionTypes: &ndk.Notification_LldpNeighbor{LldpNeighbor: lldpNeighbor()}},
+		{SubscriptionTypes: &ndk.Notification_BfdSession{BfdSession: p2pBfdSession(ndk.BfdmgrSessionStatus_UP)}},
+		{SubscriptionTypes: &ndk.Notification_Appid{Appid: &ndk.AppIdentNotification{Key: &ndk.AppIdentKey{Id: 7}}}},
+	}
+
+	tests := map[string]struct {
+		opts []Option
+		want map[NotificationType]string
+	}{
+		"Raw notifications": {
+			want: map[NotificationType]string{
+				NotificationTypeInterface:       "*ndk.InterfaceNotification",
+				NotificationTypeRoute:           "*ndk.IpRouteNotification",
+				NotificationTypeNextHopGroup:    "*ndk.NextHopGroupNotification",
+				NotificationTypeNetworkInstance: "*ndk.NetworkInstanceNotification",
+				NotificationTypeLldpNeighbor:    "*ndk.LldpNeighborNotification",
+				NotificationTypeBfdSession:      "*ndk.BfdSessionNotification",
+				NotificationTypeAppId:           "*ndk.AppIdentNotification",
+			},
+		},
+		"Typed notifications": {
+			opts: []Option{WithTypedNotifications()},
+			want: map[NotificationType]string{
+				NotificationTypeInterface:       "*ndk.InterfaceNotification",
+				NotificationTypeRoute:           "*bond.RouteNotification",
+				NotificationTypeNextHopGroup:    "*ndk.NextHopGroupNotification",
+				NotificationTypeNetworkInstance: "*ndk.NetworkInstanceNotification",
+				NotificationTypeLldpNeighbor:    "*bond.LldpNeighborNotification",
+				NotificationTypeBfdSession:      "*bond.BfdSessionNotification",
+				NotificationTypeAppId:           "*ndk.AppIdentNotification",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tt.opts...)
+			withFakeStream(a, notifications...)
+
+			events, stop := a.ReceiveAll(context.Background())
+			defer stop()
+
+			got := map[NotificationType]string{}
+			timeout := time.After(5 * time.Second)
+			for len(got) < len(tt.want) {
+				select {
+				case ev := <-events:
+					if _, ok := got[ev.Type]; ok {
+						t.Errorf("received %s notification more than once", ev.Type)
+					}
+					got[ev.Type] = fmt.Sprintf("%T", ev.Notification)
+				case <-timeout:
+					t.Fatalf("received notifications %v, want %v", got, tt.want)
+				}
+			}
+			for typ, want := range tt.want {
+				if got[typ] != want {
+					t.Errorf("%s notification type = %s, want %s", typ, got[typ], want)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiveAllStop(t *testing.T) {
+	a := newTestAgent(t)
+	withFakeStream(a)
+
+	events, stop := a.ReceiveAll(context.Background())
+	stop()
+
+	select {
+	case ev, ok := <-events:
+		if ok {
+			t.Errorf("received event after stop: %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("events chan not closed after stop")
+	}
+}
+
+func TestReceiveAllTwice(t *testing.T) {
+	a := newTestAgent(t)
+	withFakeStream(a)
+
+	_, stop := a.ReceiveAll(context.Background())
+	stop()
+
+	events, stop := a.ReceiveAll(context.Background())
+	defer stop()
+	select {
+	case ev, ok := <-events:
+		if ok {
+			t.Errorf("second ReceiveAll received event %+v, want closed channel", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second ReceiveAll channel not closed")
+	}
+}
+
+func TestReceiveAllAfterReceive(t *testing.T) {
+	a := newTestAgent(t)
+	withFakeStream(a,
+		interfaceNotification(ndk.SdkMgrOperation_Create, "ethernet-1/1", 1500),
+		networkInstanceNotification(ndk.SdkMgrOperation_Create, "default"),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go a.ReceiveInterfaceNotifications(ctx)
+	select {
+	case <-a.Notifications.Interface:
+	case <-time.After(5 * time.Second):
+		t.Fatal("interface notification not received")
+	}
+
+	events, stop := a.ReceiveAll(ctx)
+	defer stop()
+	select {
+	case ev := <-events:
+		if ev.Type != NotificationTypeNetworkInstance {
+			t.Errorf("received %s notification, want Network instance", ev.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("network instance notification not received")
+	}
+
+	// a second interface receiver returns without closing the chans again
+	a.ReceiveInterfaceNotifications(ctx)
+}
@@ -0,0 +1,79 @@
+package bond
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// registry is a concurrency-safe store of items keyed by string.
+// It is used to cache NDK objects received or programmed by the Agent.
+// Internal maps are never exposed, callers outside the registry
+// get copies of stored items with snapshot.
+type registry[T any] struct {
+	mu    sync.RWMutex
+	items map[string]T
+}
+
+// newRegistry creates an empty registry.
+func newRegistry[T any]() *registry[T] {
+	return &registry[T]{items: make(map[string]T)}
+}
+
+// set stores item v under key.
+func (r *registry[T]) set(key string, v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[key] = v
+}
+
+// get returns the item stored under key and whether it was found.
+func (r *registry[T]) get(key string) (T, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.items[key]
+	return v, ok
+}
+
+// delete removes the item stored under key.
+func (r *registry[T]) delete(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.items, key)
+}
+
+// deleteFunc removes all items for which del returns true.
+func (r *registry[T]) deleteFunc(del func(T) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range r.items {
+		if del(v) {
+			delete(r.items, k)
+		}
+	}
+}
+
+// replace replaces all stored items with items.
+func (r *registry[T]) replace(items map[string]T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = items
+}
+
+// snapshot returns a copy of all stored items.
+// Each item is copied with clone, so that the returned items
+// can be used and modified while the registry is updated.
+func (r *registry[T]) snapshot(clone func(T) T) map[string]T {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	items := make(map[string]T, len(r.items))
+	for k, v := range r.items {
+		items[k] = clone(v)
+	}
+	return items
+}
+
+// cloneProto returns a deep copy of protobuf message m.
+func cloneProto[T proto.Message](m T) T {
+	return proto.Clone(m).(T)
+}
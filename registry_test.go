@@ -0,0 +1,87 @@
+package bond
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func TestRegistrySnapshot(t *testing.T) {
+	r := newRegistry[*ndk.NextHopGroupInfo]()
+	r.set("default/nhg_sdk", NewNextHopGroup(WithNetworkInstanceName("default"), WithName("nhg_sdk")))
+
+	snap := r.snapshot(cloneProto[*ndk.NextHopGroupInfo])
+	snap["default/nhg_sdk"].Key.Name = "changed_sdk"
+	delete(snap, "default/nhg_sdk")
+
+	v, ok := r.get("default/nhg_sdk")
+	if !ok {
+		t.Fatal("modifying snapshot removed item from registry")
+	}
+	if v.GetKey().GetName() != "nhg_sdk" {
+		t.Errorf("modifying snapshot changed stored item name to %s", v.GetKey().GetName())
+	}
+}
+
+// TestAppIdentSnapshotConcurrent reads snapshots while the notification goroutine
+// updates the AppId cache. Run with -race to detect unsafe map access.
+func TestAppIdentSnapshotConcurrent(t *testing.T) {
+	a := newTestAgent(t)
+
+	var ns []*ndk.Notification
+	for i := 0; i < 100; i++ {
+		ns = append(ns, appIdentNotification(ndk.SdkMgrOperation_Create, uint32(i), fmt.Sprintf("app%d", i)))
+	}
+	withFakeStream(a, ns...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveAppIdNotifications(ctx)
+
+	for range ns {
+		for _, n := range a.AppIdentSnapshot() {
+			_ = n.GetData().GetName()
+		}
+		<-a.Notifications.AppId
+	}
+
+	if got := len(a.AppIdentSnapshot()); got != len(ns) {
+		t.Errorf("AppIdentSnapshot() has %d entries, want %d", got, len(ns))
+	}
+}
+
+// TestNextHopGroupSnapshotConcurrent reads snapshots while nexthop groups
+// are added and deleted. Run with -race to detect unsafe map access.
+func TestNextHopGroupSnapshotConcurrent(t *testing.T) {
+	a := newTestAgent(t)
+	a.stubs = &stubs{nextHopGroupService: &fakeNhgService{}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			name := fmt.Sprintf("nhg%d_sdk", i)
+			a.NextHopGroupAdd(NewNextHopGroup(WithNetworkInstanceName("default"), WithName(name)))
+			if i%2 == 0 {
+				a.NextHopGroupDelete("default", name)
+			}
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		for _, nhg := range a.NextHopGroupSnapshot() {
+			_ = nhg.GetKey().GetName()
+		}
+	}
+
+	if got := len(a.NextHopGroupSnapshot()); got != 50 {
+		t.Errorf("NextHopGroupSnapshot() has %d entries, want 50", got)
+	}
+}
@@ -0,0 +1,181 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+// An error is returned if notifications are replayed
+// without WithNotificationReplay option set.
+var ErrReplayNotEnabled = errors.New("agent is not created with WithNotificationReplay option")
+
+// replayBuffer is a bounded ring buffer of the most recent notifications
+// of a notification type and the listeners receiving them.
+type replayBuffer[T any] struct {
+	mu sync.Mutex
+	// items holds up to cap(items) notifications,
+	// next is the index of the oldest item once items is full.
+	items []T
+	next  int
+	// listeners receive every added notification.
+	listeners map[chan T]struct{}
+}
+
+// newReplayBuffer creates an empty replay buffer keeping size notifications.
+func newReplayBuffer[T any](size int) *replayBuffer[T] {
+	return &replayBuffer[T]{
+		items:     make([]T, 0, size),
+		listeners: make(map[chan T]struct{}),
+	}
+}
+
+// add stores notification n, replacing the oldest notification
+// if the buffer is full, and sends n to all listeners.
+// Listeners without room for n miss it, dropped is called for each of them.
+func (b *replayBuffer[T]) add(n T, dropped func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.items) < cap(b.items) {
+		b.items = append(b.items, n)
+	} else {
+		b.items[b.next] = n
+		b.next = (b.next + 1) % len(b.items)
+	}
+
+	for l := range b.listeners {
+		select {
+		case l <- n:
+		default:
+			dropped()
+		}
+	}
+}
+
+// listen returns a listener channel holding the buffered notifications,
+// oldest first, which receives every notification added afterwards.
+// The listener is removed and its channel closed when ctx is done.
+func (b *replayBuffer[T]) listen(ctx context.Context) <-chan T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l := make(chan T, cap(b.items))
+	for i := range b.items {
+		l <- b.items[(b.next+i)%len(b.items)]
+	}
+	b.listeners[l] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.listeners, l)
+		close(l)
+	}()
+	return l
+}
+
+// getReplayBuffer returns the replay buffer of notifType
+// holding notifications of type T, which is created on first use.
+func getReplayBuffer[T any](a *Agent, notifType NotificationType) *replayBuffer[T] {
+	a.replayMu.Lock()
+	defer a.replayMu.Unlock()
+	if a.replays == nil {
+		a.replays = make(map[NotificationType]any)
+	}
+	b, ok := a.replays[notifType].(*replayBuffer[T])
+	if !ok {
+		b = newReplayBuffer[T](a.replaySize)
+		a.replays[notifType] = b
+	}
+	return b
+}
+
+// recordNotification adds notification n of notifType to its replay buffer
+// if replay is enabled with WithNotificationReplay.
+func recordNotification[T any](a *Agent, notifType NotificationType, n T) {
+	if a.replaySize == 0 {
+		return
+	}
+	getReplayBuffer[T](a, notifType).add(n, func() { a.notificationDropped(notifType) })
+}
+
+// replay returns a channel receiving the buffered notifications
+// of notifType, oldest first, followed by the notifications of notifType
+// sent afterwards.
+// The channel is closed when ctx is done.
+func replay[T any](ctx context.Context, a *Agent, notifType NotificationType) (<-chan T, error) {
+	if a.replaySize == 0 {
+		return nil, ErrReplayNotEnabled
+	}
+	return getReplayBuffer[T](a, notifType).listen(ctx), nil
+}
+
+// Replay<Type>Notifications return a channel receiving the buffered
+// notifications of a stream, oldest first, followed by the notifications
+// sent on the corresponding Notifications channel afterwards.
+// Typed notifications sent with WithTypedNotifications are not replayed.
+// At most the size set with WithNotificationReplay notifications are buffered,
+// notifications that do not fit in the channel of a slow listener are dropped
+// and reported to the NotificationDropped metrics hook.
+// The channel is closed when ctx is done.
+// An error is returned if Agent does not have option WithNotificationReplay set.
+
+// ReplayConfigNotifications replays the notifications sent on chan Config.
+//
+// Example: ReplayConfigNotifications(ctx)
+func (a *Agent) ReplayConfigNotifications(ctx context.Context) (<-chan *ConfigNotification, error) {
+	return replay[*ConfigNotification](ctx, a, NotificationTypeConfig)
+}
+
+// ReplayInterfaceNotifications replays the notifications sent on chan Interface.
+//
+// Example: ReplayInterfaceNotifications(ctx)
+func (a *Agent) ReplayInterfaceNotifications(ctx context.Context) (<-chan *ndk.InterfaceNotification, error) {
+	return replay[*ndk.InterfaceNotification](ctx, a, NotificationTypeInterface)
+}
+
+// ReplayRouteNotifications replays the notifications sent on chan Route.
+//
+// Example: ReplayRouteNotifications(ctx)
+func (a *Agent) ReplayRouteNotifications(ctx context.Context) (<-chan *ndk.IpRouteNotification, error) {
+	return replay[*ndk.IpRouteNotification](ctx, a, NotificationTypeRoute)
+}
+
+// ReplayNextHopGroupNotifications replays the notifications sent on chan NextHopGroup.
+//
+// Example: ReplayNextHopGroupNotifications(ctx)
+func (a *Agent) ReplayNextHopGroupNotifications(ctx context.Context) (<-chan *ndk.NextHopGroupNotification, error) {
+	return replay[*ndk.NextHopGroupNotification](ctx, a, NotificationTypeNextHopGroup)
+}
+
+// ReplayNetworkInstanceNotifications replays the notifications sent on chan NwInst.
+//
+// Example: ReplayNetworkInstanceNotifications(ctx)
+func (a *Agent) ReplayNetworkInstanceNotifications(ctx context.Context) (<-chan *ndk.NetworkInstanceNotification, error) {
+	return replay[*ndk.NetworkInstanceNotification](ctx, a, NotificationTypeNetworkInstance)
+}
+
+// ReplayLldpNotifications replays the notifications sent on chan Lldp.
+//
+// Example: ReplayLldpNotifications(ctx)
+func (a *Agent) ReplayLldpNotifications(ctx context.Context) (<-chan *ndk.LldpNeighborNotification, error) {
+	return replay[*ndk.LldpNeighborNotification](ctx, a, NotificationTypeLldpNeighbor)
+}
+
+// ReplayBfdNotifications replays the notifications sent on chan Bfd.
+//
+// Example: ReplayBfdNotifications(ctx)
+func (a *Agent) ReplayBfdNotifications(ctx context.Context) (<-chan *ndk.BfdSessionNotification, error) {
+	return replay[*ndk.BfdSessionNotification](ctx, a, NotificationTypeBfdSession)
+}
+
+// ReplayAppIdNotifications replays the notifications sent on chan AppId.
+//
+// Example: ReplayAppIdNotifications(ctx)
+func (a *Agent) ReplayAppIdNotifications(ctx context.Context) (<-chan *ndk.AppIdentNotification, error) {
+	return replay[*ndk.AppIdentNotification](ctx, a, NotificationTypeAppId)
+}
@@ -0,0 +1,109 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+)
+
+func TestReplayNotifications(t *testing.T) {
+	intf := func(name string) *ndk.InterfaceNotification {
+		return &ndk.InterfaceNotification{Key: &ndk.InterfaceKey{IfName: name}}
+	}
+
+	tests := map[string]struct {
+		size     int
+		streamed int
+		want     []string
+	}{
+		"Fewer notifications than buffer size": {
+			size:     3,
+			streamed: 2,
+			want:     []string{"ethernet-1/1", "ethernet-1/2"},
+		},
+		"More notifications than buffer size": {
+			size:     2,
+			streamed: 5,
+			want:     []string{"ethernet-1/4", "ethernet-1/5"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, WithNotificationReplay(tc.size))
+			var ns []*ndk.Notification
+			for i := 1; i <= tc.streamed; i++ {
+				ns = append(ns, &ndk.Notification{
+					SubscriptionTypes: &ndk.Notification_Intf{Intf: intf(fmt.Sprintf("ethernet-1/%d", i))},
+				})
+			}
+			withFakeStream(a, ns...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.ReceiveInterfaceNotifications(ctx)
+			for range ns {
+				<-a.Notifications.Interface
+			}
+
+			// late listener receives buffered notifications
+			listenCtx, stopListening := context.WithCancel(context.Background())
+			replay, err := a.ReplayInterfaceNotifications(listenCtx)
+			if err != nil {
+				t.Fatalf("ReplayInterfaceNotifications() returned error: %v", err)
+			}
+			for _, want := range tc.want {
+				n := <-replay
+				if got := n.GetKey().GetIfName(); got != want {
+					t.Errorf("replayed interface %s, want %s", got, want)
+				}
+			}
+
+			// followed by notifications sent afterwards
+			ch := make(chan *ndk.InterfaceNotification, 1)
+			sendNotification(ctx, a, NotificationTypeInterface, ch, intf("ethernet-1/10"))
+			if n := <-replay; n.GetKey().GetIfName() != "ethernet-1/10" {
+				t.Errorf("received interface %s, want ethernet-1/10", n.GetKey().GetIfName())
+			}
+
+			stopListening()
+			for n := range replay {
+				t.Errorf("received %v after listener was stopped", n)
+			}
+		})
+	}
+}
+
+func TestReplayNotificationsNotEnabled(t *testing.T) {
+	a := newTestAgent(t)
+	if _, err := a.ReplayInterfaceNotifications(context.Background()); !errors.Is(err, ErrReplayNotEnabled) {
+		t.Errorf("ReplayInterfaceNotifications() error = %v, want %v", err, ErrReplayNotEnabled)
+	}
+}
+
+func TestReplayConfigNotifications(t *testing.T) {
+	a := newTestAgent(t, WithStreamConfig(), WithNotificationReplay(2))
+	withFakeStream(a,
+		configNotification(ndk.SdkMgrOperation_Create, ".greeter", ".greeter"),
+		commitEndNotification(1),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.receiveConfigNotifications(ctx)
+	<-a.Notifications.Config
+	<-a.Notifications.Config
+
+	replay, err := a.ReplayConfigNotifications(ctx)
+	if err != nil {
+		t.Fatalf("ReplayConfigNotifications() returned error: %v", err)
+	}
+	for _, want := range []string{"/greeter", ".commit.end"} {
+		if n := <-replay; n.Path != want {
+			t.Errorf("replayed config path %s, want %s", n.Path, want)
+		}
+	}
+}
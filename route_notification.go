@@ -2,76 +2,239 @@ package bond
 
 import (
 	"context"
+	"errors"
+	"net"
+	"strconv"
 
 	"github.com/nokia/srlinux-ndk-go/ndk"
-	"google.golang.org/protobuf/encoding/prototext"
 )
 
+// ErrRouteStreamNotStarted is returned when the route notification subscription
+// is updated before ReceiveRouteNotifications started the route notification stream.
+var ErrRouteStreamNotStarted = errors.New("route notification stream is not started")
+
+// ErrRouteSubscriptionUpdateFailed is returned when the route notification subscription
+// could not be updated.
+var ErrRouteSubscriptionUpdateFailed = errors.New("route subscription update failed")
+
 // ReceiveRouteNotifications starts an route notification stream
 // and sends notifications to channel `Route`.
 // If the main execution intends to continue running after calling this method,
 // it should be called as a goroutine.
 // `Route` chan carries values of type ndk.IpRouteNotification
-func (a *Agent) ReceiveRouteNotifications(ctx context.Context) {
+// If Agent has an unresolved route handler set with WithUnresolvedRouteHandler,
+// the handler is called for every unresolved route before it is sent to `Route`.
+// Chan `Route` is unbuffered by default, option WithRouteNotificationBuffer
+// sets its buffer size and the policy applied when the buffer is full.
+// If Agent is created with option WithTypedNotifications,
+// every notification is also sent to channel `RouteEvent`
+// after it was sent to `Route`, so both chans must be read.
+// `RouteEvent` carries values of type RouteNotification.
+// If caching is also enabled with WithCaching, Update events carry
+// the last-known route of the same key in Previous.
+// Options, e.g. WithRouteInstanceFilter, restrict the streamed routes.
+// By default, routes of all network instances are streamed.
+func (a *Agent) ReceiveRouteNotifications(ctx context.Context, opts ...RouteSubscriptionOption) {
+	if !a.startReceiving(NotificationTypeRoute) {
+		return
+	}
 	defer close(a.Notifications.Route)
-	routeStream := a.startRouteNotificationStream(ctx)
-
-	for routeStreamResp := range routeStream {
-		b, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(routeStreamResp)
-		if err != nil {
-			a.logger.Info().
-				Msgf("Route notification Marshal failed: %+v", err)
-			continue
-		}
+	defer close(a.Notifications.RouteEvent)
 
-		a.logger.Info().
-			Msgf("Received Route notifications:\n%s", b)
+	routeReq := &ndk.IpRouteSubscriptionRequest{}
+	for _, opt := range opts {
+		opt(routeReq)
+	}
+	// last-known routes keyed by network instance and prefix,
+	// only accessed by the route notification goroutine
+	lastRoutes := make(map[string]*RouteNotification)
 
-		for _, n := range routeStreamResp.GetNotification() {
-			routeNotif := n.GetRoute()
-			if routeNotif == nil {
-				a.logger.Info().
-					Msgf("Empty route notification:%+v", n)
-				continue
+	subscribe(ctx, a, NotificationTypeRoute,
+		func(req *ndk.NotificationRegisterRequest) {
+			req.SubscriptionTypes = &ndk.NotificationRegisterRequest_Route{
+				Route: routeReq,
 			}
-			a.Notifications.Route <- routeNotif
-		}
-	}
+		},
+		(*ndk.Notification).GetRoute,
+		func(n *ndk.IpRouteNotification) {
+			if a.unresolvedRouteHandler != nil {
+				if r := ParseRouteNotification(n); r.Unresolved {
+					a.unresolvedRouteHandler(r)
+				}
+			}
+			if !sendNotificationPolicy(ctx, a, NotificationTypeRoute, a.Notifications.Route, n, a.routeOverflow) && ctx.Err() != nil {
+				return
+			}
+			if a.typedNotifications {
+				r := ParseRouteNotification(n)
+				if a.cacheNotifications {
+					trackRoute(lastRoutes, r)
+				}
+				deliverNotificationPolicy(ctx, a, NotificationTypeRoute, a.Notifications.RouteEvent, r, a.routeOverflow)
+			}
+		})
 }
 
-// startRouteNotificationStream starts a notification stream for Route service notifications.
-func (a *Agent) startRouteNotificationStream(ctx context.Context) chan *ndk.NotificationStreamResponse {
-	streamID := a.createNotificationStream(ctx)
+// trackRoute sets Previous of Update route event r to the last-known
+// route of its key in lastRoutes and records r as the last-known route.
+// Delete events evict the last-known route.
+func trackRoute(lastRoutes map[string]*RouteNotification, r *RouteNotification) {
+	key := r.NetworkInstance + "/" + r.Prefix
+	if r.Op == ndk.SdkMgrOperation_Delete.String() {
+		delete(lastRoutes, key)
+		return
+	}
+	if r.Op == ndk.SdkMgrOperation_Update.String() {
+		r.Previous = lastRoutes[key]
+	}
+	// last-known routes don't keep their own previous values
+	last := *r
+	last.Previous = nil
+	lastRoutes[key] = &last
+}
 
-	a.logger.Info().
-		Uint64("stream-id", streamID).
-		Msg("Route notification stream created")
+// OverflowPolicy defines how notifications are handled
+// when their channel is full.
+type OverflowPolicy int
 
-	a.addRouteSubscription(ctx, streamID)
+const (
+	// OverflowBlock blocks the notification stream
+	// until the notification is read.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the received notification.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest notification in the channel
+	// to make room for the received notification.
+	OverflowDropOldest
+)
 
-	streamChan := make(chan *ndk.NotificationStreamResponse)
-	go a.startNotificationStream(ctx, streamID,
-		"route", streamChan)
+// Options when subscribing to route notifications.
+type RouteSubscriptionOption func(req *ndk.IpRouteSubscriptionRequest)
 
-	return streamChan
+// WithRouteInstanceFilter restricts route notifications
+// to routes of network instance networkInstance.
+//
+// Example: WithRouteInstanceFilter("default")
+func WithRouteInstanceFilter(networkInstance string) RouteSubscriptionOption {
+	return func(req *ndk.IpRouteSubscriptionRequest) {
+		if req.Key == nil {
+			req.Key = &ndk.RouteKeyPb{}
+		}
+		req.Key.NetInstName = networkInstance
+	}
 }
 
-// addRouteSubscription adds a subscription for Route service notifications
-// to the allocated notification stream.
-func (a *Agent) addRouteSubscription(ctx context.Context, streamID uint64) {
-	// create notification register request for Route service
-	// using acquired stream ID
-	notificationRegisterReq := &ndk.NotificationRegisterRequest{
+// UpdateRouteSubscriptionFilter replaces the filter of the route notification
+// subscription started by ReceiveRouteNotifications with filter.
+// NDK does not support modifying a subscription, so a subscription with the new filter
+// is added to the route notification stream before the previous subscription is deleted.
+// The stream and chan `Route` are kept, notifications matching both filters
+// may be received twice while the subscription is updated.
+// A nil filter subscribes to all routes.
+func (a *Agent) UpdateRouteSubscriptionFilter(ctx context.Context, filter *ndk.RouteKeyPb) error {
+	sub, ok := a.subscriptions.get(string(NotificationTypeRoute))
+	if !ok {
+		return ErrRouteStreamNotStarted
+	}
+
+	resp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, &ndk.NotificationRegisterRequest{
 		Op:       ndk.NotificationRegisterRequest_AddSubscription,
-		StreamId: streamID,
-		SubscriptionTypes: &ndk.NotificationRegisterRequest_Route{ // route service
-			Route: &ndk.IpRouteSubscriptionRequest{},
+		StreamId: sub.streamID,
+		SubscriptionTypes: &ndk.NotificationRegisterRequest_Route{
+			Route: &ndk.IpRouteSubscriptionRequest{Key: filter},
 		},
+	})
+	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
+		a.logger.Error().
+			Msgf("Failed to add route subscription with filter %v, response: %v", filter, resp)
+		return ErrRouteSubscriptionUpdateFailed
 	}
+	a.subscriptions.set(string(NotificationTypeRoute), subscription{streamID: sub.streamID, subID: resp.GetSubId()})
 
-	registerResp, err := a.stubs.sdkMgrService.NotificationRegister(ctx, notificationRegisterReq)
-	if err != nil || registerResp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-		a.logger.Printf("agent %s failed registering to notification with req=%+v: %v",
-			a.Name, notificationRegisterReq, err)
+	resp, err = a.stubs.sdkMgrService.NotificationRegister(ctx, &ndk.NotificationRegisterRequest{
+		Op:       ndk.NotificationRegisterRequest_DeleteSubscription,
+		StreamId: sub.streamID,
+		SubId:    sub.subID,
+	})
+	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
+		a.logger.Error().
+			Msgf("Failed to delete previous route subscription %d, response: %v", sub.subID, resp)
+		return ErrRouteSubscriptionUpdateFailed
+	}
+
+	return nil
+}
+
+// RouteNotification type defines the contents of a streamed IP route notification.
+// Possible Op values are Create, Update, Delete or CreateOrUpdate
+// depending on whether caching is enabled with WithCaching.
+// Prefix follows the format "ip/preflen", e.g. 192.168.11.0/24.
+// NextHopGroupName is the name of the nexthop group the route resolves to,
+// which can be used to correlate routes with programmed nexthop groups.
+// Metric and Preference can be used to reason about route selection.
+// Unresolved is true if NDK reports a created or updated route
+// without any active nexthop, i.e. the route cannot be resolved.
+// Previous is the last-known route of the same network instance and prefix,
+// it is only set on Update events sent to chan RouteEvent with caching enabled.
+type RouteNotification struct {
+	Op               string // NDK operation
+	NetworkInstance  string // Network instance name
+	Prefix           string // IP prefix in the format "ip/preflen"
+	NextHopGroupName string // Nexthop group name
+	NextHopGroupId   uint64 // Nexthop group identifier
+	Metric           uint32 // Route metric
+	Preference       uint32 // Route preference
+	OwnerId          uint32 // Route owner identifier
+	Unresolved       bool   // Route has no active nexthop
+	Previous         *RouteNotification
+}
+
+// ParseRouteNotification parses an NDK IP route notification
+// and returns its contents as RouteNotification.
+// nil is returned if n is nil.
+func ParseRouteNotification(n *ndk.IpRouteNotification) *RouteNotification {
+	if n == nil {
+		return nil
+	}
+	return &RouteNotification{
+		Op:               n.GetOp().String(),
+		NetworkInstance:  n.GetKey().GetNetInstName(),
+		Prefix:           formatPrefix(n.GetKey().GetIpPrefix()),
+		NextHopGroupName: n.GetData().GetNexthopGroupName(),
+		NextHopGroupId:   n.GetData().GetNhgId(),
+		Metric:           n.GetData().GetMetric(),
+		Preference:       n.GetData().GetPreference(),
+		OwnerId:          n.GetData().GetOwnerId(),
+		Unresolved: n.GetOp() != ndk.SdkMgrOperation_Delete &&
+			n.GetData() != nil && len(n.GetData().GetNexthop()) == 0,
 	}
 }
+
+// formatPrefix formats an NDK IP prefix as "ip/preflen".
+// An empty string is returned if the prefix has no valid address.
+func formatPrefix(p *ndk.IpAddrPrefLenPb) string {
+	addr := formatAddr(p.GetIpAddr())
+	if addr == "" {
+		return ""
+	}
+	return addr + "/" + strconv.Itoa(int(p.GetPrefixLength()))
+}
+
+// formatAddr formats an NDK IP address.
+// An empty string is returned if the address is not a valid IPv4/IPv6 address.
+func formatAddr(a *ndk.IpAddressPb) string {
+	addr := a.GetAddr()
+	if len(addr) != net.IPv4len && len(addr) != net.IPv6len {
+		return ""
+	}
+	return net.IP(addr).String()
+}
+
+// OwnsRoute returns true if route notification n is for a route
+// owned by this Agent, i.e. its owner id matches the Agent's AppID.
+// Before registration the AppID set with WithAppID is used.
+// false is returned if the app id is unknown or n carries no route data,
+// e.g. Delete notifications with caching disabled.
+func (a *Agent) OwnsRoute(n *ndk.IpRouteNotification) bool {
+	return a.AppID != 0 && n.GetData().GetOwnerId() == a.AppID
+}
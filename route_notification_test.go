@@ -0,0 +1,491 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/protobuf/proto"
+)
+
+func ipNextHop(addr string) *ndk.NextHop {
+	ip, _ := parseIP(addr)
+	return &ndk.NextHop{Nexthop: &ndk.NextHop_IpNexthop{IpNexthop: ip}}
+}
+
+// unresolvedRoute returns a route notification without active nexthops.
+func unresolvedRoute(prefix string) *ndk.IpRouteNotification {
+	addr, preflen := parseIP(prefix)
+	return &ndk.IpRouteNotification{
+		Op: ndk.SdkMgrOperation_Create,
+		Key: &ndk.RouteKeyPb{
+			NetInstName: "default",
+			IpPrefix:    &ndk.IpAddrPrefLenPb{IpAddr: addr, PrefixLength: preflen},
+		},
+		Data: &ndk.RoutePb{NexthopGroupName: "ndk_sdk"},
+	}
+}
+
+func TestParseRouteNotification(t *testing.T) {
+	tests := map[string]struct {
+		input    *ndk.IpRouteNotification
+		expected *RouteNotification
+	}{
+		"IPv4 route with nexthop group": {
+			input: &ndk.IpRouteNotification{
+				Op: ndk.SdkMgrOperation_Create,
+				Key: &ndk.RouteKeyPb{
+					NetInstName: "default",
+					IpPrefix: &ndk.IpAddrPrefLenPb{
+						IpAddr:       &ndk.IpAddressPb{Addr: net.ParseIP("192.168.11.0").To4()},
+						PrefixLength: 24,
+					},
+				},
+				Data: &ndk.RoutePb{
+					NexthopGroupName: "ndk_sdk",
+					NhgId:            7,
+					OwnerId:          3,
+					Nexthop:          []*ndk.NextHop{ipNextHop("192.168.11.1")},
+				},
+			},
+			expected: &RouteNotification{
+				Op:               "Create",
+				NetworkInstance:  "default",
+				Prefix:           "192.168.11.0/24",
+				NextHopGroupName: "ndk_sdk",
+				NextHopGroupId:   7,
+				OwnerId:          3,
+			},
+		},
+		"Route with metric and preference": {
+			input: &ndk.IpRouteNotification{
+				Op: ndk.SdkMgrOperation_CreateOrUpdate,
+				Key: &ndk.RouteKeyPb{
+					NetInstName: "default",
+					IpPrefix: &ndk.IpAddrPrefLenPb{
+						IpAddr:       &ndk.IpAddressPb{Addr: net.ParseIP("10.0.0.0").To4()},
+						PrefixLength: 8,
+					},
+				},
+				Data: &ndk.RoutePb{
+					NexthopGroupName: "ndk_sdk",
+					Metric:           100,
+					Preference:       170,
+					Nexthop:          []*ndk.NextHop{ipNextHop("10.0.0.1")},
+				},
+			},
+			expected: &RouteNotification{
+				Op:               "CreateOrUpdate",
+				NetworkInstance:  "default",
+				Prefix:           "10.0.0.0/8",
+				NextHopGroupName: "ndk_sdk",
+				Metric:           100,
+				Preference:       170,
+			},
+		},
+		"Unresolved route": {
+			input: unresolvedRoute("192.168.12.0/24"),
+			expected: &RouteNotification{
+				Op:               "Create",
+				NetworkInstance:  "default",
+				Prefix:           "192.168.12.0/24",
+				NextHopGroupName: "ndk_sdk",
+				Unresolved:       true,
+			},
+		},
+		"IPv6 route delete without data": {
+			input: &ndk.IpRouteNotification{
+				Op: ndk.SdkMgrOperation_Delete,
+				Key: &ndk.RouteKeyPb{
+					NetInstName: "ip-vrf1",
+					IpPrefix: &ndk.IpAddrPrefLenPb{
+						IpAddr:       &ndk.IpAddressPb{Addr: net.ParseIP("2001:db8::")},
+						PrefixLength: 64,
+					},
+				},
+			},
+			expected: &RouteNotification{
+				Op:              "Delete",
+				NetworkInstance: "ip-vrf1",
+				Prefix:          "2001:db8::/64",
+			},
+		},
+		"Nil notification": {},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := ParseRouteNotification(tt.input)
+			if tt.expected == nil {
+				if result != nil {
+					t.Errorf("ParseRouteNotification() = %+v, want nil", result)
+				}
+				return
+			}
+			if *result != *tt.expected {
+				t.Errorf("ParseRouteNotification() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOwnsRoute(t *testing.T) {
+	route := func(ownerId uint32) *ndk.IpRouteNotification {
+		return &ndk.IpRouteNotification{Data: &ndk.RoutePb{OwnerId: ownerId}}
+	}
+
+	a := newTestAgent(t, WithAppID(10))
+	mgr := &fakeSdkMgrService{appId: 20}
+	a.stubs = &stubs{sdkMgrService: mgr}
+
+	if !a.OwnsRoute(route(10)) {
+		t.Errorf("OwnsRoute() before registration = false for WithAppID owner")
+	}
+	if a.OwnsRoute(route(20)) {
+		t.Errorf("OwnsRoute() before registration = true for other owner")
+	}
+
+	if err := a.register(); err != nil {
+		t.Fatalf("register() returned error: %v", err)
+	}
+
+	if a.OwnsRoute(route(10)) {
+		t.Errorf("OwnsRoute() after registration = true for WithAppID owner")
+	}
+	if !a.OwnsRoute(route(20)) {
+		t.Errorf("OwnsRoute() after registration = false for registered owner")
+	}
+	if a.OwnsRoute(&ndk.IpRouteNotification{Op: ndk.SdkMgrOperation_Delete}) {
+		t.Errorf("OwnsRoute() = true for notification without data")
+	}
+}
+
+func TestOwnsRouteUnknownAppID(t *testing.T) {
+	a := newTestAgent(t)
+	if a.OwnsRoute(&ndk.IpRouteNotification{Data: &ndk.RoutePb{}}) {
+		t.Errorf("OwnsRoute() = true with unknown app id")
+	}
+}
+
+func TestUnresolvedRouteHandler(t *testing.T) {
+	var unresolved []*RouteNotification
+	a := newTestAgent(t, WithUnresolvedRouteHandler(func(r *RouteNotification) {
+		unresolved = append(unresolved, r)
+	}))
+
+	resolved := unresolvedRoute("192.168.1.0/24")
+	resolved.Data.Nexthop = []*ndk.NextHop{ipNextHop("192.168.1.1")}
+	routes := []*ndk.IpRouteNotification{resolved, unresolvedRoute("192.168.2.0/24")}
+	var ns []*ndk.Notification
+	for _, r := range routes {
+		ns = append(ns, &ndk.Notification{SubscriptionTypes: &ndk.Notification_Route{Route: r}})
+	}
+	withFakeStream(a, ns...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveRouteNotifications(ctx)
+
+	for range routes {
+		<-a.Notifications.Route
+	}
+
+	if len(unresolved) != 1 {
+		t.Fatalf("handler called %d times, want 1", len(unresolved))
+	}
+	if unresolved[0].Prefix != "192.168.2.0/24" {
+		t.Errorf("handler called for %s, want 192.168.2.0/24", unresolved[0].Prefix)
+	}
+}
+
+// waitForSubscription waits until the Agent has a subscription for notifType.
+func waitForSubscription(t *testing.T, a *Agent, notifType NotificationType) subscription {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if sub, ok := a.subscriptions.get(string(notifType)); ok {
+			return sub
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s subscription", notifType)
+	return subscription{}
+}
+
+func TestUpdateRouteSubscriptionFilter(t *testing.T) {
+	a := newTestAgent(t)
+	mgr := withFakeStream(a)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.ReceiveRouteNotifications(ctx)
+	old := waitForSubscription(t, a, NotificationTypeRoute)
+
+	filter := &ndk.RouteKeyPb{NetInstName: "mgmt"}
+	if err := a.UpdateRouteSubscriptionFilter(ctx, filter); err != nil {
+		t.Fatalf("UpdateRouteSubscriptionFilter() returned error: %v", err)
+	}
+
+	reqs := mgr.registerRequests()
+	if len(reqs) != 4 {
+		t.Fatalf("got %d register requests, want 4", len(reqs))
+	}
+
+	add := reqs[2]
+	if add.GetOp() != ndk.NotificationRegisterRequest_AddSubscription {
+		t.Errorf("first update op = %v, want AddSubscription", add.GetOp())
+	}
+	if add.GetStreamId() != old.streamID {
+		t.Errorf("subscription added to stream %d, want %d", add.GetStreamId(), old.streamID)
+	}
+	if !proto.Equal(add.GetRoute().GetKey(), filter) {
+		t.Errorf("subscription filter = %v, want %v", add.GetRoute().GetKey(), filter)
+	}
+
+	del := reqs[3]
+	if del.GetOp() != ndk.NotificationRegisterRequest_DeleteSubscription {
+		t.Errorf("second update op = %v, want DeleteSubscription", del.GetOp())
+	}
+	if del.GetSubId() != old.subID {
+		t.Errorf("deleted subscription %d, want %d", del.GetSubId(), old.subID)
+	}
+
+	// further updates replace the updated subscription
+	sub, _ := a.subscriptions.get(string(NotificationTypeRoute))
+	if sub.subID == old.subID {
+		t.Errorf("subscription id not updated, still %d", sub.subID)
+	}
+}
+
+func TestUpdateRouteSubscriptionFilterErrors(t *testing.T) {
+	tests := map[string]struct {
+		start    bool
+		failures int
+		wantErr  error
+	}{
+		"stream not started": {
+			wantErr: ErrRouteStreamNotStarted,
+		},
+		"register failure": {
+			start:    true,
+			failures: 1,
+			wantErr:  ErrRouteSubscriptionUpdateFailed,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			mgr := withFakeStream(a)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.start {
+				go a.ReceiveRouteNotifications(ctx)
+				waitForSubscription(t, a, NotificationTypeRoute)
+			}
+
+			mgr.mu.Lock()
+			mgr.registerFailures = tc.failures
+			mgr.mu.Unlock()
+
+			err := a.UpdateRouteSubscriptionFilter(ctx, &ndk.RouteKeyPb{NetInstName: "mgmt"})
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("UpdateRouteSubscriptionFilter() error = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReceiveRouteNotificationsInstanceFilter(t *testing.T) {
+	tests := map[string]struct {
+		opts    []RouteSubscriptionOption
+		wantKey *ndk.RouteKeyPb
+	}{
+		"No filter": {},
+		"Instance filter": {
+			opts:    []RouteSubscriptionOption{WithRouteInstanceFilter("default")},
+			wantKey: &ndk.RouteKeyPb{NetInstName: "default"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			mgr := withFakeStream(a)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.ReceiveRouteNotifications(ctx, tc.opts...)
+			waitForSubscription(t, a, NotificationTypeRoute)
+
+			reqs := mgr.registerRequests()
+			req := reqs[len(reqs)-1]
+			if req.GetOp() != ndk.NotificationRegisterRequest_AddSubscription {
+				t.Fatalf("last register request op = %v, want AddSubscription", req.GetOp())
+			}
+			if got := req.GetRoute().GetKey(); !proto.Equal(got, tc.wantKey) {
+				t.Errorf("route subscription key = %v, want %v", got, tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestRouteNotificationBuffer(t *testing.T) {
+	prefixes := []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"}
+
+	tests := map[string]struct {
+		policy       OverflowPolicy
+		wantPrefixes []string
+	}{
+		"Drop newest": {
+			policy:       OverflowDropNewest,
+			wantPrefixes: []string{"10.0.0.0/24", "10.0.1.0/24"},
+		},
+		"Drop oldest": {
+			policy:       OverflowDropOldest,
+			wantPrefixes: []string{"10.0.1.0/24", "10.0.2.0/24"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dropped := make(chan NotificationType, len(prefixes))
+			a := newTestAgent(t,
+				WithRouteNotificationBuffer(2, tc.policy),
+				WithMetricsHook(MetricsHook{
+					NotificationDropped: func(notifType NotificationType) { dropped <- notifType },
+				}))
+			if got := cap(a.Notifications.Route); got != 2 {
+				t.Fatalf("Route chan buffer = %d, want 2", got)
+			}
+			// other notification channels are not affected
+			if got := cap(a.Notifications.Interface); got != 0 {
+				t.Errorf("Interface chan buffer = %d, want 0", got)
+			}
+
+			var ns []*ndk.Notification
+			for _, p := range prefixes {
+				ns = append(ns, &ndk.Notification{SubscriptionTypes: &ndk.Notification_Route{Route: unresolvedRoute(p)}})
+			}
+			withFakeStream(a, ns...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// no reader until the buffer overflows
+			go a.ReceiveRouteNotifications(ctx)
+
+			select {
+			case notifType := <-dropped:
+				if notifType != NotificationTypeRoute {
+					t.Errorf("NotificationDropped() notifType = %s, want Route", notifType)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("NotificationDropped() was not called")
+			}
+
+			var got []string
+			for range tc.wantPrefixes {
+				got = append(got, formatPrefix(recvNotification(t, a.Notifications.Route).(*ndk.IpRouteNotification).GetKey().GetIpPrefix()))
+			}
+			if !reflect.DeepEqual(got, tc.wantPrefixes) {
+				t.Errorf("received routes %v, want %v", got, tc.wantPrefixes)
+			}
+			if len(dropped) != 0 {
+				t.Errorf("NotificationDropped() called %d more times, want once", len(dropped))
+			}
+		})
+	}
+}
+
+func TestWithRouteNotificationBufferInvalid(t *testing.T) {
+	tests := map[string]Option{
+		"Negative size":          WithRouteNotificationBuffer(-1, OverflowDropNewest),
+		"Unknown policy":         WithRouteNotificationBuffer(10, OverflowPolicy(42)),
+		"Unbuffered drop oldest": WithRouteNotificationBuffer(0, OverflowDropOldest),
+		"Unbuffered drop newest": WithRouteNotificationBuffer(0, OverflowDropNewest),
+	}
+
+	for name, opt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, errs := NewAgent("test", opt); len(errs) == 0 {
+				t.Errorf("NewAgent() returned no errors")
+			}
+		})
+	}
+}
+
+func TestRouteEventPrevious(t *testing.T) {
+	route := func(op ndk.SdkMgrOperation, prefix string, metric uint32) *ndk.Notification {
+		r := unresolvedRoute(prefix)
+		r.Op = op
+		r.Data.Metric = metric
+		r.Data.Nexthop = []*ndk.NextHop{ipNextHop("192.168.1.1")}
+		return &ndk.Notification{SubscriptionTypes: &ndk.Notification_Route{Route: r}}
+	}
+
+	tests := map[string]struct {
+		opts          []Option
+		notifications []*ndk.Notification
+		// wantPrevious is the expected previous metric per event, -1 if no previous value
+		wantPrevious []int
+	}{
+		"Caching": {
+			opts: []Option{WithTypedNotifications(), WithCaching()},
+			notifications: []*ndk.Notification{
+				route(ndk.SdkMgrOperation_Create, "192.168.1.0/24", 10),
+				route(ndk.SdkMgrOperation_Create, "192.168.2.0/24", 50),
+				route(ndk.SdkMgrOperation_Update, "192.168.1.0/24", 20),
+				route(ndk.SdkMgrOperation_Update, "192.168.1.0/24", 30),
+			},
+			wantPrevious: []int{-1, -1, 10, 20},
+		},
+		"Delete evicts last-known route": {
+			opts: []Option{WithTypedNotifications(), WithCaching()},
+			notifications: []*ndk.Notification{
+				route(ndk.SdkMgrOperation_Create, "192.168.1.0/24", 10),
+				route(ndk.SdkMgrOperation_Delete, "192.168.1.0/24", 0),
+				route(ndk.SdkMgrOperation_Update, "192.168.1.0/24", 20),
+			},
+			wantPrevious: []int{-1, -1, -1},
+		},
+		"Caching disabled": {
+			opts: []Option{WithTypedNotifications()},
+			notifications: []*ndk.Notification{
+				route(ndk.SdkMgrOperation_Create, "192.168.1.0/24", 10),
+				route(ndk.SdkMgrOperation_Update, "192.168.1.0/24", 20),
+			},
+			wantPrevious: []int{-1, -1},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, tc.opts...)
+			withFakeStream(a, tc.notifications...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go a.ReceiveRouteNotifications(ctx)
+
+			for i, want := range tc.wantPrevious {
+				<-a.Notifications.Route
+				r := <-a.Notifications.RouteEvent
+				switch {
+				case want < 0 && r.Previous != nil:
+					t.Errorf("event %d Previous = %+v, want nil", i, r.Previous)
+				case want >= 0 && r.Previous == nil:
+					t.Errorf("event %d Previous = nil, want metric %d", i, want)
+				case want >= 0 && r.Previous.Metric != uint32(want):
+					t.Errorf("event %d Previous metric = %d, want %d", i, r.Previous.Metric, want)
+				case want >= 0 && r.Previous.Previous != nil:
+					t.Errorf("event %d Previous has a previous value, want nil", i)
+				}
+			}
+		})
+	}
+}
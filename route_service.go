@@ -15,6 +15,9 @@ var ErrRouteDeleteFailed = errors.New("route delete failed")
 var ErrRouteAddOrUpdateFailed = errors.New("route add or update failed")
 var ErrRouteSyncStart = errors.New("route sync start failed")
 var ErrRouteSyncEnd = errors.New("route sync end failed")
+var ErrRouteNotOwned = errors.New("route is owned by another app")
+var ErrRouteNotProgrammed = errors.New("route is not programmed by the agent")
+var ErrInvalidNetInstName = errors.New("invalid network instance name")
 
 // Options when adding/updating IP routes.
 type RouteOption func(r *ndk.RouteInfo)
@@ -47,26 +50,32 @@ func WithNetInstName(n string) RouteOption {
 // prefix string is in the format of  "ip/preflen"
 // where ip is the IP address and preflen is the length of the prefix.
 // If the input string does not match the expected format,
-// RouteAdd/Update returns an error.
+// the prefix is left unset and RouteAdd/Update return an error
+// wrapping ErrInvalidIpAddr before any request is sent.
 //
 // Example: 192.168.11.2/30
 func WithIpPrefix(prefix string) RouteOption {
 	return func(r *ndk.RouteInfo) {
-		addr, preflen := parseIP(prefix)
-		r.Key.IpPrefix = &ndk.IpAddrPrefLenPb{
-			IpAddr:       addr,
-			PrefixLength: preflen,
+		p, err := parsePrefix(prefix)
+		if err != nil {
+			r.Key.IpPrefix = new(ndk.IpAddrPrefLenPb)
+			return
 		}
+		r.Key.IpPrefix = p
 	}
 }
 
 // WithNextHopGroupName sets the route Next Hop Group Name.
 // NDK expects the input nhg to end in the format "_sdk" or "_SDK".
+// The same length and character constraints as in WithName apply.
 // If the input string does not match the expected format,
 // RouteAdd returns an error.
 // Specified nhg also must be a valid NDK next hop group that is programmed
 // with method NextHopGroupAdd or NextHopGroupUpdate.
 // It cannot be a nexthop group configured on SRL.
+// The nexthop group is looked up in the route's network instance,
+// NDK routes have no field for a distinct resolving network instance,
+// so routes cannot be leaked to other network instances through NDK.
 //
 // Example: ndk_sdk
 func WithNextHopGroupName(nhg string) RouteOption {
@@ -89,6 +98,58 @@ func WithPreference(p uint32) RouteOption {
 	}
 }
 
+// NewDefaultRoute creates an IPv4 default route 0.0.0.0/0
+// in network instance networkInstance using nexthop group nhg.
+//
+// Example: NewDefaultRoute("default", "ndk_sdk")
+func NewDefaultRoute(networkInstance, nhg string) *ndk.RouteInfo {
+	return NewRoute(
+		WithNetInstName(networkInstance),
+		WithIpPrefix("0.0.0.0/0"),
+		WithNextHopGroupName(nhg),
+	)
+}
+
+// NewDefaultIPv6Route creates an IPv6 default route ::/0
+// in network instance networkInstance using nexthop group nhg.
+//
+// Example: NewDefaultIPv6Route("default", "ndk_sdk")
+func NewDefaultIPv6Route(networkInstance, nhg string) *ndk.RouteInfo {
+	return NewRoute(
+		WithNetInstName(networkInstance),
+		WithIpPrefix("::/0"),
+		WithNextHopGroupName(nhg),
+	)
+}
+
+// RoutesFromPrefixes creates routes for prefixes in network instance networkInstance
+// all using nexthop group nhg, e.g. to program many prefixes with a single RouteAdd.
+// prefixes are strings in the format of "ip/preflen".
+// All prefixes are validated, if any prefix is invalid no routes are returned
+// and the returned error joins errors wrapping ErrInvalidIpAddr for every invalid prefix.
+//
+// Example:
+// routes, err := RoutesFromPrefixes("default", "ndk_sdk", []string{"10.0.0.0/24", "10.0.1.0/24"})
+func RoutesFromPrefixes(networkInstance, nhg string, prefixes []string) ([]*ndk.RouteInfo, error) {
+	routes := make([]*ndk.RouteInfo, 0, len(prefixes))
+	var errs error
+	for _, prefix := range prefixes {
+		if _, err := parsePrefix(prefix); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		routes = append(routes, NewRoute(
+			WithNetInstName(networkInstance),
+			WithIpPrefix(prefix),
+			WithNextHopGroupName(nhg),
+		))
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return routes, nil
+}
+
 // RouteAdd adds agent IP route(s) in SR Linux.
 // This method takes route(s) of type RouteInfo,
 // which is defined in the NDK Go Bindings.
@@ -98,7 +159,46 @@ func WithPreference(p uint32) RouteOption {
 // network instance name,and next hop group name.
 // If errors are encountered during the parsing of prefixes or
 // adding of routes, an error is returned.
+// All routes are validated before the request is sent,
+// the returned error names every invalid route.
+// Routes with an owner id of another app, e.g. routes copied
+// from route notifications, are rejected with ErrRouteNotOwned.
+// Routes are sent in chunks of at most 1000 routes per request,
+// the chunk size can be set with option WithRouteBatchSize.
+// All chunks are sent even if a chunk fails, routes of successful chunks
+// stay programmed and the returned error names every failed chunk.
 func (a *Agent) RouteAdd(routes ...*ndk.RouteInfo) error {
+	if err := a.validateRoutes(routes); err != nil {
+		a.logger.Error().Err(err).Msg("Invalid routes")
+		return err
+	}
+	if err := a.checkRouteOwners(routes); err != nil {
+		return err
+	}
+
+	size := a.routeBatchSize
+	if size <= 0 {
+		size = defaultRouteBatchSize
+	}
+	chunks := (len(routes) + size - 1) / size
+	if chunks == 0 {
+		chunks = 1 // empty requests are still sent
+	}
+
+	var errs error
+	for i := 0; i < chunks; i++ {
+		chunk := routes[min(i*size, len(routes)):min((i+1)*size, len(routes))]
+		if err := a.routeAddChunk(chunk); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%w: chunk %d of %d, routes %d to %d",
+				err, i+1, chunks, i*size, i*size+len(chunk)-1))
+		}
+	}
+	return errs
+}
+
+// routeAddChunk adds or updates routes with a single RouteAddOrUpdate request
+// and records them as programmed if the request succeeds.
+func (a *Agent) routeAddChunk(routes []*ndk.RouteInfo) error {
 	infos := []*ndk.RouteInfo{}
 	infos = append(infos, routes...)
 	req := &ndk.RouteAddRequest{
@@ -106,7 +206,12 @@ func (a *Agent) RouteAdd(routes ...*ndk.RouteInfo) error {
 	}
 
 	// call NDK RPC
-	a.logger.Info().Msg("Add/Update routes")
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
+	a.logger.Info().Msgf("Add/Update %d routes", len(routes))
 	resp, err := a.stubs.routeService.RouteAddOrUpdate(a.ctx, req)
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
 		a.logger.Error().
@@ -115,12 +220,182 @@ func (a *Agent) RouteAdd(routes ...*ndk.RouteInfo) error {
 	}
 	a.logger.Debug().
 		Msgf("Successfully added/updated routes, response: %v", resp)
+	for _, r := range routes {
+		a.routes.set(routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix()), cloneProto(r))
+	}
 	return nil
 }
 
+// RefreshRoute adds the route for prefix in network instance networkInstance
+// programmed by the agent once more, e.g. to trigger re-resolution of the route
+// after its nexthop group changed resolution state.
+// The route is re-added as last programmed with RouteAdd or RouteUpdate.
+// prefix string is in the format of "ip/preflen".
+// An error wrapping ErrRouteNotProgrammed is returned
+// if the agent has not programmed the route.
+//
+// Example: RefreshRoute("default", "192.168.11.0/24")
+func (a *Agent) RefreshRoute(networkInstance, prefix string) error {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		a.logger.Error().
+			Msgf("Invalid IP prefix %s.", prefix)
+		return err
+	}
+
+	r, ok := a.routes.get(routeKey(networkInstance, p))
+	if !ok {
+		return fmt.Errorf("%w: %s in network instance %s", ErrRouteNotProgrammed, prefix, networkInstance)
+	}
+	return a.RouteAdd(cloneProto(r))
+}
+
+// RouteExists returns true if the agent has programmed a route for prefix
+// in network instance networkInstance with RouteAdd or RouteUpdate.
+// Only the agent's own routes are consulted, SR Linux is not queried.
+// prefix string is in the format of "ip/preflen",
+// false is returned for invalid prefixes.
+//
+// Example: RouteExists("default", "2001:db8::/64")
+func (a *Agent) RouteExists(networkInstance, prefix string) bool {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		return false
+	}
+	_, ok := a.routes.get(routeKey(networkInstance, p))
+	return ok
+}
+
+// ProgrammedRoutes returns copies of all routes programmed by the agent
+// with RouteAdd or RouteUpdate and not deleted with RouteDelete,
+// ordered by network instance and prefix.
+// Apps can use it to reconcile their routes, e.g. after a restart
+// with state restored by ImportState.
+// Only the agent's own routes are returned, SR Linux is not queried.
+func (a *Agent) ProgrammedRoutes() []*ndk.RouteInfo {
+	return sortedValues(a.routes.snapshot(cloneProto[*ndk.RouteInfo]))
+}
+
+// NextHopSpec defines a nexthop of a nexthop group
+// created by AddRouteWithNextHops or NextHopGroupReplaceNextHops.
+// Address is the IPv4/IPv6 nexthop address without prefix length.
+// If Labels is set, an MPLS nexthop with the label stack Labels is created,
+// otherwise an IP nexthop.
+type NextHopSpec struct {
+	Address   string
+	Labels    []uint32
+	ResolveTo ndk.NextHop_ResolveToType
+	Type      ndk.NextHop_ResolutionType
+}
+
+// nextHopOptions returns the nexthop group options
+// adding the nexthops defined by nexthops.
+func nextHopOptions(nexthops []NextHopSpec) []NextHopGroupOption {
+	opts := make([]NextHopGroupOption, 0, len(nexthops))
+	for _, nh := range nexthops {
+		if len(nh.Labels) != 0 {
+			opts = append(opts, WithMplsNextHop(nh.Address, nh.Labels, nh.ResolveTo, nh.Type))
+			continue
+		}
+		opts = append(opts, WithIpNextHop(nh.Address, nh.ResolveTo, nh.Type))
+	}
+	return opts
+}
+
+// AddRouteWithNextHops adds a route for prefix in network instance networkInstance
+// together with a dedicated nexthop group containing nexthops.
+// The nexthop group is named after the route prefix, e.g. "10.0.0.0/24_sdk",
+// so adding the same route again updates its nexthop group.
+// The nexthop group is added before the route referencing it,
+// the route is not added if adding the nexthop group fails.
+// prefix string is in the format of "ip/preflen".
+//
+// Example:
+// AddRouteWithNextHops("default", "10.0.0.0/24",
+// []NextHopSpec{{Address: "192.168.1.1", ResolveTo: ndk.NextHop_DIRECT, Type: ndk.NextHop_REGULAR}})
+func (a *Agent) AddRouteWithNextHops(networkInstance, prefix string, nexthops []NextHopSpec) error {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		a.logger.Error().
+			Msgf("Invalid IP prefix %s.", prefix)
+		return err
+	}
+
+	opts := []NextHopGroupOption{
+		WithNetworkInstanceName(networkInstance),
+		WithName(routeNhgName(p)),
+	}
+	nhg := NewNextHopGroup(append(opts, nextHopOptions(nexthops)...)...)
+	if err := a.NextHopGroupAdd(nhg); err != nil {
+		return err
+	}
+
+	return a.RouteAdd(NewRoute(
+		WithNetInstName(networkInstance),
+		WithIpPrefix(prefix),
+		WithNextHopGroupName(nhg.GetKey().GetName()),
+	))
+}
+
+// DeleteRouteWithNextHops deletes a route added with AddRouteWithNextHops
+// for prefix in network instance networkInstance along with its nexthop group.
+// Only the nexthop group created by AddRouteWithNextHops is deleted,
+// a nexthop group the route was pointed to otherwise is not.
+// The nexthop group is kept if other routes programmed by the agent
+// still reference it.
+// prefix string is in the format of "ip/preflen".
+//
+// Example: DeleteRouteWithNextHops("default", "10.0.0.0/24") deletes from FIB
+// route 10.0.0.0/24 and nexthop group 10.0.0.0/24_sdk.
+func (a *Agent) DeleteRouteWithNextHops(networkInstance, prefix string) error {
+	p, err := parsePrefix(prefix)
+	if err != nil {
+		a.logger.Error().
+			Msgf("Invalid IP prefix %s.", prefix)
+		return err
+	}
+	nhgName := routeNhgName(p)
+
+	if err := a.RouteDelete(networkInstance, prefix); err != nil {
+		return err
+	}
+
+	for _, r := range a.routes.snapshot(cloneProto[*ndk.RouteInfo]) {
+		if r.GetKey().GetNetInstName() == networkInstance &&
+			r.GetData().GetNexthopGroupName() == nhgName {
+			a.logger.Info().
+				Msgf("Nexthop group %s is used by route %s, not deleting it",
+					nhgName, formatPrefix(r.GetKey().GetIpPrefix()))
+			return nil
+		}
+	}
+
+	return a.NextHopGroupDelete(networkInstance, nhgName)
+}
+
+// routeNhgName returns the name of the nexthop group
+// created by AddRouteWithNextHops for a route with prefix p.
+// The name is built from the network address of p,
+// so that all spellings of a prefix, e.g. "10.0.0.1/24" and "10.0.0.0/24",
+// name the same nexthop group.
+func routeNhgName(p *ndk.IpAddrPrefLenPb) string {
+	ip := net.IP(p.GetIpAddr().GetAddr())
+	mask := net.CIDRMask(int(p.GetPrefixLength()), len(ip)*8)
+	network := &ndk.IpAddrPrefLenPb{
+		IpAddr:       &ndk.IpAddressPb{Addr: ip.Mask(mask)},
+		PrefixLength: p.GetPrefixLength(),
+	}
+	return formatPrefix(network) + "_sdk"
+}
+
 // RouteUpdate updates and performs resynchronization on programmed NDK routes.
 // Routes not added as part of this update are removed from FIB.
 // Routes added as part of this update are added to the FIB.
+// Resynchronization is scoped to routes owned by this agent:
+// routes programmed by other apps or protocols, including routes
+// in the same network instance, are never removed by RouteUpdate.
+// RouteUpdate does not delete routes itself, NDK removes the agent's
+// routes not added between sync start and sync end.
 // This method takes route(s) of type RouteInfo,
 // which is defined in the NDK Go Bindings.
 // RouteInfo struct(s) can be populated by method NewRoute
@@ -136,6 +411,14 @@ func (a *Agent) RouteAdd(routes ...*ndk.RouteInfo) error {
 // FIB with routes 1.1.1.1, 1.1.1.3.
 // Route 1.1.1.2 that was previously added, is deleted due to the update.
 func (a *Agent) RouteUpdate(routes ...*ndk.RouteInfo) error {
+	// invalid routes are reported before the sync is started
+	if err := a.validateRoutes(routes); err != nil {
+		a.logger.Error().Err(err).Msg("Invalid routes")
+		return err
+	}
+	if err := a.checkRouteOwners(routes); err != nil {
+		return err
+	}
 	err := a.routeSyncStart()
 	if err != nil {
 		return err
@@ -148,9 +431,40 @@ func (a *Agent) RouteUpdate(routes ...*ndk.RouteInfo) error {
 	if err != nil {
 		return err
 	}
+	// routes not part of this update were removed
+	programmed := make(map[string]*ndk.RouteInfo, len(routes))
+	for _, r := range routes {
+		programmed[routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix())] = cloneProto(r)
+	}
+	a.routes.replace(programmed)
 	return nil
 }
 
+// RouteUpdateWithPreference updates and performs resynchronization
+// on programmed NDK routes like RouteUpdate,
+// applying preference pref to every route that has no preference set.
+// Routes with a preference set using WithPreference keep their preference.
+// Passed routes are not modified, routes lacking a preference
+// are copied before the preference is applied.
+//
+// Example:
+// RouteUpdateWithPreference(10, r1, r2) where r1 was created WithPreference(5)
+// programs r1 with preference 5 and r2 with preference 10.
+func (a *Agent) RouteUpdateWithPreference(pref uint32, routes ...*ndk.RouteInfo) error {
+	withPref := make([]*ndk.RouteInfo, 0, len(routes))
+	for _, r := range routes {
+		if r.GetData().GetPreference() == 0 {
+			r = cloneProto(r)
+			if r.Data == nil {
+				r.Data = new(ndk.RoutePb)
+			}
+			r.Data.Preference = pref
+		}
+		withPref = append(withPref, r)
+	}
+	return a.RouteUpdate(withPref...)
+}
+
 // RouteDelete deletes agent IP route(s) in SR Linux.
 // The method takes single or multiple IPv4/IPv6 prefixes
 // under a network instance name (e.g. default).
@@ -158,6 +472,8 @@ func (a *Agent) RouteUpdate(routes ...*ndk.RouteInfo) error {
 // where ip is the IP address and preflen is the length of the prefix.
 // If errors are encountered during the parsing of prefixes or
 // deleting of routes, an error is returned.
+// All prefixes are validated before the request is sent,
+// the returned error wraps ErrInvalidIpAddr and names every invalid prefix.
 //
 // Example: RouteDelete("default", "192.168.11.1/24") deletes from FIB
 // an IPv4 address with a prefix length of 24.
@@ -165,28 +481,35 @@ func (a *Agent) RouteUpdate(routes ...*ndk.RouteInfo) error {
 // an IPv6 address with a prefix length of 64.
 func (a *Agent) RouteDelete(networkInstance string, prefixes ...string) error {
 	keys := []*ndk.RouteKeyPb{}
+	var errs error
 	for _, prefix := range prefixes {
-		addr, preflen := parseIP(prefix)
-		if addr == nil || preflen == 0 {
-			a.logger.Error().
-				Msgf("Invalid IP prefix %s.", addr)
-			return fmt.Errorf("%w", ErrInvalidIpAddr)
-		}
-		prefix := &ndk.IpAddrPrefLenPb{
-			IpAddr:       addr,
-			PrefixLength: preflen,
+		// prefix length 0 is valid for default routes, but must be explicit
+		p, err := parsePrefix(prefix)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
 		}
 		key := &ndk.RouteKeyPb{
 			NetInstName: networkInstance,
-			IpPrefix:    prefix,
+			IpPrefix:    p,
 		}
 		keys = append(keys, key)
 	}
+	// all invalid prefixes are reported before the request is sent
+	if errs != nil {
+		a.logger.Error().Err(errs).Msg("Invalid IP prefixes")
+		return errs
+	}
 	req := &ndk.RouteDeleteRequest{
 		Routes: keys,
 	}
 
 	// call NDK RPC
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	a.logger.Info().Msg("Delete routes")
 	resp, err := a.stubs.routeService.RouteDelete(a.ctx, req)
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
@@ -196,11 +519,58 @@ func (a *Agent) RouteDelete(networkInstance string, prefixes ...string) error {
 	}
 	a.logger.Debug().
 		Msgf("Successfully deleted routes, response: %v", resp)
+	for _, key := range keys {
+		a.routes.delete(routeKey(networkInstance, key.GetIpPrefix()))
+	}
 	return nil
 }
 
+// DiffRoutes compares desired routes with current routes
+// and returns the routes to add and to delete to reconcile current with desired.
+// Routes are matched by network instance and ip prefix.
+// toAdd contains desired routes missing from current
+// and desired routes whose nexthop group name, preference or metric differ,
+// which RouteAdd updates in place.
+// toDelete contains current routes missing from desired.
+// Data only returned in notifications (nexthops, owner and nexthop group id)
+// is ignored, so current can be populated from route notifications.
+// Returned routes are the passed routes in input order.
+func DiffRoutes(desired, current []*ndk.RouteInfo) (toAdd, toDelete []*ndk.RouteInfo) {
+	cur := make(map[string]*ndk.RouteInfo, len(current))
+	for _, r := range current {
+		cur[routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix())] = r
+	}
+	want := make(map[string]bool, len(desired))
+	for _, r := range desired {
+		key := routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix())
+		want[key] = true
+		if c, ok := cur[key]; !ok || !routeDataEqual(r.GetData(), c.GetData()) {
+			toAdd = append(toAdd, r)
+		}
+	}
+	for _, r := range current {
+		if !want[routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix())] {
+			toDelete = append(toDelete, r)
+		}
+	}
+	return toAdd, toDelete
+}
+
+// routeDataEqual returns true if route data x and y
+// have the same programmable attributes.
+func routeDataEqual(x, y *ndk.RoutePb) bool {
+	return x.GetNexthopGroupName() == y.GetNexthopGroupName() &&
+		x.GetPreference() == y.GetPreference() &&
+		x.GetMetric() == y.GetMetric()
+}
+
 // routeSyncStart starts syncing agent IP routes in SR Linux.
 func (a *Agent) routeSyncStart() error {
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	resp, err := a.stubs.routeService.SyncStart(a.ctx, &ndk.SyncRequest{})
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
 		a.logger.Error().
@@ -214,6 +584,11 @@ func (a *Agent) routeSyncStart() error {
 
 // routeSyncEnd ends syncing agent IP routes in SR Linux.
 func (a *Agent) routeSyncEnd() error {
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	resp, err := a.stubs.routeService.SyncEnd(a.ctx, &ndk.SyncRequest{})
 	if err != nil || resp.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
 		a.logger.Error().
@@ -225,6 +600,86 @@ func (a *Agent) routeSyncEnd() error {
 	return nil
 }
 
+// routeKey returns the route registry key
+// for a route in network instance networkInstance with ip prefix prefix.
+func routeKey(networkInstance string, prefix *ndk.IpAddrPrefLenPb) string {
+	return networkInstance + "/" + formatPrefix(prefix)
+}
+
+// parsePrefix parses an IPv4/IPv6 prefix in the format "ip/preflen".
+// An error wrapping ErrInvalidIpAddr naming prefix is returned
+// if ip is not a valid address or preflen is missing or out of range.
+func parsePrefix(prefix string) (*ndk.IpAddrPrefLenPb, error) {
+	addr, l, found := strings.Cut(prefix, "/")
+	ip := net.ParseIP(addr)
+	if !found || ip == nil {
+		return nil, fmt.Errorf("%w: prefix %q", ErrInvalidIpAddr, prefix)
+	}
+	maxLen := net.IPv6len * 8
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, maxLen = ip4, net.IPv4len*8
+	}
+	preflen, err := strconv.Atoi(l)
+	if err != nil || preflen < 0 || preflen > maxLen {
+		return nil, fmt.Errorf("%w: prefix %q", ErrInvalidIpAddr, prefix)
+	}
+	return &ndk.IpAddrPrefLenPb{
+		IpAddr:       &ndk.IpAddressPb{Addr: ip},
+		PrefixLength: uint32(preflen),
+	}, nil
+}
+
+// checkRouteOwners returns ErrRouteNotOwned if a route has the owner id
+// of another app, e.g. a route copied from a route notification.
+func (a *Agent) checkRouteOwners(routes []*ndk.RouteInfo) error {
+	for _, r := range routes {
+		if owner := r.GetData().GetOwnerId(); owner != 0 && a.AppID != 0 && owner != a.AppID {
+			a.logger.Error().
+				Msgf("Route %s is owned by app id %d, agent app id is %d",
+					routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix()), owner, a.AppID)
+			return ErrRouteNotOwned
+		}
+	}
+	return nil
+}
+
+// validateRoutes validates all routes before they are programmed
+// and returns an error naming every invalid route, joining
+// the errors of all routes.
+// A route is invalid if its prefix, network instance name or
+// nexthop group name is missing or invalid, e.g. if WithIpPrefix
+// was given an invalid prefix.
+// Network instances are checked with checkNetworkInstance.
+// Nexthop groups not programmed by the agent are only logged,
+// as nexthop groups programmed before the agent restarted are not known.
+func (a *Agent) validateRoutes(routes []*ndk.RouteInfo) error {
+	var errs error
+	for i, r := range routes {
+		var routeErrs error
+		if formatPrefix(r.GetKey().GetIpPrefix()) == "" {
+			routeErrs = errors.Join(routeErrs, fmt.Errorf("%w: prefix is not set or invalid", ErrInvalidIpAddr))
+		}
+		ni := r.GetKey().GetNetInstName()
+		if ni == "" {
+			routeErrs = errors.Join(routeErrs, fmt.Errorf("%w: name cannot be empty", ErrInvalidNetInstName))
+		} else if err := a.checkNetworkInstance(ni); err != nil {
+			routeErrs = errors.Join(routeErrs, err)
+		}
+		nhg := r.GetData().GetNexthopGroupName()
+		if err := validateNhgName(nhg); err != nil {
+			routeErrs = errors.Join(routeErrs, err)
+		} else if _, ok := a.nhgs.get(nhgKey(ni, nhg)); !ok {
+			a.logger.Warn().
+				Msgf("Route %d uses nexthop group %s not programmed by the agent in network instance %s", i, nhg, ni)
+		}
+
+		if routeErrs != nil {
+			errs = errors.Join(errs, fmt.Errorf("route %d %s: %w", i, routeKey(ni, r.GetKey().GetIpPrefix()), routeErrs))
+		}
+	}
+	return errs
+}
+
 // parseIP takes an IPv4/IPv6 prefix, then splits it by address and prefix length.
 func parseIP(ip string) (address *ndk.IpAddressPb, preflen uint32) {
 	var l int
@@ -0,0 +1,1087 @@
+package bond
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeRouteService is a fake NDK SdkMgrRouteServiceClient
+// which records requests and responds with success.
+type fakeRouteService struct {
+	ndk.SdkMgrRouteServiceClient
+
+	addReqs    []*ndk.RouteAddRequest
+	deleteReqs []*ndk.RouteDeleteRequest
+	syncStarts int
+	syncEnds   int
+	// calls records RPC names in order if set.
+	calls *[]string
+	// failAddCall makes the n-th RouteAddOrUpdate call fail if set.
+	failAddCall int
+}
+
+func (f *fakeRouteService) RouteAddOrUpdate(_ context.Context, req *ndk.RouteAddRequest, _ ...grpc.CallOption) (*ndk.RouteAddResponse, error) {
+	f.addReqs = append(f.addReqs, req)
+	if f.calls != nil {
+		*f.calls = append(*f.calls, "RouteAddOrUpdate")
+	}
+	if len(f.addReqs) == f.failAddCall {
+		return &ndk.RouteAddResponse{Status: ndk.SdkMgrStatus_kSdkMgrFailed}, nil
+	}
+	return &ndk.RouteAddResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeRouteService) RouteDelete(_ context.Context, req *ndk.RouteDeleteRequest, _ ...grpc.CallOption) (*ndk.RouteDeleteResponse, error) {
+	f.deleteReqs = append(f.deleteReqs, req)
+	if f.calls != nil {
+		*f.calls = append(*f.calls, "RouteDelete")
+	}
+	return &ndk.RouteDeleteResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeRouteService) SyncStart(_ context.Context, _ *ndk.SyncRequest, _ ...grpc.CallOption) (*ndk.SyncResponse, error) {
+	f.syncStarts++
+	if f.calls != nil {
+		*f.calls = append(*f.calls, "SyncStart")
+	}
+	return &ndk.SyncResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeRouteService) SyncEnd(_ context.Context, _ *ndk.SyncRequest, _ ...grpc.CallOption) (*ndk.SyncResponse, error) {
+	f.syncEnds++
+	if f.calls != nil {
+		*f.calls = append(*f.calls, "SyncEnd")
+	}
+	return &ndk.SyncResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func TestRouteUpdateWithPreference(t *testing.T) {
+	a := newTestAgent(t)
+	routeService := &fakeRouteService{}
+	a.stubs = &stubs{routeService: routeService}
+
+	unset := NewRoute(WithNetInstName("default"), WithIpPrefix("192.168.1.0/24"),
+		WithNextHopGroupName("ndk_sdk"))
+	set := NewRoute(WithNetInstName("default"), WithIpPrefix("192.168.2.0/24"),
+		WithNextHopGroupName("ndk_sdk"), WithPreference(5))
+
+	err := a.RouteUpdateWithPreference(10, unset, set)
+	if err != nil {
+		t.Fatalf("RouteUpdateWithPreference() returned error: %v", err)
+	}
+
+	if routeService.syncStarts != 1 || routeService.syncEnds != 1 {
+		t.Errorf("sync started %d and ended %d times, want 1 and 1",
+			routeService.syncStarts, routeService.syncEnds)
+	}
+	if len(routeService.addReqs) != 1 {
+		t.Fatalf("RouteAddOrUpdate RPC called %d times, want 1", len(routeService.addReqs))
+	}
+	routes := routeService.addReqs[0].GetRoutes()
+	if len(routes) != 2 {
+		t.Fatalf("add request has %d routes, want 2", len(routes))
+	}
+	for i, want := range []uint32{10, 5} {
+		if got := routes[i].GetData().GetPreference(); got != want {
+			t.Errorf("route[%d] preference = %d, want %d", i, got, want)
+		}
+	}
+	if got := unset.GetData().GetPreference(); got != 0 {
+		t.Errorf("passed route preference modified to %d", got)
+	}
+}
+
+func TestRouteUpdateKeepsOtherOwners(t *testing.T) {
+	a := newTestAgent(t, WithAppID(5))
+	var calls []string
+	routeService := &fakeRouteService{calls: &calls}
+	a.stubs = &stubs{routeService: routeService}
+
+	if err := a.RouteAdd(NewRoute(WithNetInstName("default"), WithIpPrefix("10.1.0.0/24"),
+		WithNextHopGroupName("ndk_sdk"))); err != nil {
+		t.Fatalf("RouteAdd() returned error: %v", err)
+	}
+	if err := a.RouteUpdate(NewRoute(WithNetInstName("default"), WithIpPrefix("10.2.0.0/24"),
+		WithNextHopGroupName("ndk_sdk"))); err != nil {
+		t.Fatalf("RouteUpdate() returned error: %v", err)
+	}
+
+	// routes are only removed by NDK at sync end, which is scoped to the agent's routes,
+	// RouteUpdate never deletes routes, so routes of other owners are kept
+	wantCalls := []string{"RouteAddOrUpdate", "SyncStart", "RouteAddOrUpdate", "SyncEnd"}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("RPC calls = %v, want %v", calls, wantCalls)
+	}
+	routes := routeService.addReqs[1].GetRoutes()
+	if len(routes) != 1 {
+		t.Fatalf("sync add request has %d routes, want 1", len(routes))
+	}
+	key := routes[0].GetKey()
+	if key.GetNetInstName() != "default" || formatPrefix(key.GetIpPrefix()) != "10.2.0.0/24" {
+		t.Errorf("sync add request route = %v, want default 10.2.0.0/24", key)
+	}
+	if owner := routes[0].GetData().GetOwnerId(); owner != 0 && owner != 5 {
+		t.Errorf("sync add request route owner = %d, want agent", owner)
+	}
+}
+
+func TestRouteUpdateRejectsOtherOwners(t *testing.T) {
+	a := newTestAgent(t, WithAppID(5))
+	var calls []string
+	a.stubs = &stubs{routeService: &fakeRouteService{calls: &calls}}
+
+	foreign := NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.0.0/24"),
+		WithNextHopGroupName("ndk_sdk"))
+	foreign.Data.OwnerId = 99
+
+	err := a.RouteUpdate(foreign)
+	if !errors.Is(err, ErrRouteNotOwned) {
+		t.Fatalf("RouteUpdate() error = %v, want %v", err, ErrRouteNotOwned)
+	}
+	// the sync is not started, so no route is removed at sync end
+	if len(calls) != 0 {
+		t.Errorf("RPC calls = %v, want none", calls)
+	}
+}
+
+func TestDiffRoutes(t *testing.T) {
+	route := func(ni, prefix string, opts ...RouteOption) *ndk.RouteInfo {
+		opts = append([]RouteOption{WithNetInstName(ni), WithIpPrefix(prefix),
+			WithNextHopGroupName("ndk_sdk")}, opts...)
+		return NewRoute(opts...)
+	}
+	notified := route("default", "10.0.0.0/24")
+	notified.Data.OwnerId = 5
+	notified.Data.NhgId = 1234
+	notified.Data.Nexthop = []*ndk.NextHop{ipNextHop("192.168.1.1")}
+
+	tests := map[string]struct {
+		desired    []*ndk.RouteInfo
+		current    []*ndk.RouteInfo
+		wantAdd    []string
+		wantDelete []string
+	}{
+		"Adds": {
+			desired: []*ndk.RouteInfo{route("default", "10.0.0.0/24"), route("default", "10.1.0.0/24")},
+			current: []*ndk.RouteInfo{route("default", "10.0.0.0/24")},
+			wantAdd: []string{"default/10.1.0.0/24"},
+		},
+		"Deletes": {
+			desired:    []*ndk.RouteInfo{route("default", "10.0.0.0/24")},
+			current:    []*ndk.RouteInfo{route("default", "10.0.0.0/24"), route("mgmt", "10.0.0.0/24")},
+			wantDelete: []string{"mgmt/10.0.0.0/24"},
+		},
+		"Attribute only changes": {
+			desired: []*ndk.RouteInfo{
+				route("default", "10.0.0.0/24", WithMetric(10)),
+				route("default", "10.1.0.0/24", WithPreference(5)),
+				route("default", "10.2.0.0/24", WithNextHopGroupName("other_sdk")),
+			},
+			current: []*ndk.RouteInfo{
+				route("default", "10.0.0.0/24"),
+				route("default", "10.1.0.0/24"),
+				route("default", "10.2.0.0/24"),
+			},
+			wantAdd: []string{"default/10.0.0.0/24", "default/10.1.0.0/24", "default/10.2.0.0/24"},
+		},
+		"Notification only data is ignored": {
+			desired: []*ndk.RouteInfo{route("default", "10.0.0.0/24")},
+			current: []*ndk.RouteInfo{notified},
+		},
+		"Adds and deletes": {
+			desired:    []*ndk.RouteInfo{route("default", "2001:db8::/64"), route("default", "10.0.0.0/24")},
+			current:    []*ndk.RouteInfo{route("default", "10.0.0.0/24", WithMetric(1)), route("default", "10.9.0.0/24")},
+			wantAdd:    []string{"default/2001:db8::/64", "default/10.0.0.0/24"},
+			wantDelete: []string{"default/10.9.0.0/24"},
+		},
+	}
+
+	keys := func(routes []*ndk.RouteInfo) []string {
+		var ks []string
+		for _, r := range routes {
+			ks = append(ks, routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix()))
+		}
+		return ks
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			toAdd, toDelete := DiffRoutes(tc.desired, tc.current)
+			if got := keys(toAdd); !reflect.DeepEqual(got, tc.wantAdd) {
+				t.Errorf("DiffRoutes() toAdd = %v, want %v", got, tc.wantAdd)
+			}
+			if got := keys(toDelete); !reflect.DeepEqual(got, tc.wantDelete) {
+				t.Errorf("DiffRoutes() toDelete = %v, want %v", got, tc.wantDelete)
+			}
+		})
+	}
+}
+
+func TestNewDefaultRoute(t *testing.T) {
+	tests := map[string]struct {
+		route    *ndk.RouteInfo
+		wantAddr []byte
+	}{
+		"IPv4": {
+			route:    NewDefaultRoute("default", "ndk_sdk"),
+			wantAddr: make([]byte, 4),
+		},
+		"IPv6": {
+			route:    NewDefaultIPv6Route("default", "ndk_sdk"),
+			wantAddr: make([]byte, 16),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			prefix := tc.route.GetKey().GetIpPrefix()
+			if !bytes.Equal(prefix.GetIpAddr().GetAddr(), tc.wantAddr) {
+				t.Errorf("prefix address = %v, want %v", prefix.GetIpAddr().GetAddr(), tc.wantAddr)
+			}
+			if prefix.GetPrefixLength() != 0 {
+				t.Errorf("prefix length = %d, want 0", prefix.GetPrefixLength())
+			}
+			if got := tc.route.GetKey().GetNetInstName(); got != "default" {
+				t.Errorf("network instance = %s, want default", got)
+			}
+			if got := tc.route.GetData().GetNexthopGroupName(); got != "ndk_sdk" {
+				t.Errorf("nexthop group = %s, want ndk_sdk", got)
+			}
+		})
+	}
+}
+
+func TestRouteDeletePrefixes(t *testing.T) {
+	tests := map[string]struct {
+		prefix  string
+		wantErr error
+	}{
+		"IPv4 default route": {prefix: "0.0.0.0/0"},
+		"IPv6 default route": {prefix: "::/0"},
+		"IPv4 prefix":        {prefix: "192.168.11.0/24"},
+		"Missing length":     {prefix: "192.168.11.0", wantErr: ErrInvalidIpAddr},
+		"Invalid address":    {prefix: "192.168.11/24", wantErr: ErrInvalidIpAddr},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			routeService := &fakeRouteService{}
+			a.stubs = &stubs{routeService: routeService}
+
+			err := a.RouteDelete("default", tc.prefix)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("RouteDelete() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && len(routeService.deleteReqs) != 1 {
+				t.Errorf("RouteDelete RPC called %d times, want 1", len(routeService.deleteReqs))
+			}
+		})
+	}
+}
+
+func TestRouteDeleteInvalidPrefixes(t *testing.T) {
+	a := newTestAgent(t)
+	routeService := &fakeRouteService{}
+	a.stubs = &stubs{routeService: routeService}
+
+	err := a.RouteDelete("default", "192.168.11.0", "10.0.0.0/24", "192.168.11/24", "10.0.0.0/33")
+	if !errors.Is(err, ErrInvalidIpAddr) {
+		t.Fatalf("RouteDelete() error = %v, want %v", err, ErrInvalidIpAddr)
+	}
+	for _, prefix := range []string{`"192.168.11.0"`, `"192.168.11/24"`, `"10.0.0.0/33"`} {
+		if !strings.Contains(err.Error(), prefix) {
+			t.Errorf("RouteDelete() error = %v, want invalid prefix %s reported", err, prefix)
+		}
+	}
+	if strings.Contains(err.Error(), `"10.0.0.0/24"`) {
+		t.Errorf("RouteDelete() error = %v, want valid prefix not reported", err)
+	}
+	if len(routeService.deleteReqs) != 0 {
+		t.Errorf("RouteDelete RPC called %d times, want 0", len(routeService.deleteReqs))
+	}
+}
+
+func TestAddRouteWithNextHops(t *testing.T) {
+	nexthops := []NextHopSpec{
+		{Address: "192.168.1.1", ResolveTo: ndk.NextHop_DIRECT, Type: ndk.NextHop_REGULAR},
+		{Address: "192.168.1.2", Labels: []uint32{100}, ResolveTo: ndk.NextHop_INDIRECT, Type: ndk.NextHop_REGULAR},
+	}
+
+	tests := map[string]struct {
+		prefix    string
+		nexthops  []NextHopSpec
+		nhgFailed bool
+		wantErr   error
+		wantCalls []string
+	}{
+		"Route and nexthop group": {
+			prefix:    "10.0.0.0/24",
+			nexthops:  nexthops,
+			wantCalls: []string{"NextHopGroupAddOrUpdate", "RouteAddOrUpdate"},
+		},
+		"IPv6 route": {
+			prefix:    "2001:db8::/64",
+			nexthops:  nexthops,
+			wantCalls: []string{"NextHopGroupAddOrUpdate", "RouteAddOrUpdate"},
+		},
+		"Nexthop group failure": {
+			prefix:    "10.0.0.0/24",
+			nexthops:  nexthops,
+			nhgFailed: true,
+			wantErr:   ErrNhgAddOrUpdateFailed,
+			wantCalls: []string{"NextHopGroupAddOrUpdate"},
+		},
+		"Invalid nexthop": {
+			prefix:   "10.0.0.0/24",
+			nexthops: []NextHopSpec{{Address: "192.168.1.1/32"}},
+			wantErr:  ErrInvalidIpAddr,
+		},
+		"Invalid prefix": {
+			prefix:   "10.0.0.0",
+			nexthops: nexthops,
+			wantErr:  ErrInvalidIpAddr,
+		},
+		"Non-numeric prefix length": {
+			prefix:   "10.0.0.0/abc",
+			nexthops: nexthops,
+			wantErr:  ErrInvalidIpAddr,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			var calls []string
+			nhgService := &fakeNhgService{addFailed: tc.nhgFailed, calls: &calls}
+			routeService := &fakeRouteService{calls: &calls}
+			a.stubs = &stubs{nextHopGroupService: nhgService, routeService: routeService}
+
+			err := a.AddRouteWithNextHops("default", tc.prefix, tc.nexthops)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("AddRouteWithNextHops() error = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(calls, tc.wantCalls) {
+				t.Errorf("RPC calls = %v, want %v", calls, tc.wantCalls)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+
+			nhg := nhgService.addReqs[0].GetGroupInfo()[0]
+			if nhg.GetKey().GetNetworkInstanceName() != "default" {
+				t.Errorf("nexthop group network instance = %s, want default", nhg.GetKey().GetNetworkInstanceName())
+			}
+			if err := validateNhgName(nhg.GetKey().GetName()); err != nil {
+				t.Errorf("generated nexthop group name is invalid: %v", err)
+			}
+			if got := len(nhg.GetData().GetNextHop()); got != len(tc.nexthops) {
+				t.Errorf("nexthop group has %d nexthops, want %d", got, len(tc.nexthops))
+			}
+			if nhg.GetData().GetNextHop()[1].GetMplsNexthop() == nil {
+				t.Errorf("nexthop with labels is not an MPLS nexthop")
+			}
+
+			route := routeService.addReqs[0].GetRoutes()[0]
+			if route.GetData().GetNexthopGroupName() != nhg.GetKey().GetName() {
+				t.Errorf("route nexthop group = %s, want %s",
+					route.GetData().GetNexthopGroupName(), nhg.GetKey().GetName())
+			}
+			if got := formatPrefix(route.GetKey().GetIpPrefix()); got != tc.prefix {
+				t.Errorf("route prefix = %s, want %s", got, tc.prefix)
+			}
+		})
+	}
+}
+
+func TestRouteNhgName(t *testing.T) {
+	tests := map[string]struct {
+		prefix string
+		want   string
+	}{
+		"IPv4 prefix": {
+			prefix: "10.0.0.0/24",
+			want:   "10.0.0.0/24_sdk",
+		},
+		"IPv4 prefix with host bits": {
+			prefix: "10.0.0.1/24",
+			want:   "10.0.0.0/24_sdk",
+		},
+		"IPv6 prefix": {
+			prefix: "2001:DB8:0::1/64",
+			want:   "2001:db8::/64_sdk",
+		},
+		"Default route": {
+			prefix: "0.0.0.0/0",
+			want:   "0.0.0.0/0_sdk",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := parsePrefix(tc.prefix)
+			if err != nil {
+				t.Fatalf("parsePrefix(%s) error = %v", tc.prefix, err)
+			}
+			if got := routeNhgName(p); got != tc.want {
+				t.Errorf("routeNhgName(%s) = %s, want %s", tc.prefix, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeleteRouteWithNextHops(t *testing.T) {
+	nexthops := []NextHopSpec{
+		{Address: "192.168.1.1", ResolveTo: ndk.NextHop_DIRECT, Type: ndk.NextHop_REGULAR},
+	}
+
+	tests := map[string]struct {
+		// sharedPrefix, if set, is another route using the nexthop group of the deleted route
+		sharedPrefix string
+		// userNhg, if set, is a nexthop group the deleted route is pointed to with RouteAdd
+		userNhg    string
+		wantNhgDel []string
+	}{
+		"Route and nexthop group": {
+			wantNhgDel: []string{"10.0.0.0/24_sdk"},
+		},
+		"Shared nexthop group": {
+			sharedPrefix: "10.0.1.0/24",
+		},
+		"Route pointed to user nexthop group": {
+			userNhg:    "user_sdk",
+			wantNhgDel: []string{"10.0.0.0/24_sdk"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			nhgService := &fakeNhgService{}
+			routeService := &fakeRouteService{}
+			a.stubs = &stubs{nextHopGroupService: nhgService, routeService: routeService}
+
+			if err := a.AddRouteWithNextHops("default", "10.0.0.0/24", nexthops); err != nil {
+				t.Fatalf("AddRouteWithNextHops() error = %v", err)
+			}
+			if tc.sharedPrefix != "" {
+				err := a.RouteAdd(NewRoute(
+					WithNetInstName("default"),
+					WithIpPrefix(tc.sharedPrefix),
+					WithNextHopGroupName("10.0.0.0/24_sdk"),
+				))
+				if err != nil {
+					t.Fatalf("RouteAdd() error = %v", err)
+				}
+			}
+			if tc.userNhg != "" {
+				err := a.RouteAdd(NewRoute(
+					WithNetInstName("default"),
+					WithIpPrefix("10.0.0.0/24"),
+					WithNextHopGroupName(tc.userNhg),
+				))
+				if err != nil {
+					t.Fatalf("RouteAdd() error = %v", err)
+				}
+			}
+
+			if err := a.DeleteRouteWithNextHops("default", "10.0.0.0/24"); err != nil {
+				t.Fatalf("DeleteRouteWithNextHops() error = %v", err)
+			}
+
+			if len(routeService.deleteReqs) != 1 {
+				t.Fatalf("got %d route delete requests, want 1", len(routeService.deleteReqs))
+			}
+			if got := formatPrefix(routeService.deleteReqs[0].GetRoutes()[0].GetIpPrefix()); got != "10.0.0.0/24" {
+				t.Errorf("deleted route = %s, want 10.0.0.0/24", got)
+			}
+
+			var nhgDel []string
+			for _, req := range nhgService.deleteReqs {
+				for _, key := range req.GetGroupKey() {
+					nhgDel = append(nhgDel, key.GetName())
+				}
+			}
+			if !reflect.DeepEqual(nhgDel, tc.wantNhgDel) {
+				t.Errorf("deleted nexthop groups = %v, want %v", nhgDel, tc.wantNhgDel)
+			}
+
+			_, ok := a.NextHopGroupSnapshot()[nhgKey("default", "10.0.0.0/24_sdk")]
+			if want := tc.sharedPrefix != ""; ok != want {
+				t.Errorf("nexthop group programmed = %t, want %t", ok, want)
+			}
+		})
+	}
+}
+
+func TestRoutesFromPrefixes(t *testing.T) {
+	tests := map[string]struct {
+		prefixes    []string
+		wantErr     error
+		wantInvalid []string // invalid prefixes named in the error
+	}{
+		"Valid prefixes": {
+			prefixes: []string{"10.0.0.0/24", "10.0.1.0/24", "2001:db8::/64"},
+		},
+		"No prefixes": {
+			prefixes: []string{},
+		},
+		"Invalid prefixes": {
+			prefixes:    []string{"10.0.0.0/24", "10.0.1.0", "invalid/24", "2001:db8::/64"},
+			wantErr:     ErrInvalidIpAddr,
+			wantInvalid: []string{"10.0.1.0", "invalid/24"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			routes, err := RoutesFromPrefixes("default", "ndk_sdk", tc.prefixes)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("RoutesFromPrefixes() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				for _, p := range tc.wantInvalid {
+					if !strings.Contains(err.Error(), strconv.Quote(p)) {
+						t.Errorf("RoutesFromPrefixes() error %q does not name prefix %s", err, p)
+					}
+				}
+				if routes != nil {
+					t.Errorf("RoutesFromPrefixes() returned %d routes with error, want none", len(routes))
+				}
+				return
+			}
+
+			if len(routes) != len(tc.prefixes) {
+				t.Fatalf("RoutesFromPrefixes() returned %d routes, want %d", len(routes), len(tc.prefixes))
+			}
+			for i, r := range routes {
+				if got := formatPrefix(r.GetKey().GetIpPrefix()); got != tc.prefixes[i] {
+					t.Errorf("route %d prefix = %s, want %s", i, got, tc.prefixes[i])
+				}
+				if r.GetKey().GetNetInstName() != "default" {
+					t.Errorf("route %d network instance = %s, want default", i, r.GetKey().GetNetInstName())
+				}
+				if r.GetData().GetNexthopGroupName() != "ndk_sdk" {
+					t.Errorf("route %d nexthop group = %s, want ndk_sdk", i, r.GetData().GetNexthopGroupName())
+				}
+			}
+		})
+	}
+}
+
+func TestRefreshRoute(t *testing.T) {
+	tests := map[string]struct {
+		networkInstance string
+		prefix          string
+		wantErr         error
+	}{
+		"Programmed route": {
+			networkInstance: "default",
+			prefix:          "10.0.0.0/24",
+		},
+		"Route in other network instance": {
+			networkInstance: "mgmt",
+			prefix:          "10.0.0.0/24",
+			wantErr:         ErrRouteNotProgrammed,
+		},
+		"Unknown route": {
+			networkInstance: "default",
+			prefix:          "10.0.1.0/24",
+			wantErr:         ErrRouteNotProgrammed,
+		},
+		"Invalid prefix": {
+			networkInstance: "default",
+			prefix:          "10.0.0.0",
+			wantErr:         ErrInvalidIpAddr,
+		},
+		"Non-numeric prefix length": {
+			networkInstance: "default",
+			prefix:          "10.0.0.0/abc",
+			wantErr:         ErrInvalidIpAddr,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			routeService := &fakeRouteService{}
+			a.stubs = &stubs{routeService: routeService}
+			route := NewRoute(
+				WithNetInstName("default"),
+				WithIpPrefix("10.0.0.0/24"),
+				WithNextHopGroupName("ndk_sdk"),
+				WithPreference(10),
+			)
+			if err := a.RouteAdd(route); err != nil {
+				t.Fatalf("RouteAdd() error = %v", err)
+			}
+
+			err := a.RefreshRoute(tc.networkInstance, tc.prefix)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("RefreshRoute() error = %v, want %v", err, tc.wantErr)
+			}
+
+			wantAdds := 2
+			if tc.wantErr != nil {
+				wantAdds = 1
+			}
+			if len(routeService.addReqs) != wantAdds {
+				t.Fatalf("got %d route add requests, want %d", len(routeService.addReqs), wantAdds)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			got := routeService.addReqs[1].GetRoutes()
+			if len(got) != 1 || !proto.Equal(got[0], route) {
+				t.Errorf("re-added routes = %v, want %v", got, route)
+			}
+		})
+	}
+}
+
+func TestRouteExists(t *testing.T) {
+	a := newTestAgent(t)
+	a.stubs = &stubs{routeService: &fakeRouteService{}}
+	err := a.RouteAdd(
+		NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.0.0/24"), WithNextHopGroupName("ndk_sdk")),
+		NewRoute(WithNetInstName("default"), WithIpPrefix("2001:db8::/64"), WithNextHopGroupName("ndk_sdk")),
+		NewDefaultRoute("default", "ndk_sdk"),
+	)
+	if err != nil {
+		t.Fatalf("RouteAdd() returned error: %v", err)
+	}
+	if err := a.RouteDelete("default", "10.0.0.0/24"); err != nil {
+		t.Fatalf("RouteDelete() returned error: %v", err)
+	}
+	if err := a.RouteAdd(NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.1.0/24"),
+		WithNextHopGroupName("ndk_sdk"))); err != nil {
+		t.Fatalf("RouteAdd() returned error: %v", err)
+	}
+
+	tests := map[string]struct {
+		networkInstance string
+		prefix          string
+		want            bool
+	}{
+		"IPv4 route":                      {networkInstance: "default", prefix: "10.0.1.0/24", want: true},
+		"IPv6 route":                      {networkInstance: "default", prefix: "2001:db8::/64", want: true},
+		"IPv6 route in expanded notation": {networkInstance: "default", prefix: "2001:db8:0:0::/64", want: true},
+		"Deleted route":                   {networkInstance: "default", prefix: "10.0.0.0/24"},
+		"Other prefix length":             {networkInstance: "default", prefix: "2001:db8::/48"},
+		"Other network instance":          {networkInstance: "mgmt", prefix: "10.0.1.0/24"},
+		"Invalid prefix":                  {networkInstance: "default", prefix: "10.0.1.0"},
+		"Default route":                   {networkInstance: "default", prefix: "0.0.0.0/0", want: true},
+		"Non-numeric prefix length":       {networkInstance: "default", prefix: "0.0.0.0/abc"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := a.RouteExists(tc.networkInstance, tc.prefix); got != tc.want {
+				t.Errorf("RouteExists(%s, %s) = %t, want %t", tc.networkInstance, tc.prefix, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRouteAddInvalidPrefix(t *testing.T) {
+	tests := map[string]struct {
+		prefixes    []string
+		wantInvalid []int
+	}{
+		"Malformed IPv4": {
+			prefixes:    []string{"192.168.1.x/24"},
+			wantInvalid: []int{0},
+		},
+		"Malformed IPv6": {
+			prefixes:    []string{"2001:db8::zz/64"},
+			wantInvalid: []int{0},
+		},
+		"Missing prefix length": {
+			prefixes:    []string{"10.0.0.0"},
+			wantInvalid: []int{0},
+		},
+		"Non-numeric prefix length": {
+			prefixes:    []string{"10.0.0.0/abc"},
+			wantInvalid: []int{0},
+		},
+		"Prefix length out of range": {
+			prefixes:    []string{"10.0.0.0/33", "2001:db8::/129"},
+			wantInvalid: []int{0, 1},
+		},
+		"Mixed batch": {
+			prefixes:    []string{"10.0.0.0/24", "10.0.1.x/24", "2001:db8::/64", "2001:db8::1"},
+			wantInvalid: []int{1, 3},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for method, add := range map[string]func(a *Agent, routes ...*ndk.RouteInfo) error{
+				"RouteAdd":    (*Agent).RouteAdd,
+				"RouteUpdate": (*Agent).RouteUpdate,
+			} {
+				a := newTestAgent(t)
+				routeService := &fakeRouteService{}
+				a.stubs = &stubs{routeService: routeService}
+				var routes []*ndk.RouteInfo
+				for _, p := range tc.prefixes {
+					routes = append(routes, NewRoute(WithNetInstName("default"), WithIpPrefix(p),
+						WithNextHopGroupName("ndk_sdk")))
+				}
+
+				err := add(a, routes...)
+				if !errors.Is(err, ErrInvalidIpAddr) {
+					t.Fatalf("%s() error = %v, want %v", method, err, ErrInvalidIpAddr)
+				}
+				for _, i := range tc.wantInvalid {
+					if !strings.Contains(err.Error(), fmt.Sprintf("route %d ", i)) {
+						t.Errorf("%s() error %q does not name route %d", method, err, i)
+					}
+					if p := formatPrefix(routes[i].GetKey().GetIpPrefix()); p != "" {
+						t.Errorf("invalid prefix %s set to %s", tc.prefixes[i], p)
+					}
+				}
+				if len(routeService.addReqs) != 0 || routeService.syncStarts != 0 {
+					t.Errorf("%s() sent %d add requests and %d sync starts, want none",
+						method, len(routeService.addReqs), routeService.syncStarts)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteAddInvalidRetry(t *testing.T) {
+	a := newTestAgent(t)
+	routeService := &fakeRouteService{}
+	a.stubs = &stubs{routeService: routeService}
+
+	r := NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.0.0/abc"), WithNextHopGroupName("ndk_sdk"))
+	for i := 0; i < 2; i++ {
+		if err := a.RouteAdd(r); !errors.Is(err, ErrInvalidIpAddr) {
+			t.Errorf("RouteAdd() call %d = %v, want %v", i, err, ErrInvalidIpAddr)
+		}
+	}
+	if err := a.RouteUpdate(r); !errors.Is(err, ErrInvalidIpAddr) {
+		t.Errorf("RouteUpdate() = %v, want %v", err, ErrInvalidIpAddr)
+	}
+	if len(routeService.addReqs) != 0 {
+		t.Errorf("RouteAddOrUpdate RPC called for invalid route")
+	}
+}
+
+func TestWithIpPrefixOnSliceElement(t *testing.T) {
+	a := newTestAgent(t)
+	routeService := &fakeRouteService{}
+	a.stubs = &stubs{routeService: routeService}
+
+	// options applied to routes not at the beginning of an allocation
+	routes := make([]ndk.RouteInfo, 2)
+	for i := range routes {
+		routes[i].Key = &ndk.RouteKeyPb{NetInstName: "default"}
+		routes[i].Data = &ndk.RoutePb{NexthopGroupName: "ndk_sdk"}
+	}
+	WithIpPrefix("10.0.0.0/24")(&routes[1])
+	WithIpPrefix("10.0.0.x/24")(&routes[1])
+
+	if err := a.RouteAdd(&routes[1]); !errors.Is(err, ErrInvalidIpAddr) {
+		t.Errorf("RouteAdd() = %v, want %v", err, ErrInvalidIpAddr)
+	}
+	// routes without a preference are cloned
+	if err := a.RouteUpdateWithPreference(10, &routes[1]); !errors.Is(err, ErrInvalidIpAddr) {
+		t.Errorf("RouteUpdateWithPreference() = %v, want %v", err, ErrInvalidIpAddr)
+	}
+	if len(routeService.addReqs) != 0 {
+		t.Errorf("RouteAddOrUpdate RPC called for invalid route")
+	}
+}
+
+func TestWithIpPrefixValid(t *testing.T) {
+	a := newTestAgent(t)
+	routeService := &fakeRouteService{}
+	a.stubs = &stubs{routeService: routeService}
+
+	r := NewRoute(WithNetInstName("default"), WithIpPrefix("2001:db8::/64"), WithNextHopGroupName("ndk_sdk"))
+	if err := a.RouteAdd(r); err != nil {
+		t.Fatalf("RouteAdd() returned error: %v", err)
+	}
+	if got := formatPrefix(r.GetKey().GetIpPrefix()); got != "2001:db8::/64" {
+		t.Errorf("route prefix = %s, want 2001:db8::/64", got)
+	}
+}
+
+func TestRouteAddValidatesBatch(t *testing.T) {
+	a := newTestAgent(t)
+	routeService := &fakeRouteService{}
+	a.stubs = &stubs{routeService: routeService}
+
+	routes := []*ndk.RouteInfo{
+		NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.0.0/24"), WithNextHopGroupName("ndk_sdk")),
+		NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.1.x/24"), WithNextHopGroupName("ndk_sdk")),
+		NewRoute(WithIpPrefix("10.0.2.0/24"), WithNextHopGroupName("ndk_sdk")),
+		NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.3.0/24"), WithNextHopGroupName("ndk")),
+		NewRoute(WithNetInstName("default"), WithNextHopGroupName("ndk_sdk")),
+		NewRoute(WithIpPrefix("2001:db8::/64")),
+	}
+
+	err := a.RouteAdd(routes...)
+	if err == nil {
+		t.Fatal("RouteAdd() returned no error")
+	}
+	for _, want := range []error{ErrInvalidIpAddr, ErrInvalidNetInstName, ErrInvalidNhgName} {
+		if !errors.Is(err, want) {
+			t.Errorf("RouteAdd() error = %v, want %v", err, want)
+		}
+	}
+	for _, want := range []string{
+		"route 1 default/: invalid ip address provided: prefix is not set or invalid",
+		"route 2 /10.0.2.0/24: invalid network instance name",
+		`route 3 default/10.0.3.0/24: invalid nexthop group name: name "ndk" must end with _sdk or _SDK`,
+		"route 4 default/: invalid ip address provided: prefix is not set or invalid",
+		"route 5 /2001:db8::/64: invalid network instance name",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("RouteAdd() error %q does not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "route 0 ") {
+		t.Errorf("RouteAdd() error %q reports valid route 0", err)
+	}
+	if got := strings.Count(err.Error(), "nexthop group name"); got != 2 {
+		t.Errorf("RouteAdd() error %q reports %d invalid nexthop group names, want 2", err, got)
+	}
+	if len(routeService.addReqs) != 0 {
+		t.Errorf("RouteAdd() sent %d requests, want none", len(routeService.addReqs))
+	}
+}
+
+func TestRouteAddUnknownNhgWarning(t *testing.T) {
+	buf := &syncBuffer{}
+	logger := zerolog.New(buf)
+	a := newTestAgent(t, WithLogger(&logger))
+	a.stubs = &stubs{routeService: &fakeRouteService{}, nextHopGroupService: &fakeNhgService{}}
+
+	if err := a.NextHopGroupAdd(NewNextHopGroup(WithNetworkInstanceName("default"), WithName("known_sdk"),
+		WithIpNextHop("192.168.1.1", ndk.NextHop_LOCAL, ndk.NextHop_REGULAR))); err != nil {
+		t.Fatalf("NextHopGroupAdd() returned error: %v", err)
+	}
+
+	// routes using unknown nexthop groups are added with a warning
+	err := a.RouteAdd(
+		NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.0.0/24"), WithNextHopGroupName("known_sdk")),
+		NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.1.0/24"), WithNextHopGroupName("unknown_sdk")),
+	)
+	if err != nil {
+		t.Fatalf("RouteAdd() returned error: %v", err)
+	}
+	if logs := buf.String(); strings.Contains(logs, "group known_sdk") ||
+		!strings.Contains(logs, "group unknown_sdk not programmed") {
+		t.Errorf("logs = %s, want a warning for unknown_sdk only", logs)
+	}
+}
+
+func TestProgrammedRoutes(t *testing.T) {
+	route := func(ni, prefix string) *ndk.RouteInfo {
+		return NewRoute(WithNetInstName(ni), WithIpPrefix(prefix), WithNextHopGroupName("ndk_sdk"))
+	}
+
+	tests := map[string]struct {
+		program func(a *Agent) error
+		want    []string
+	}{
+		"Added routes": {
+			program: func(a *Agent) error {
+				return a.RouteAdd(route("default", "10.0.1.0/24"), route("blue", "10.0.0.0/24"))
+			},
+			want: []string{"blue/10.0.0.0/24", "default/10.0.1.0/24"},
+		},
+		"Deleted route": {
+			program: func(a *Agent) error {
+				if err := a.RouteAdd(route("default", "10.0.0.0/24"), route("default", "10.0.1.0/24")); err != nil {
+					return err
+				}
+				return a.RouteDelete("default", "10.0.0.0/24")
+			},
+			want: []string{"default/10.0.1.0/24"},
+		},
+		"Updated routes replace previous routes": {
+			program: func(a *Agent) error {
+				if err := a.RouteAdd(route("default", "10.0.0.0/24"), route("default", "10.0.1.0/24")); err != nil {
+					return err
+				}
+				return a.RouteUpdate(route("default", "10.0.1.0/24"), route("default", "10.0.2.0/24"))
+			},
+			want: []string{"default/10.0.1.0/24", "default/10.0.2.0/24"},
+		},
+		"No routes": {
+			program: func(a *Agent) error { return nil },
+			want:    []string{},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			a.stubs = &stubs{routeService: &fakeRouteService{}}
+			if err := tt.program(a); err != nil {
+				t.Fatalf("programming routes returned error: %v", err)
+			}
+
+			routes := a.ProgrammedRoutes()
+			got := []string{}
+			for _, r := range routes {
+				got = append(got, routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix()))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProgrammedRoutes() = %v, want %v", got, tt.want)
+			}
+
+			// returned routes are copies
+			for _, r := range routes {
+				r.Data.NexthopGroupName = "changed_sdk"
+			}
+			for _, r := range a.ProgrammedRoutes() {
+				if r.GetData().GetNexthopGroupName() != "ndk_sdk" {
+					t.Errorf("ProgrammedRoutes() returned route that changes the index")
+				}
+			}
+		})
+	}
+}
+
+func TestProgrammedRoutesConcurrentAdd(t *testing.T) {
+	a := newTestAgent(t)
+	a.stubs = &stubs{routeService: &fakeRouteService{}}
+
+	// fakeRouteService is not safe for concurrent use, so RouteAdd calls
+	// are serialized while ProgrammedRoutes reads the index concurrently
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			if err := a.RouteAdd(NewRoute(WithNetInstName("default"),
+				WithIpPrefix(fmt.Sprintf("10.0.%d.0/24", i)), WithNextHopGroupName("ndk_sdk"))); err != nil {
+				t.Errorf("RouteAdd() returned error: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			a.ProgrammedRoutes()
+		}()
+	}
+	wg.Wait()
+
+	if got := len(a.ProgrammedRoutes()); got != 10 {
+		t.Errorf("len(ProgrammedRoutes()) = %d, want 10", got)
+	}
+}
+
+func TestRouteAddChunks(t *testing.T) {
+	tests := map[string]struct {
+		routes    int
+		batchSize int
+		want      []int
+	}{
+		"Single chunk":            {routes: 3, batchSize: 3, want: []int{3}},
+		"Full chunks":             {routes: 6, batchSize: 3, want: []int{3, 3}},
+		"Partial last chunk":      {routes: 7, batchSize: 3, want: []int{3, 3, 1}},
+		"Default batch size":      {routes: 1001, want: []int{1000, 1}},
+		"Chunk of a single route": {routes: 2, batchSize: 1, want: []int{1, 1}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []Option
+			if tt.batchSize != 0 {
+				opts = append(opts, WithRouteBatchSize(tt.batchSize))
+			}
+			a := newTestAgent(t, opts...)
+			routeService := &fakeRouteService{}
+			a.stubs = &stubs{routeService: routeService}
+
+			if err := a.RouteAdd(numberedRoutes(tt.routes)...); err != nil {
+				t.Fatalf("RouteAdd() returned error: %v", err)
+			}
+
+			got := []int{}
+			next := 0
+			for _, req := range routeService.addReqs {
+				got = append(got, len(req.GetRoutes()))
+				// chunks keep the order of routes
+				for _, r := range req.GetRoutes() {
+					if want := numberedPrefix(next); formatPrefix(r.GetKey().GetIpPrefix()) != want {
+						t.Errorf("route %d = %s, want %s", next, formatPrefix(r.GetKey().GetIpPrefix()), want)
+					}
+					next++
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunk sizes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteAddChunkFailure(t *testing.T) {
+	a := newTestAgent(t, WithRouteBatchSize(2))
+	routeService := &fakeRouteService{failAddCall: 2}
+	a.stubs = &stubs{routeService: routeService}
+
+	err := a.RouteAdd(numberedRoutes(5)...)
+	if !errors.Is(err, ErrRouteAddOrUpdateFailed) {
+		t.Fatalf("RouteAdd() error = %v, want %v", err, ErrRouteAddOrUpdateFailed)
+	}
+	if !strings.Contains(err.Error(), "chunk 2 of 3, routes 2 to 3") ||
+		strings.Contains(err.Error(), "chunk 1") || strings.Contains(err.Error(), "chunk 3") {
+		t.Errorf("RouteAdd() error = %v, want only chunk 2 reported", err)
+	}
+	if len(routeService.addReqs) != 3 {
+		t.Errorf("RouteAddOrUpdate RPC called %d times, want 3", len(routeService.addReqs))
+	}
+
+	// routes of chunks 1 and 3 stay programmed
+	for i, want := range []bool{true, true, false, false, true} {
+		if got := a.RouteExists("default", numberedPrefix(i)); got != want {
+			t.Errorf("RouteExists(%s) = %t, want %t", numberedPrefix(i), got, want)
+		}
+	}
+}
+
+func TestWithRouteBatchSizeInvalid(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		if err := WithRouteBatchSize(n)(&Agent{}); err == nil {
+			t.Errorf("WithRouteBatchSize(%d) returned no error", n)
+		}
+	}
+}
+
+// numberedPrefix returns the i-th /32 prefix of 10.0.0.0/16.
+func numberedPrefix(i int) string {
+	return fmt.Sprintf("10.0.%d.%d/32", i/256, i%256)
+}
+
+// numberedRoutes returns n routes in network instance default
+// for the first n prefixes returned by numberedPrefix.
+func numberedRoutes(n int) []*ndk.RouteInfo {
+	routes := make([]*ndk.RouteInfo, 0, n)
+	for i := 0; i < n; i++ {
+		routes = append(routes, NewRoute(WithNetInstName("default"),
+			WithIpPrefix(numberedPrefix(i)), WithNextHopGroupName("ndk_sdk")))
+	}
+	return routes
+}
@@ -1,6 +1,7 @@
 package bond
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -10,15 +11,23 @@ import (
 
 var ErrStateDeleteFailed = errors.New("state delete failed")
 var ErrStateAddOrUpdateFailed = errors.New("state add/update failed")
+var ErrInvalidStateData = errors.New("state data must be a json object")
 
 // DeleteState deletes application's state for a YANG list entry or the root container.
 // It takes in a target path which follows XPath format.
 // Possible YANG path targets are the app's root container (e.g. /greeter) or
 // a YANG list entry (e.g. /greeter/list-node[name=entry1]).
 // All state for child schema nodes will be deleted.
+// State of path or of at least one of its children must have been
+// added with UpdateState.
 // If empty path is provided, the app's root container is assumed by default
 // and the entire application state is deleted.
+// If Agent has option WithStateNamespace set, path is prefixed with the namespace
+// and an empty path deletes all state within the namespace.
+// State of path and its children is deleted with a single NDK request.
 func (a *Agent) DeleteState(path string) error {
+	path = a.statePath(path)
+
 	a.logger.Info().
 		Str("path", path).
 		Msg("Deleting state")
@@ -30,47 +39,64 @@ func (a *Agent) DeleteState(path string) error {
 		deleteAll = true
 	}
 
-	// verify state for path was added previously
-	_, ok := a.paths[path]
-	if !ok {
-		a.logger.Error().
-			Msgf("Trying to delete state for path %s that has never been added.", path)
-		return fmt.Errorf("%w: path: %s", ErrStateDeleteFailed, path)
-	}
-
-	deleteOk := true // indicates whether to delete path
+	// NDK does not guarantee that deleting a key deletes the state of its children,
+	// so keys of path and all its children are deleted with a single request
+	keys := []*ndk.TelemetryKey{}
+	deleted := []string{}
 	for p := range a.paths {
-		if !deleteAll {
-			deleteOk = strings.HasPrefix(p, path) // delete child?
-		}
-		if !deleteOk {
+		if !deleteAll && !isStatePathWithin(p, path) {
 			continue
 		}
+		keys = append(keys, &ndk.TelemetryKey{JsPath: convertXPathToJSPath(p)})
+		deleted = append(deleted, p)
+	}
 
-		jsPath := convertXPathToJSPath(p)
-		key := &ndk.TelemetryKey{JsPath: jsPath}
+	// verify state for path or its children was added previously
+	if len(deleted) == 0 {
+		a.logger.Error().
+			Msgf("Trying to delete state for path %s that has never been added.", path)
+		return fmt.Errorf("%w: path: %s", ErrStateDeleteFailed, path)
+	}
 
-		r, err := a.stubs.telemetryService.TelemetryDelete(a.ctx, &ndk.TelemetryDeleteRequest{
-			Key: []*ndk.TelemetryKey{key},
-		})
-		if err != nil || r.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
-			a.logger.Error().Msgf("Failed to delete state, response: %v", r)
-			return fmt.Errorf("%w: path: %s", ErrStateDeleteFailed, jsPath)
-		}
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
+	r, err := a.stubs.telemetryService.TelemetryDelete(a.ctx, &ndk.TelemetryDeleteRequest{
+		Key: keys,
+	})
+	if err != nil || r.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
+		a.logger.Error().Msgf("Failed to delete state, response: %v", r)
+		return fmt.Errorf("%w: path: %s", ErrStateDeleteFailed, convertXPathToJSPath(path))
+	}
+	for _, p := range deleted {
 		delete(a.paths, p)
-		deleteOk = true
+		a.telemetry.delete(p)
 	}
 	return nil
 }
 
+// isStatePathWithin returns true if state path p is path
+// or a child of path, e.g. /greeter/stats/counters or
+// /greeter/stats[name=a] are within /greeter/stats,
+// while the sibling /greeter/statsx is not.
+func isStatePathWithin(p, path string) bool {
+	return p == path || strings.HasPrefix(p, path+"/") || strings.HasPrefix(p, path+"[")
+}
+
 // UpdateState updates application's state for a YANG list entry or the root container.
 // It takes in a path which follows XPath format.
 // Examples include /greeter, the app's root container or
 // /greeter/list-node[name=entry1], a list entry of `list-node`.
 // data is the target path's json state, which may contain leaf or leaf-list json data.
 // State for paths added with UpdateState may be deleted with DeleteState.
+// Since path targets a container or list entry, data must be a JSON object,
+// e.g. {"count": 1}, an error wrapping ErrInvalidStateData is returned
+// for other JSON values, e.g. a bare scalar, or invalid JSON.
+// If Agent has option WithStateNamespace set, path is prefixed with the namespace.
 func (a *Agent) UpdateState(path, data string) error {
-	var jsPath string
+	path = a.statePath(path)
 
 	a.logger.Info().
 		Str("path", path).
@@ -79,24 +105,81 @@ func (a *Agent) UpdateState(path, data string) error {
 
 	if path == "" {
 		path = a.appRootPath
-		jsPath = strings.ReplaceAll(path, "/", ".")
-	} else {
-		jsPath = convertXPathToJSPath(path)
 	}
 
-	tkey := &ndk.TelemetryKey{JsPath: jsPath}
-	tdata := &ndk.TelemetryData{JsonContent: data}
-	info := &ndk.TelemetryInfo{Key: tkey, Data: tdata}
+	if err := validateStateData(data); err != nil {
+		a.logger.Error().
+			Err(err).
+			Str("path", path).
+			Msg("Invalid state data")
+		return fmt.Errorf("%w: path: %s: %w", ErrInvalidStateData, path, err)
+	}
+
+	info := NewTelemetryInfo(path, data)
+	jsPath := info.GetKey().GetJsPath()
 	req := &ndk.TelemetryUpdateRequest{
 		State: []*ndk.TelemetryInfo{info},
 	}
 
 	a.logger.Info().Msgf("Telemetry Request: %+v", req)
 
+	done, err := a.trackRPC()
+	if err != nil {
+		return err
+	}
+	defer done()
 	r, err := a.stubs.telemetryService.TelemetryAddOrUpdate(a.ctx, req)
 	if err != nil || r.GetStatus() != ndk.SdkMgrStatus_kSdkMgrSuccess {
 		return fmt.Errorf("%w: key: %s, data: %s", ErrStateAddOrUpdateFailed, jsPath, data)
 	}
 	a.paths[path] = struct{}{} // add path to cache
+	a.telemetry.set(path, data)
+	return nil
+}
+
+// statePath returns path prefixed with the state namespace
+// set by WithStateNamespace.
+// path is returned as is if no namespace is set or path is within the namespace,
+// the namespace is returned for an empty path.
+func (a *Agent) statePath(path string) string {
+	ns := a.stateNamespace
+	switch {
+	case ns == "":
+		return path
+	case path == "":
+		return ns
+	case path == ns || strings.HasPrefix(path, ns+"/") || strings.HasPrefix(path, ns+"["):
+		return path
+	case strings.HasPrefix(path, "/"):
+		return ns + path
+	default:
+		return ns + "/" + path
+	}
+}
+
+// NewTelemetryInfo creates a NDK telemetry info
+// updating the state of xpath with json encoded data.
+// xpath follows XPath format and is converted to the NDK JSPath format,
+// e.g. /greeter/list-node[name=entry1] is converted to .greeter.list-node{.name=="entry1"}.
+// Apps batching their own telemetry requests can use it
+// to build the TelemetryInfo of a TelemetryUpdateRequest.
+//
+// Example: NewTelemetryInfo("/greeter", `{"name": "bond"}`)
+func NewTelemetryInfo(xpath, data string) *ndk.TelemetryInfo {
+	return &ndk.TelemetryInfo{
+		Key:  &ndk.TelemetryKey{JsPath: convertXPathToJSPath(xpath)},
+		Data: &ndk.TelemetryData{JsonContent: data},
+	}
+}
+
+// validateStateData checks that data is a JSON object.
+func validateStateData(data string) error {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		return err
+	}
+	if obj == nil { // null
+		return errors.New("null is not an object")
+	}
 	return nil
 }
@@ -0,0 +1,147 @@
+package bond
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrInvalidExportedState is returned when ImportState
+// is called with data that is not an exported Agent state.
+var ErrInvalidExportedState = errors.New("invalid exported agent state")
+
+// exportedState is the JSON representation of the Agent's programmed state.
+// NDK objects are encoded with protojson.
+type exportedState struct {
+	Routes        []json.RawMessage `json:"routes"`
+	NextHopGroups []json.RawMessage `json:"nexthop-groups"`
+	// Telemetry maps XPaths to their json state data.
+	Telemetry map[string]string `json:"telemetry"`
+}
+
+// ExportState returns the routes and nexthop groups programmed by the Agent
+// and the state data updated with UpdateState, encoded as JSON.
+// Apps can persist the exported state and restore it
+// after a restart with ImportState.
+func (a *Agent) ExportState() ([]byte, error) {
+	routes, err := marshalProtos(a.routes.snapshot(cloneProto[*ndk.RouteInfo]))
+	if err != nil {
+		return nil, err
+	}
+	nhgs, err := marshalProtos(a.nhgs.snapshot(cloneProto[*ndk.NextHopGroupInfo]))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(exportedState{
+		Routes:        routes,
+		NextHopGroups: nhgs,
+		Telemetry:     a.telemetry.snapshot(func(s string) string { return s }),
+	})
+}
+
+// ImportState replaces the Agent's programmed routes, nexthop groups
+// and state data with state data exported by ExportState.
+// ImportState does not program SR Linux,
+// imported state is reprogrammed with ReplayState.
+// An error wrapping ErrInvalidExportedState is returned
+// if data cannot be decoded, the Agent's state is unchanged in that case.
+//
+// Example:
+// ImportState(data) followed by ReplayState() reprograms SR Linux
+// after a restart with the state exported before the restart.
+func (a *Agent) ImportState(data []byte) error {
+	var exported exportedState
+	if err := json.Unmarshal(data, &exported); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidExportedState, err)
+	}
+
+	routes := make(map[string]*ndk.RouteInfo, len(exported.Routes))
+	for _, raw := range exported.Routes {
+		r := new(ndk.RouteInfo)
+		if err := protojson.Unmarshal(raw, r); err != nil {
+			return fmt.Errorf("%w: route: %w", ErrInvalidExportedState, err)
+		}
+		routes[routeKey(r.GetKey().GetNetInstName(), r.GetKey().GetIpPrefix())] = r
+	}
+	nhgs := make(map[string]*ndk.NextHopGroupInfo, len(exported.NextHopGroups))
+	for _, raw := range exported.NextHopGroups {
+		nhg := new(ndk.NextHopGroupInfo)
+		if err := protojson.Unmarshal(raw, nhg); err != nil {
+			return fmt.Errorf("%w: nexthop group: %w", ErrInvalidExportedState, err)
+		}
+		nhgs[nhgKey(nhg.GetKey().GetNetworkInstanceName(), nhg.GetKey().GetName())] = nhg
+	}
+	telemetry := make(map[string]string, len(exported.Telemetry))
+	for path, data := range exported.Telemetry {
+		telemetry[path] = data
+	}
+
+	a.routes.replace(routes)
+	a.nhgs.replace(nhgs)
+	a.telemetry.replace(telemetry)
+	for path := range telemetry {
+		a.paths[path] = struct{}{}
+	}
+	return nil
+}
+
+// ReplayState programs the Agent's nexthop groups, routes and state data
+// in SR Linux, e.g. after they were restored with ImportState.
+// Nexthop groups and routes are resynchronized with NextHopGroupUpdate
+// and RouteUpdate, so SR Linux only keeps the replayed ones.
+// Nexthop groups are programmed before the routes resolving to them.
+func (a *Agent) ReplayState() error {
+	nhgs := a.nhgs.snapshot(cloneProto[*ndk.NextHopGroupInfo])
+	if err := a.NextHopGroupUpdate(sortedValues(nhgs)...); err != nil {
+		return err
+	}
+	routes := a.routes.snapshot(cloneProto[*ndk.RouteInfo])
+	if err := a.RouteUpdate(sortedValues(routes)...); err != nil {
+		return err
+	}
+	telemetry := a.telemetry.snapshot(func(s string) string { return s })
+	for _, path := range sortedKeys(telemetry) {
+		if err := a.UpdateState(path, telemetry[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalProtos encodes the messages of items with protojson
+// in the order of their keys.
+func marshalProtos[T proto.Message](items map[string]T) ([]json.RawMessage, error) {
+	msgs := make([]json.RawMessage, 0, len(items))
+	for _, m := range sortedValues(items) {
+		b, err := protojson.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, b)
+	}
+	return msgs, nil
+}
+
+// sortedKeys returns the keys of items in sorted order.
+func sortedKeys[T any](items map[string]T) []string {
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedValues returns the values of items in the order of their keys.
+func sortedValues[T any](items map[string]T) []T {
+	values := make([]T, 0, len(items))
+	for _, k := range sortedKeys(items) {
+		values = append(values, items[k])
+	}
+	return values
+}
@@ -0,0 +1,131 @@
+package bond
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestExportImportState(t *testing.T) {
+	src := newTestAgent(t, WithAppRootPath("/greeter"))
+	src.stubs = &stubs{
+		routeService:        &fakeRouteService{},
+		nextHopGroupService: &fakeNhgService{},
+		telemetryService:    &fakeTelemetryService{},
+	}
+
+	nhg := NewNextHopGroup(WithNetworkInstanceName("default"), WithName("ndk_sdk"),
+		WithIpNextHop("192.168.1.1", ndk.NextHop_LOCAL, ndk.NextHop_REGULAR))
+	routes := []*ndk.RouteInfo{
+		NewRoute(WithNetInstName("default"), WithIpPrefix("192.168.11.0/24"),
+			WithNextHopGroupName("ndk_sdk"), WithMetric(10)),
+		NewRoute(WithNetInstName("default"), WithIpPrefix("2001:db8::/64"),
+			WithNextHopGroupName("ndk_sdk"), WithPreference(5)),
+	}
+	if err := src.NextHopGroupAdd(nhg); err != nil {
+		t.Fatalf("NextHopGroupAdd() returned error: %v", err)
+	}
+	if err := src.RouteAdd(routes...); err != nil {
+		t.Fatalf("RouteAdd() returned error: %v", err)
+	}
+	for path, data := range map[string]string{
+		"/greeter":                        `{"name":"bond"}`,
+		"/greeter/list-node[name=entry1]": `{"count":1}`,
+	} {
+		if err := src.UpdateState(path, data); err != nil {
+			t.Fatalf("UpdateState(%s) returned error: %v", path, err)
+		}
+	}
+
+	exported, err := src.ExportState()
+	if err != nil {
+		t.Fatalf("ExportState() returned error: %v", err)
+	}
+
+	dst := newTestAgent(t, WithAppRootPath("/greeter"))
+	if err := dst.ImportState(exported); err != nil {
+		t.Fatalf("ImportState() returned error: %v", err)
+	}
+
+	if got := dst.NextHopGroupSnapshot(); !equalProtoMaps(got, src.NextHopGroupSnapshot()) {
+		t.Errorf("imported nexthop groups = %v, want %v", got, src.NextHopGroupSnapshot())
+	}
+	gotRoutes := dst.routes.snapshot(cloneProto[*ndk.RouteInfo])
+	if wantRoutes := src.routes.snapshot(cloneProto[*ndk.RouteInfo]); !equalProtoMaps(gotRoutes, wantRoutes) {
+		t.Errorf("imported routes = %v, want %v", gotRoutes, wantRoutes)
+	}
+	if !reflect.DeepEqual(dst.paths, src.paths) {
+		t.Errorf("imported state paths = %v, want %v", dst.paths, src.paths)
+	}
+	reexported, err := dst.ExportState()
+	if err != nil {
+		t.Fatalf("ExportState() of imported state returned error: %v", err)
+	}
+	if !bytes.Equal(reexported, exported) {
+		t.Errorf("re-exported state = %s, want %s", reexported, exported)
+	}
+
+	// replay reprograms imported state
+	routeService := &fakeRouteService{}
+	nhgService := &fakeNhgService{}
+	telemetryService := &fakeTelemetryService{}
+	dst.stubs = &stubs{
+		routeService:        routeService,
+		nextHopGroupService: nhgService,
+		telemetryService:    telemetryService,
+	}
+	if err := dst.ReplayState(); err != nil {
+		t.Fatalf("ReplayState() returned error: %v", err)
+	}
+	if len(nhgService.addReqs) != 1 || nhgService.syncEnds != 1 {
+		t.Errorf("replayed %d nexthop group requests with %d sync ends, want 1 and 1",
+			len(nhgService.addReqs), nhgService.syncEnds)
+	}
+	if len(routeService.addReqs) != 1 || len(routeService.addReqs[0].GetRoutes()) != len(routes) {
+		t.Errorf("replayed route requests = %v, want 1 request with %d routes", routeService.addReqs, len(routes))
+	}
+	wantUpdated := []string{".greeter", `.greeter.list-node{.name=="entry1"}`}
+	if !reflect.DeepEqual(telemetryService.updated, wantUpdated) {
+		t.Errorf("replayed state = %v, want %v", telemetryService.updated, wantUpdated)
+	}
+}
+
+func TestImportStateInvalid(t *testing.T) {
+	tests := map[string]string{
+		"Invalid JSON":  `{"routes":`,
+		"Invalid route": `{"routes":[{"key":"default"}]}`,
+		"Invalid nhg":   `{"nexthop-groups":[{"unknown":1}]}`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t)
+			a.routes.set("default/10.0.0.0/8", NewRoute(WithNetInstName("default"), WithIpPrefix("10.0.0.0/8")))
+
+			if err := a.ImportState([]byte(data)); !errors.Is(err, ErrInvalidExportedState) {
+				t.Errorf("ImportState() error = %v, want %v", err, ErrInvalidExportedState)
+			}
+			if _, ok := a.routes.get("default/10.0.0.0/8"); !ok {
+				t.Errorf("ImportState() changed state on error")
+			}
+		})
+	}
+}
+
+// equalProtoMaps returns true if got and want contain equal messages under the same keys.
+func equalProtoMaps[T proto.Message](got, want map[string]T) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for k, w := range want {
+		g, ok := got[k]
+		if !ok || !proto.Equal(g, w) {
+			return false
+		}
+	}
+	return true
+}
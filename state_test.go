@@ -0,0 +1,288 @@
+package bond
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/nokia/srlinux-ndk-go/ndk"
+	"google.golang.org/grpc"
+)
+
+// fakeTelemetryService is a fake NDK SdkMgrTelemetryServiceClient
+// which records the updated and deleted telemetry keys and responds with success.
+type fakeTelemetryService struct {
+	ndk.SdkMgrTelemetryServiceClient
+
+	updated []string
+	deleted []string
+	// deleteCalls counts TelemetryDelete calls.
+	deleteCalls int
+}
+
+func (f *fakeTelemetryService) TelemetryAddOrUpdate(_ context.Context, req *ndk.TelemetryUpdateRequest, _ ...grpc.CallOption) (*ndk.TelemetryUpdateResponse, error) {
+	for _, s := range req.GetState() {
+		f.updated = append(f.updated, s.GetKey().GetJsPath())
+	}
+	return &ndk.TelemetryUpdateResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func (f *fakeTelemetryService) TelemetryDelete(_ context.Context, req *ndk.TelemetryDeleteRequest, _ ...grpc.CallOption) (*ndk.TelemetryDeleteResponse, error) {
+	f.deleteCalls++
+	for _, k := range req.GetKey() {
+		f.deleted = append(f.deleted, k.GetJsPath())
+	}
+	return &ndk.TelemetryDeleteResponse{Status: ndk.SdkMgrStatus_kSdkMgrSuccess}, nil
+}
+
+func TestStatePath(t *testing.T) {
+	tests := map[string]struct {
+		namespace string
+		path      string
+		want      string
+	}{
+		"No namespace":          {path: "/greeter/counters", want: "/greeter/counters"},
+		"No namespace empty":    {path: "", want: ""},
+		"Empty path":            {namespace: "/greeter/stats", path: "", want: "/greeter/stats"},
+		"Absolute path":         {namespace: "/greeter/stats", path: "/counters", want: "/greeter/stats/counters"},
+		"Relative path":         {namespace: "/greeter/stats", path: "counters", want: "/greeter/stats/counters"},
+		"List entry":            {namespace: "/greeter/stats", path: "/peer[name=p1]", want: "/greeter/stats/peer[name=p1]"},
+		"Namespace path":        {namespace: "/greeter/stats", path: "/greeter/stats", want: "/greeter/stats"},
+		"Path within namespace": {namespace: "/greeter/stats", path: "/greeter/stats/counters", want: "/greeter/stats/counters"},
+		"Namespace list entry":  {namespace: "/greeter/peer", path: "/greeter/peer[name=p1]", want: "/greeter/peer[name=p1]"},
+		"Sibling of namespace":  {namespace: "/greeter/stats", path: "/greeter/statsx", want: "/greeter/stats/greeter/statsx"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := &Agent{stateNamespace: tc.namespace}
+			if got := a.statePath(tc.path); got != tc.want {
+				t.Errorf("statePath(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStateNamespace(t *testing.T) {
+	a := newTestAgent(t, WithAppRootPath("/greeter"), WithStateNamespace("/greeter/stats"))
+	telemetry := &fakeTelemetryService{}
+	a.stubs = &stubs{telemetryService: telemetry}
+
+	if err := a.UpdateState("/counters", `{"hits": 1}`); err != nil {
+		t.Fatalf("UpdateState() returned error: %v", err)
+	}
+	// paths already within the namespace are not prefixed again
+	if err := a.UpdateState("/greeter/stats/counters", `{"hits": 2}`); err != nil {
+		t.Fatalf("UpdateState() returned error: %v", err)
+	}
+	if err := a.UpdateState("/peer[name=p1]", `{"up": true}`); err != nil {
+		t.Fatalf("UpdateState() returned error: %v", err)
+	}
+
+	wantUpdated := []string{".greeter.stats.counters", ".greeter.stats.counters", `.greeter.stats.peer{.name=="p1"}`}
+	if len(telemetry.updated) != len(wantUpdated) {
+		t.Fatalf("updated telemetry keys %v, want %v", telemetry.updated, wantUpdated)
+	}
+	for i, want := range wantUpdated {
+		if telemetry.updated[i] != want {
+			t.Errorf("updated telemetry key %d = %s, want %s", i, telemetry.updated[i], want)
+		}
+	}
+	for _, p := range []string{"/greeter/stats/counters", "/greeter/stats/peer[name=p1]"} {
+		if _, ok := a.paths[p]; !ok {
+			t.Errorf("path %s not tracked, tracked paths: %v", p, a.paths)
+		}
+	}
+	if len(a.paths) != 2 {
+		t.Errorf("tracked paths %v, want 2 paths", a.paths)
+	}
+
+	if err := a.DeleteState("/counters"); err != nil {
+		t.Fatalf("DeleteState() returned error: %v", err)
+	}
+	if len(telemetry.deleted) != 1 || telemetry.deleted[0] != ".greeter.stats.counters" {
+		t.Errorf("deleted telemetry keys %v, want [.greeter.stats.counters]", telemetry.deleted)
+	}
+	if _, ok := a.paths["/greeter/stats/counters"]; ok {
+		t.Errorf("deleted path /greeter/stats/counters still tracked")
+	}
+	if _, ok := a.paths["/greeter/stats/peer[name=p1]"]; !ok {
+		t.Errorf("path /greeter/stats/peer[name=p1] no longer tracked")
+	}
+
+	// an empty path deletes all state within the namespace,
+	// even though the namespace root itself was never updated
+	if err := a.DeleteState(""); err != nil {
+		t.Fatalf("DeleteState() of namespace returned error: %v", err)
+	}
+	if len(telemetry.deleted) != 2 || telemetry.deleted[1] != `.greeter.stats.peer{.name=="p1"}` {
+		t.Errorf("deleted telemetry keys %v, want namespace peer deleted", telemetry.deleted)
+	}
+	if len(a.paths) != 0 {
+		t.Errorf("tracked paths %v after deleting namespace, want none", a.paths)
+	}
+}
+
+func TestDeleteStateSibling(t *testing.T) {
+	a := newTestAgent(t, WithAppRootPath("/greeter"))
+	telemetry := &fakeTelemetryService{}
+	a.stubs = &stubs{telemetryService: telemetry}
+	for _, p := range []string{"/greeter/stats", "/greeter/stats/counters", "/greeter/statsx"} {
+		if err := a.UpdateState(p, "{}"); err != nil {
+			t.Fatalf("UpdateState() returned error: %v", err)
+		}
+	}
+
+	if err := a.DeleteState("/greeter/stats"); err != nil {
+		t.Fatalf("DeleteState() returned error: %v", err)
+	}
+	sort.Strings(telemetry.deleted)
+	if want := []string{".greeter.stats", ".greeter.stats.counters"}; !reflect.DeepEqual(telemetry.deleted, want) {
+		t.Errorf("deleted telemetry keys %v, want %v", telemetry.deleted, want)
+	}
+	if _, ok := a.paths["/greeter/statsx"]; !ok {
+		t.Errorf("sibling path /greeter/statsx no longer tracked")
+	}
+}
+
+func TestDeleteStateSingleRequest(t *testing.T) {
+	tests := map[string]struct {
+		path        string
+		wantDeleted []string
+		wantTracked []string
+	}{
+		"Delete all": {
+			path: "",
+			wantDeleted: []string{
+				".greeter",
+				`.greeter.peer{.name=="p1"}`,
+				`.greeter.peer{.name=="p2"}`,
+			},
+		},
+		"Delete root": {
+			path: "/greeter",
+			wantDeleted: []string{
+				".greeter",
+				`.greeter.peer{.name=="p1"}`,
+				`.greeter.peer{.name=="p2"}`,
+			},
+		},
+		"Delete list entry": {
+			path:        "/greeter/peer[name=p1]",
+			wantDeleted: []string{`.greeter.peer{.name=="p1"}`},
+			wantTracked: []string{"/greeter", "/greeter/peer[name=p2]"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, WithAppRootPath("/greeter"))
+			telemetry := &fakeTelemetryService{}
+			a.stubs = &stubs{telemetryService: telemetry}
+			for _, p := range []string{"/greeter", "/greeter/peer[name=p1]", "/greeter/peer[name=p2]"} {
+				if err := a.UpdateState(p, "{}"); err != nil {
+					t.Fatalf("UpdateState() returned error: %v", err)
+				}
+			}
+
+			if err := a.DeleteState(tc.path); err != nil {
+				t.Fatalf("DeleteState() returned error: %v", err)
+			}
+
+			if telemetry.deleteCalls != 1 {
+				t.Errorf("DeleteState() issued %d TelemetryDelete requests, want 1", telemetry.deleteCalls)
+			}
+			sort.Strings(telemetry.deleted)
+			if !reflect.DeepEqual(telemetry.deleted, tc.wantDeleted) {
+				t.Errorf("deleted telemetry keys %v, want %v", telemetry.deleted, tc.wantDeleted)
+			}
+			tracked := []string{}
+			for p := range a.paths {
+				tracked = append(tracked, p)
+			}
+			sort.Strings(tracked)
+			if len(tc.wantTracked) == 0 {
+				tc.wantTracked = []string{}
+			}
+			if !reflect.DeepEqual(tracked, tc.wantTracked) {
+				t.Errorf("tracked state paths %v, want %v", tracked, tc.wantTracked)
+			}
+		})
+	}
+}
+
+func TestNewTelemetryInfo(t *testing.T) {
+	tests := map[string]struct {
+		xpath      string
+		wantJsPath string
+	}{
+		"Root container": {
+			xpath:      "/greeter",
+			wantJsPath: ".greeter",
+		},
+		"List entry": {
+			xpath:      "/greeter/list-node[name=entry1]",
+			wantJsPath: `.greeter.list-node{.name=="entry1"}`,
+		},
+		"Nested list entries": {
+			xpath:      "/greeter/peer[name=p1]/session[id=1]/counters",
+			wantJsPath: `.greeter.peer{.name=="p1"}.session{.id=="1"}.counters`,
+		},
+		"Key with slash": {
+			xpath:      "/greeter/intf[name=ethernet-1/1]",
+			wantJsPath: `.greeter.intf{.name=="ethernet-1/1"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			info := NewTelemetryInfo(tc.xpath, `{"up": true}`)
+			if got := info.GetKey().GetJsPath(); got != tc.wantJsPath {
+				t.Errorf("NewTelemetryInfo() JsPath = %s, want %s", got, tc.wantJsPath)
+			}
+			if got := info.GetData().GetJsonContent(); got != `{"up": true}` {
+				t.Errorf("NewTelemetryInfo() JsonContent = %s, want {\"up\": true}", got)
+			}
+		})
+	}
+}
+
+func TestUpdateStateDataShape(t *testing.T) {
+	tests := map[string]struct {
+		path    string
+		data    string
+		wantErr error
+	}{
+		"Object":          {path: "/greeter", data: `{"name": "bond"}`},
+		"Empty object":    {path: "/greeter/peer[name=p1]", data: `{}`},
+		"Root container":  {path: "", data: `{"up": true}`},
+		"String":          {path: "/greeter", data: `"bond"`, wantErr: ErrInvalidStateData},
+		"Number":          {path: "/greeter/peer[name=p1]", data: `42`, wantErr: ErrInvalidStateData},
+		"Array":           {path: "/greeter", data: `[{"name": "bond"}]`, wantErr: ErrInvalidStateData},
+		"Null":            {path: "/greeter", data: `null`, wantErr: ErrInvalidStateData},
+		"Invalid json":    {path: "/greeter", data: `{"name":`, wantErr: ErrInvalidStateData},
+		"Unquoted scalar": {path: "/greeter", data: `bond`, wantErr: ErrInvalidStateData},
+		"Empty data":      {path: "/greeter", data: ``, wantErr: ErrInvalidStateData},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAgent(t, WithAppRootPath("/greeter"))
+			telemetry := &fakeTelemetryService{}
+			a.stubs = &stubs{telemetryService: telemetry}
+
+			err := a.UpdateState(tc.path, tc.data)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("UpdateState() error = %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil && len(telemetry.updated) != 0 {
+				t.Errorf("UpdateState() sent telemetry update for invalid data")
+			}
+			if tc.wantErr == nil && len(telemetry.updated) != 1 {
+				t.Errorf("UpdateState() sent %d telemetry updates, want 1", len(telemetry.updated))
+			}
+		})
+	}
+}